@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/mertsaygi/orchestrdb/src/db"
+	"github.com/mertsaygi/orchestrdb/src/discovery"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// runDiscover implements `orchestrdb discover`: it connects to a server with
+// admin credentials and prints Database/User manifests in adoption mode, or
+// stores them in a ConfigMap. The admin password is read from PGPASSWORD.
+func runDiscover(args []string) error {
+	fs := flag.NewFlagSet("discover", flag.ExitOnError)
+
+	var opts discovery.Options
+	var port int
+	var adminUser, sslRootCert, configMap string
+	var includeDBs, excludeDBs, includeRoles, excludeRoles string
+
+	fs.StringVar(&opts.Host, "host", "", "Database server host.")
+	fs.IntVar(&port, "port", 5432, "Database server port.")
+	fs.StringVar(&adminUser, "admin-user", "postgres", "Admin user; the password is read from PGPASSWORD.")
+	fs.StringVar(&opts.SSLMode, "sslmode", "require", "SSL mode used for discovery and in the generated manifests.")
+	fs.StringVar(&sslRootCert, "sslrootcert", "", "PEM file with the CA used to verify the server certificate.")
+	fs.StringVar(&opts.Namespace, "namespace", "default", "Namespace of the generated resources.")
+	fs.StringVar(&opts.AdminSecretName, "admin-secret", "", "Secret (keys username/password) referenced as adminSecretRef by the generated resources.")
+	fs.StringVar(&includeDBs, "include-databases", "", "Only include databases matching this regular expression.")
+	fs.StringVar(&excludeDBs, "exclude-databases", discovery.DefaultExcludeDatabases, "Exclude databases matching this regular expression.")
+	fs.StringVar(&includeRoles, "include-roles", "", "Only include roles matching this regular expression.")
+	fs.StringVar(&excludeRoles, "exclude-roles", discovery.DefaultExcludeRoles, "Exclude roles matching this regular expression.")
+	fs.StringVar(&configMap, "configmap", "", "Write the manifests to this ConfigMap (namespace/name) instead of stdout.")
+	_ = fs.Parse(args)
+
+	if opts.Host == "" {
+		return fmt.Errorf("--host is required")
+	}
+	opts.Port = int32(port)
+
+	var err error
+	for _, f := range []struct {
+		value string
+		dst   **regexp.Regexp
+	}{
+		{includeDBs, &opts.Filter.IncludeDatabases},
+		{excludeDBs, &opts.Filter.ExcludeDatabases},
+		{includeRoles, &opts.Filter.IncludeRoles},
+		{excludeRoles, &opts.Filter.ExcludeRoles},
+	} {
+		if f.value == "" {
+			continue
+		}
+		if *f.dst, err = regexp.Compile(f.value); err != nil {
+			return fmt.Errorf("invalid filter %q: %w", f.value, err)
+		}
+	}
+
+	conn := db.ConnectionParams{
+		Host:      opts.Host,
+		Port:      opts.Port,
+		AdminUser: adminUser,
+		Password:  os.Getenv("PGPASSWORD"),
+		SSLMode:   opts.SSLMode,
+	}
+	if sslRootCert != "" {
+		if conn.SSLRootCert, err = os.ReadFile(sslRootCert); err != nil {
+			return err
+		}
+	}
+
+	ctx := ctrl.SetupSignalHandler()
+
+	objs, err := discovery.Discover(ctx, db.NewPostgresAdapter(db.PoolOptions{}, nil), conn, opts)
+	if err != nil {
+		return err
+	}
+	manifests, err := discovery.Render(objs)
+	if err != nil {
+		return err
+	}
+
+	if configMap == "" {
+		_, err = os.Stdout.Write(manifests)
+		return err
+	}
+
+	ns, name, ok := strings.Cut(configMap, "/")
+	if !ok || ns == "" || name == "" {
+		return fmt.Errorf("--configmap must be namespace/name, got %q", configMap)
+	}
+
+	k8sClient, err := client.New(ctrl.GetConfigOrDie(), client.Options{Scheme: scheme})
+	if err != nil {
+		return err
+	}
+	cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns}}
+	_, err = controllerutil.CreateOrUpdate(ctx, k8sClient, cm, func() error {
+		cm.Data = map[string]string{"manifests.yaml": string(manifests)}
+		return nil
+	})
+	return err
+}
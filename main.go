@@ -2,17 +2,24 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/audit"
 	"github.com/mertsaygi/orchestrdb/src/controllers"
+	"github.com/mertsaygi/orchestrdb/src/credentials"
 	"github.com/mertsaygi/orchestrdb/src/db"
 	"github.com/mertsaygi/orchestrdb/src/services"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
 
@@ -26,11 +33,67 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "discover" {
+		if err := runDiscover(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, "discover:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var enableLeaderElection bool
+	var vaultCfg credentials.VaultConfig
+	var vaultPathTemplate string
+	var poolOpts db.PoolOptions
+	var resyncInterval time.Duration
+	var dryRun bool
+	var auditLogFile, auditWebhookURL string
+	var passwordPolicy v1alpha1.PasswordPolicy
+	var passwordClasses string
+	var passwordURLSafe bool
+	var leaseWarning time.Duration
+	var pgToolsImage string
+	var s3ToolsImage string
+	var jobDeadline time.Duration
+	var hardeningProfile string
 
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false, "Enable leader election for controller manager.")
+	var maxConnsPerServer int
+	flag.IntVar(&maxConnsPerServer, "max-conns-per-server", 5, "Maximum concurrent connections per database server (minimum 2).")
+	flag.BoolVar(&dryRun, "dry-run", false, "Record the SQL that would be executed in status.plan instead of executing it.")
+	flag.StringVar(&auditLogFile, "audit-log-file", "", "Append audit records of executed statements as JSON lines to this file.")
+	flag.StringVar(&auditWebhookURL, "audit-webhook-url", "", "POST audit records of executed statements as JSON to this URL.")
+	flag.IntVar(&passwordPolicy.Length, "password-length", 32, "Length of generated passwords.")
+	flag.StringVar(&passwordClasses, "password-classes", "lowercase,uppercase,digits,symbols", "Comma-separated character classes of generated passwords.")
+	flag.StringVar(&passwordPolicy.Symbols, "password-symbols", "", "Symbols used by generated passwords (default \"!@#$%^&*()-_=+\").")
+	flag.StringVar(&passwordPolicy.ExcludeCharacters, "password-exclude", "", "Characters never used in generated passwords.")
+	flag.BoolVar(&passwordURLSafe, "password-url-safe", false, "Restrict symbols in generated passwords to URL-safe characters (-._~).")
+	flag.StringVar(&hardeningProfile, "hardening-profile", string(v1alpha1.HardeningNone), "Hardening profile of Databases without spec.hardening.profile: None or Restricted.")
+	flag.DurationVar(&resyncInterval, "resync-interval", 10*time.Minute, "How often reconciled resources are checked for drift (0 disables).")
+	flag.StringVar(&pgToolsImage, "pg-tools-image", "postgres:16", "Image with pg_dump/pg_restore used by Jobs; its major version must not be older than the servers'.")
+	flag.StringVar(&s3ToolsImage, "s3-tools-image", "amazon/aws-cli:2.17.0", "Image with the AWS CLI used by backup Jobs with an S3 destination.")
+	flag.DurationVar(&jobDeadline, "job-deadline", 6*time.Hour, "How long clone, backup and restore Jobs may run; their database roles expire then.")
+	flag.DurationVar(&leaseWarning, "lease-warning", 24*time.Hour, "Emit an ExpiringSoon warning this long before the lease of a Database or DatabaseClaim expires.")
+	flag.DurationVar(&poolOpts.IdleTimeout, "pool-idle-timeout", 5*time.Minute, "Close connection pools unused for this long.")
+	flag.DurationVar(&poolOpts.AcquireTimeout, "pool-acquire-timeout", 30*time.Second, "How long to wait for a free connection to a server before retrying later.")
+	flag.StringVar(&vaultCfg.Address, "vault-addr", os.Getenv("VAULT_ADDR"), "Vault server address. Enables adminVaultRef and generatedSecret.vaultPath.")
+	flag.StringVar(&vaultCfg.Namespace, "vault-namespace", os.Getenv("VAULT_NAMESPACE"), "Vault Enterprise namespace.")
+	flag.StringVar(&vaultCfg.AuthMethod, "vault-auth-method", "kubernetes", "Vault auth method: kubernetes or token.")
+	flag.StringVar(&vaultCfg.KubernetesRole, "vault-role", "", "Vault role used with the kubernetes auth method.")
+	flag.StringVar(&vaultCfg.KubernetesMount, "vault-auth-mount", "kubernetes", "Mount path of the Vault kubernetes auth method.")
+	flag.StringVar(&vaultCfg.CACertFile, "vault-cacert", os.Getenv("VAULT_CACERT"), "PEM file with the CA used to verify the Vault server.")
+	flag.StringVar(&vaultPathTemplate, "vault-path-template", services.DefaultVaultPathTemplate, "Template of the Vault path prefix resources of a namespace may use ({{ .Namespace }}).")
 	flag.Parse()
 
+	poolOpts.MaxConnsPerServer = int32(maxConnsPerServer)
+	if passwordClasses != "" {
+		passwordPolicy.CharacterClasses = strings.Split(passwordClasses, ",")
+	}
+	passwordPolicy.URLSafe = &passwordURLSafe
+
+	// The token is only read from the environment to keep it out of the process list.
+	vaultCfg.Token = os.Getenv("VAULT_TOKEN")
+
 	// Configure logger
 	opts := zap.Options{
 		Development: true,
@@ -51,14 +114,61 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Optional Vault credential provider
+	var vaultProvider credentials.Provider
+	if vaultCfg.Address != "" {
+		vp, err := credentials.NewVaultProvider(vaultCfg)
+		if err != nil {
+			ctrl.Log.Error(err, "unable to configure Vault")
+			os.Exit(1)
+		}
+		vaultProvider = vp
+	}
+	vaultPaths, err := services.NewVaultPathPolicy(vaultPathTemplate)
+	if err != nil {
+		ctrl.Log.Error(err, "unable to configure Vault")
+		os.Exit(1)
+	}
+
+	// Audit sinks: always the "audit" logger, optionally a file and a webhook
+	auditSinks := []audit.Sink{&audit.LogSink{Log: ctrl.Log.WithName("audit")}}
+	if auditLogFile != "" {
+		fileSink, err := audit.NewFileSink(auditLogFile)
+		if err != nil {
+			ctrl.Log.Error(err, "unable to open audit log file")
+			os.Exit(1)
+		}
+		auditSinks = append(auditSinks, fileSink)
+	}
+	if auditWebhookURL != "" {
+		auditSinks = append(auditSinks, audit.NewWebhookSink(auditWebhookURL))
+	}
+	auditor := audit.NewAuditor(ctrl.Log.WithName("audit"), auditSinks...)
+
 	// Wire DB adapter + service
-	postgresAdapter := db.NewPostgresAdapter()
+	postgresAdapter := db.NewPostgresAdapter(poolOpts, auditor)
+	if err := mgr.Add(postgresAdapter); err != nil {
+		ctrl.Log.Error(err, "unable to register DB adapter")
+		os.Exit(1)
+	}
+
+	if err := services.ValidatePasswordPolicy(passwordPolicy, postgresAdapter.PasswordRules()); err != nil {
+		ctrl.Log.Error(err, "invalid password policy")
+		os.Exit(1)
+	}
+
+	switch v1alpha1.HardeningProfile(hardeningProfile) {
+	case v1alpha1.HardeningNone, v1alpha1.HardeningRestricted:
+	default:
+		ctrl.Log.Error(fmt.Errorf("unknown profile %q", hardeningProfile), "invalid hardening profile")
+		os.Exit(1)
+	}
 
 	// DatabaseService
-	dbService := services.NewDatabaseService(postgresAdapter)
+	dbService := services.NewDatabaseService(mgr.GetClient(), postgresAdapter, v1alpha1.HardeningProfile(hardeningProfile))
 
 	// UserService
-	userService := services.NewUserService(mgr.GetClient(), postgresAdapter)
+	userService := services.NewUserService(mgr.GetClient(), postgresAdapter, vaultProvider, vaultPaths, passwordPolicy)
 
 	// Register controller
 	if err = (&controllers.DatabaseReconciler{
@@ -66,20 +176,118 @@ func main() {
 		Scheme:          mgr.GetScheme(),
 		Log:             ctrl.Log.WithName("controllers").WithName("Database"),
 		DatabaseService: dbService,
+		Vault:           vaultProvider,
+		VaultPaths:      vaultPaths,
+		Recorder:        mgr.GetEventRecorderFor("database-controller"),
+		ResyncInterval:  resyncInterval,
+		DryRun:          dryRun,
+		PGToolsImage:    pgToolsImage,
+		JobDeadline:     jobDeadline,
 	}).SetupWithManager(mgr); err != nil {
 		ctrl.Log.Error(err, "unable to create controller", "controller", "Database")
 		os.Exit(1)
 	}
 
 	if err = (&controllers.UserReconciler{
-		Client:      mgr.GetClient(),
-		Scheme:      mgr.GetScheme(),
-		UserService: userService,
+		Client:         mgr.GetClient(),
+		Scheme:         mgr.GetScheme(),
+		UserService:    userService,
+		Recorder:       mgr.GetEventRecorderFor("user-controller"),
+		ResyncInterval: resyncInterval,
+		DryRun:         dryRun,
 	}).SetupWithManager(mgr); err != nil {
 		ctrl.Log.Error(err, "unable to create controller", "controller", "User")
 		os.Exit(1)
 	}
 
+	if err = (&controllers.DatabaseClaimReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		ctrl.Log.Error(err, "unable to create controller", "controller", "DatabaseClaim")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.BackupReconciler{
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		Log:             ctrl.Log.WithName("controllers").WithName("Backup"),
+		DatabaseService: dbService,
+		APIReader:       mgr.GetAPIReader(),
+		Vault:           vaultProvider,
+		VaultPaths:      vaultPaths,
+		Recorder:        mgr.GetEventRecorderFor("backup-controller"),
+		PGToolsImage:    pgToolsImage,
+		S3ToolsImage:    s3ToolsImage,
+		JobDeadline:     jobDeadline,
+		ResyncInterval:  resyncInterval,
+	}).SetupWithManager(mgr); err != nil {
+		ctrl.Log.Error(err, "unable to create controller", "controller", "Backup")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.BackupScheduleReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Log:      ctrl.Log.WithName("controllers").WithName("BackupSchedule"),
+		Recorder: mgr.GetEventRecorderFor("backupschedule-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		ctrl.Log.Error(err, "unable to create controller", "controller", "BackupSchedule")
+		os.Exit(1)
+	}
+
+	if err = (&controllers.RestoreReconciler{
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		Log:             ctrl.Log.WithName("controllers").WithName("Restore"),
+		DatabaseService: dbService,
+		APIReader:       mgr.GetAPIReader(),
+		Vault:           vaultProvider,
+		VaultPaths:      vaultPaths,
+		Recorder:        mgr.GetEventRecorderFor("restore-controller"),
+		PGToolsImage:    pgToolsImage,
+		S3ToolsImage:    s3ToolsImage,
+		JobDeadline:     jobDeadline,
+		ResyncInterval:  resyncInterval,
+	}).SetupWithManager(mgr); err != nil {
+		ctrl.Log.Error(err, "unable to create controller", "controller", "Restore")
+		os.Exit(1)
+	}
+
+	coreClient, err := corev1client.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		ctrl.Log.Error(err, "unable to create core client")
+		os.Exit(1)
+	}
+	if err = (&controllers.MigrationReconciler{
+		Client:          mgr.GetClient(),
+		Scheme:          mgr.GetScheme(),
+		Log:             ctrl.Log.WithName("controllers").WithName("Migration"),
+		DatabaseService: dbService,
+		APIReader:       mgr.GetAPIReader(),
+		PodLogs:         coreClient,
+		Vault:           vaultProvider,
+		VaultPaths:      vaultPaths,
+		Recorder:        mgr.GetEventRecorderFor("migration-controller"),
+		PGToolsImage:    pgToolsImage,
+	}).SetupWithManager(mgr); err != nil {
+		ctrl.Log.Error(err, "unable to create controller", "controller", "Migration")
+		os.Exit(1)
+	}
+
+	// Leases (spec.ttl/spec.expiresAt) of Databases and DatabaseClaims
+	for _, obj := range []client.Object{&v1alpha1.Database{}, &v1alpha1.DatabaseClaim{}} {
+		if err = (&controllers.LeaseReconciler{
+			Client:        mgr.GetClient(),
+			Object:        obj,
+			Recorder:      mgr.GetEventRecorderFor("lease-controller"),
+			WarningWindow: leaseWarning,
+		}).SetupWithManager(mgr); err != nil {
+			ctrl.Log.Error(err, "unable to create controller", "controller", "Lease")
+			os.Exit(1)
+		}
+	}
+
 	ctrl.Log.Info("starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		ctrl.Log.Error(err, "problem running manager")
@@ -0,0 +1,239 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// BackupFormat is the pg_dump output format of a Backup.
+type BackupFormat string
+
+const (
+	// BackupFormatCustom is pg_dump's compressed archive (pg_restore input).
+	BackupFormatCustom BackupFormat = "custom"
+
+	// BackupFormatPlain is a plain SQL script (gzipped when compressed).
+	BackupFormatPlain BackupFormat = "plain"
+
+	// BackupFormatDirectory is a directory with one file per table.
+	BackupFormatDirectory BackupFormat = "directory"
+)
+
+// BackupSpec defines the desired state of a Backup. A Backup runs once; its
+// spec is not applied again after the backup started.
+type BackupSpec struct {
+	// DatabaseRef names the Database resource to back up, in the same
+	// namespace. It must have been created by the operator.
+	DatabaseRef DatabaseReference `json:"databaseRef"`
+
+	// Format of the dump: custom (default), plain or directory.
+	Format BackupFormat `json:"format,omitempty"`
+
+	// Compression level 0-9 passed to pg_dump. Unset uses pg_dump's default.
+	Compression *int32 `json:"compression,omitempty"`
+
+	// Destination receiving the dump.
+	Destination BackupDestination `json:"destination"`
+
+	// DeletionPolicy of the dump: Retain (default) keeps it when the Backup
+	// is deleted, Delete removes it with a Job first.
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// BackupDestination is where a dump is stored. Exactly one field is set.
+type BackupDestination struct {
+	// PVC stores the dump on a PersistentVolumeClaim.
+	PVC *PVCDestination `json:"pvc,omitempty"`
+
+	// S3 uploads the dump to an S3 bucket or an S3-compatible store such as MinIO.
+	S3 *S3Destination `json:"s3,omitempty"`
+}
+
+// PVCDestination is a directory on a PersistentVolumeClaim in the namespace
+// of the Backup.
+type PVCDestination struct {
+	ClaimName string `json:"claimName"`
+
+	// Path of the directory inside the volume (default: the volume root).
+	// It must be relative and must not contain "..".
+	Path string `json:"path,omitempty"`
+}
+
+// S3Destination is a bucket and key prefix of an S3-compatible store.
+type S3Destination struct {
+	Bucket string `json:"bucket"`
+
+	// Prefix of the object key; the key is <prefix>/<backup name><extension>.
+	Prefix string `json:"prefix,omitempty"`
+
+	// Endpoint URL of an S3-compatible store, e.g. http://minio.minio:9000.
+	// Empty uses AWS.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Region of the bucket (default us-east-1).
+	Region string `json:"region,omitempty"`
+
+	// ForcePathStyle addresses the bucket in the path instead of the host
+	// name, as most S3-compatible stores require.
+	ForcePathStyle bool `json:"forcePathStyle,omitempty"`
+
+	// CredentialsSecretRef names the Secret with the access keys, in the
+	// namespace of the Backup.
+	CredentialsSecretRef S3CredentialsRef `json:"credentialsSecretRef"`
+}
+
+// S3CredentialsRef refers to a Secret with S3 access keys.
+type S3CredentialsRef struct {
+	Name string `json:"name"`
+
+	// AccessKeyIDKey is the key of the access key ID (default AWS_ACCESS_KEY_ID).
+	AccessKeyIDKey string `json:"accessKeyIDKey,omitempty"`
+
+	// SecretAccessKeyKey is the key of the secret access key
+	// (default AWS_SECRET_ACCESS_KEY).
+	SecretAccessKeyKey string `json:"secretAccessKeyKey,omitempty"`
+}
+
+// BackupPhase is the progress of a Backup.
+type BackupPhase string
+
+const (
+	// BackupPending: waiting for the Database or for the Job to start.
+	BackupPending BackupPhase = "Pending"
+
+	// BackupRunning: the backup Job is running.
+	BackupRunning BackupPhase = "Running"
+
+	// BackupCompleted: the dump is stored at status.location.
+	BackupCompleted BackupPhase = "Completed"
+
+	// BackupFailed: the backup failed and is not retried. Create a new
+	// Backup to try again.
+	BackupFailed BackupPhase = "Failed"
+)
+
+// BackupStatus defines the observed state of a Backup.
+type BackupStatus struct {
+	Phase BackupPhase `json:"phase,omitempty"`
+
+	// Database is the name of the backed up database on its server.
+	Database string `json:"database,omitempty"`
+
+	// Job running the backup.
+	Job string `json:"job,omitempty"`
+
+	// Location of the dump: pvc://<claim>/<path> or s3://<bucket>/<key>.
+	Location string `json:"location,omitempty"`
+
+	// SizeBytes of the dump (of all files for the directory format).
+	SizeBytes int64 `json:"sizeBytes,omitempty"`
+
+	// Duration of the backup Job, e.g. "1m30s".
+	Duration string `json:"duration,omitempty"`
+
+	// Checksum of the dump as sha256:<hex>. For the directory format it is
+	// the checksum of the sha256sum listing of its files.
+	Checksum string `json:"checksum,omitempty"`
+
+	// StartedAt and CompletedAt bound the backup Job.
+	StartedAt   *metav1.Time `json:"startedAt,omitempty"`
+	CompletedAt *metav1.Time `json:"completedAt,omitempty"`
+
+	// Message describes the current phase.
+	Message string `json:"message,omitempty"`
+
+	// Last time the resource was reconciled (RFC3339 format).
+	UpdatedAt string `json:"updatedAt,omitempty"`
+
+	// Standard conditions (Ready).
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Finished reports whether the backup completed or failed; neither is
+// retried.
+func (in *Backup) Finished() bool {
+	return in.Status.Phase == BackupCompleted || in.Status.Phase == BackupFailed
+}
+
+// +kubebuilder:object:root=true
+
+// Backup is a one-off pg_dump of a Database run by a Job and stored on a
+// PersistentVolumeClaim or in S3.
+type Backup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   BackupSpec   `json:"spec,omitempty"`
+	Status BackupStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// BackupList contains a list of Backup.
+type BackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Backup `json:"items"`
+}
+
+// DeepCopy returns a deep copy of the backup spec.
+func (in *BackupSpec) DeepCopy() *BackupSpec {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	if in.Compression != nil {
+		level := *in.Compression
+		out.Compression = &level
+	}
+	if in.Destination.PVC != nil {
+		pvc := *in.Destination.PVC
+		out.Destination.PVC = &pvc
+	}
+	if in.Destination.S3 != nil {
+		s3 := *in.Destination.S3
+		out.Destination.S3 = &s3
+	}
+	return &out
+}
+
+// DeepCopyObject implements runtime.Object for Backup.
+func (in *Backup) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := new(Backup)
+	*out = *in
+
+	out.ObjectMeta = *in.ObjectMeta.DeepCopy()
+	out.Spec = *in.Spec.DeepCopy()
+
+	out.Status.StartedAt = in.Status.StartedAt.DeepCopy()
+	out.Status.CompletedAt = in.Status.CompletedAt.DeepCopy()
+	if in.Status.Conditions != nil {
+		out.Status.Conditions = make([]metav1.Condition, len(in.Status.Conditions))
+		copy(out.Status.Conditions, in.Status.Conditions)
+	}
+
+	return out
+}
+
+// DeepCopyObject implements runtime.Object for BackupList.
+func (in *BackupList) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupList)
+	*out = *in
+
+	out.ListMeta = *in.ListMeta.DeepCopy()
+
+	if in.Items != nil {
+		out.Items = make([]Backup, len(in.Items))
+		for i := range in.Items {
+			out.Items[i] = *in.Items[i].DeepCopyObject().(*Backup)
+		}
+	}
+
+	return out
+}
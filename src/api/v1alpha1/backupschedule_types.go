@@ -0,0 +1,134 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// LabelBackupSchedule is set on Backups created by a BackupSchedule and
+// holds the schedule's name.
+const LabelBackupSchedule = GroupName + "/backup-schedule"
+
+// LabelBackupScheduleUID holds the UID of the schedule that created a
+// Backup, so a later schedule of the same name does not prune it.
+const LabelBackupScheduleUID = GroupName + "/backup-schedule-uid"
+
+// BackupScheduleSpec defines the desired state of a BackupSchedule.
+type BackupScheduleSpec struct {
+	// Schedule in cron format (e.g. "0 3 * * *"), evaluated in UTC.
+	// Descriptors such as @daily are accepted.
+	Schedule string `json:"schedule"`
+
+	// Template of the Backups created at every scheduled time.
+	Template BackupSpec `json:"template"`
+
+	// Retention of the Backups created by the schedule.
+	Retention BackupRetention `json:"retention,omitempty"`
+
+	// Suspend stops creating Backups; existing ones are still pruned.
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// BackupRetention decides which finished Backups of a schedule are deleted.
+// A Backup is kept while either rule keeps it; with neither set, all are
+// kept. Deleting a Backup removes its dump only with deletionPolicy Delete.
+type BackupRetention struct {
+	// KeepLast keeps this many of the most recent completed Backups.
+	KeepLast *int32 `json:"keepLast,omitempty"`
+
+	// MaxAge keeps Backups created less than this long ago (e.g. "720h").
+	MaxAge *metav1.Duration `json:"maxAge,omitempty"`
+}
+
+// BackupScheduleStatus defines the observed state of a BackupSchedule.
+type BackupScheduleStatus struct {
+	// LastScheduleTime is the scheduled time of the last created Backup.
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// LastSuccessfulTime is when the last Backup of the schedule completed.
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+
+	// LastBackup is the name of the last created Backup.
+	LastBackup string `json:"lastBackup,omitempty"`
+
+	// NextScheduleTime is the next time a Backup is created.
+	NextScheduleTime *metav1.Time `json:"nextScheduleTime,omitempty"`
+
+	// Last time the resource was reconciled (RFC3339 format).
+	UpdatedAt string `json:"updatedAt,omitempty"`
+
+	// Standard conditions (Ready).
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// BackupSchedule creates Backups of a Database on a cron schedule and
+// prunes them according to its retention.
+type BackupSchedule struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   BackupScheduleSpec   `json:"spec,omitempty"`
+	Status BackupScheduleStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// BackupScheduleList contains a list of BackupSchedule.
+type BackupScheduleList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []BackupSchedule `json:"items"`
+}
+
+// DeepCopyObject implements runtime.Object for BackupSchedule.
+func (in *BackupSchedule) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupSchedule)
+	*out = *in
+
+	out.ObjectMeta = *in.ObjectMeta.DeepCopy()
+	out.Spec.Template = *in.Spec.Template.DeepCopy()
+
+	if in.Spec.Retention.KeepLast != nil {
+		keep := *in.Spec.Retention.KeepLast
+		out.Spec.Retention.KeepLast = &keep
+	}
+	if in.Spec.Retention.MaxAge != nil {
+		age := *in.Spec.Retention.MaxAge
+		out.Spec.Retention.MaxAge = &age
+	}
+
+	out.Status.LastScheduleTime = in.Status.LastScheduleTime.DeepCopy()
+	out.Status.LastSuccessfulTime = in.Status.LastSuccessfulTime.DeepCopy()
+	out.Status.NextScheduleTime = in.Status.NextScheduleTime.DeepCopy()
+	if in.Status.Conditions != nil {
+		out.Status.Conditions = make([]metav1.Condition, len(in.Status.Conditions))
+		copy(out.Status.Conditions, in.Status.Conditions)
+	}
+
+	return out
+}
+
+// DeepCopyObject implements runtime.Object for BackupScheduleList.
+func (in *BackupScheduleList) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupScheduleList)
+	*out = *in
+
+	out.ListMeta = *in.ListMeta.DeepCopy()
+
+	if in.Items != nil {
+		out.Items = make([]BackupSchedule, len(in.Items))
+		for i := range in.Items {
+			out.Items[i] = *in.Items[i].DeepCopyObject().(*BackupSchedule)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,142 @@
+package v1alpha1
+
+// Condition types reported in status.conditions.
+const (
+	// ConditionReady is True when the last reconcile applied the spec on the server.
+	ConditionReady = "Ready"
+
+	// ConditionPaused is True while the paused annotation is set.
+	ConditionPaused = "Paused"
+
+	// ConditionDrifted is True when the last resync found the server out of
+	// line with the spec and the drift was not repaired.
+	ConditionDrifted = "Drifted"
+
+	// ConditionHardened is True when the last check found the restrictions
+	// of the hardening profile in place. It is absent without a profile.
+	ConditionHardened = "Hardened"
+)
+
+// Condition reasons. Failure reasons reported by the adapters use the error
+// category names (AuthFailed, Unreachable, PermissionDenied, InvalidSpec,
+// Conflict, Transient).
+const (
+	// ReasonReconciled: the spec was applied successfully.
+	ReasonReconciled = "Reconciled"
+
+	// ReasonPausedByAnnotation: the paused annotation is set.
+	ReasonPausedByAnnotation = "PausedByAnnotation"
+
+	// ReasonInSync: the server matches the spec.
+	ReasonInSync = "InSync"
+
+	// ReasonDriftDetected: drift was found and left in place (driftPolicy Report).
+	ReasonDriftDetected = "DriftDetected"
+
+	// ReasonDriftRepaired: drift was found and the spec was re-applied.
+	ReasonDriftRepaired = "DriftRepaired"
+
+	// ReasonDryRun: Event reason used when a dry run produced a new plan.
+	ReasonDryRun = "DryRun"
+
+	// ReasonBound: the DatabaseClaim's Database and User are ready.
+	ReasonBound = "Bound"
+
+	// ReasonProvisioning: the DatabaseClaim's Database or User is not ready yet.
+	ReasonProvisioning = "Provisioning"
+
+	// ReasonClassNotFound: the DatabaseClass of a claim does not exist
+	// (or no default class is set).
+	ReasonClassNotFound = "ClassNotFound"
+
+	// ReasonNamespaceNotAllowed: the DatabaseClass does not serve the
+	// namespace of the claim.
+	ReasonNamespaceNotAllowed = "NamespaceNotAllowed"
+
+	// ReasonPlaced: Event reason used when a Database was placed on a server of its pool.
+	ReasonPlaced = "Placed"
+
+	// ReasonExpiringSoon: Event reason used when a lease expires within the warning window.
+	ReasonExpiringSoon = "ExpiringSoon"
+
+	// ReasonExpired: Event reason used when a lease expired and the resource is deleted.
+	ReasonExpired = "Expired"
+
+	// ReasonLeaseExtended: Event reason used when the extend-lease annotation was applied.
+	ReasonLeaseExtended = "LeaseExtended"
+
+	// ReasonDropped: Event reason used when deletionPolicy Delete dropped the object on the server.
+	ReasonDropped = "Dropped"
+
+	// ReasonDropSkipped: Event reason used when a drop was skipped (unmanaged object or dry run).
+	ReasonDropSkipped = "DropSkipped"
+
+	// ReasonCloning: the database is being copied from spec.source.
+	ReasonCloning = "Cloning"
+
+	// ReasonSourceNotReady: the Database named in spec.source does not exist or is not created yet.
+	ReasonSourceNotReady = "SourceNotReady"
+
+	// ReasonCloneFailed: copying the database from spec.source failed.
+	ReasonCloneFailed = "CloneFailed"
+
+	// ReasonCloned: Event reason used when the copy from spec.source completed.
+	ReasonCloned = "Cloned"
+
+	// ReasonBackupPending: the Backup waits for its Database or for the Job to start.
+	ReasonBackupPending = "BackupPending"
+
+	// ReasonBackupRunning: the backup Job is running.
+	ReasonBackupRunning = "BackupRunning"
+
+	// ReasonBackupCompleted: the dump is stored at status.location.
+	ReasonBackupCompleted = "BackupCompleted"
+
+	// ReasonBackupFailed: the backup Job failed.
+	ReasonBackupFailed = "BackupFailed"
+
+	// ReasonBackupDeleted: Event reason used when deletionPolicy Delete removed the dump.
+	ReasonBackupDeleted = "BackupDeleted"
+
+	// ReasonBackupCleanupFailed: Event reason used when removing the dump failed.
+	ReasonBackupCleanupFailed = "BackupCleanupFailed"
+
+	// ReasonScheduled: the BackupSchedule is active; also the Event reason
+	// used when it created a Backup.
+	ReasonScheduled = "Scheduled"
+
+	// ReasonSuspended: the BackupSchedule is suspended.
+	ReasonSuspended = "Suspended"
+
+	// ReasonPruned: Event reason used when retention deleted a Backup.
+	ReasonPruned = "Pruned"
+
+	// ReasonRestorePending: the Restore waits for its Backup, Database or owner.
+	ReasonRestorePending = "RestorePending"
+
+	// ReasonRestoreRunning: the restore Job is running.
+	ReasonRestoreRunning = "RestoreRunning"
+
+	// ReasonRestoreCompleted: the dump was restored.
+	ReasonRestoreCompleted = "RestoreCompleted"
+
+	// ReasonRestoreFailed: the restore failed.
+	ReasonRestoreFailed = "RestoreFailed"
+
+	// ReasonHardened: the restrictions of the hardening profile are in place.
+	ReasonHardened = "Hardened"
+
+	// ReasonHardeningViolated: the database is less restricted than its
+	// hardening profile requires.
+	ReasonHardeningViolated = "HardeningViolated"
+
+	// ReasonMigrated: all migrations of the source are applied.
+	ReasonMigrated = "Migrated"
+
+	// ReasonMigrationPending: the Migration waits for its Database, migrator
+	// User or source.
+	ReasonMigrationPending = "MigrationPending"
+
+	// ReasonFetchingMigrations: a Job copies the files of an image source.
+	ReasonFetchingMigrations = "FetchingMigrations"
+)
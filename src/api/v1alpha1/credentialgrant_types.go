@@ -0,0 +1,117 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// CredentialGrantFrom identifies resources that are allowed to reference
+// Secrets in the grant's namespace.
+type CredentialGrantFrom struct {
+	// Kind of the referencing resource.
+	// Allowed values: Database, User.
+	Kind string `json:"kind"`
+
+	// Namespace of the referencing resource.
+	Namespace string `json:"namespace"`
+}
+
+// CredentialGrantTo identifies Secrets in the grant's namespace that may be referenced.
+type CredentialGrantTo struct {
+	// Name of the Secret. If empty, every Secret in the namespace may be referenced.
+	Name string `json:"name,omitempty"`
+}
+
+// CredentialGrantSpec defines which namespaces/kinds may reference which
+// Secrets in the namespace of the CredentialGrant.
+type CredentialGrantSpec struct {
+	// Resources that are allowed to reference Secrets in this namespace.
+	From []CredentialGrantFrom `json:"from"`
+
+	// Secrets that may be referenced.
+	To []CredentialGrantTo `json:"to"`
+}
+
+// +kubebuilder:object:root=true
+
+// CredentialGrant permits Databases and Users in other namespaces to reference
+// admin credential Secrets in its own namespace. It is modelled on the Gateway
+// API ReferenceGrant: a grant must live in the namespace of the Secret.
+type CredentialGrant struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec CredentialGrantSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// CredentialGrantList contains a list of CredentialGrant.
+type CredentialGrantList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CredentialGrant `json:"items"`
+}
+
+// Permits reports whether the grant allows a resource of the given kind in
+// fromNamespace to reference the named Secret.
+func (g *CredentialGrant) Permits(kind, fromNamespace, secretName string) bool {
+	fromOK := false
+	for _, f := range g.Spec.From {
+		if f.Kind == kind && f.Namespace == fromNamespace {
+			fromOK = true
+			break
+		}
+	}
+	if !fromOK {
+		return false
+	}
+	for _, t := range g.Spec.To {
+		if t.Name == "" || t.Name == secretName {
+			return true
+		}
+	}
+	return false
+}
+
+// DeepCopyObject implements runtime.Object for CredentialGrant.
+func (in *CredentialGrant) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialGrant)
+	*out = *in
+
+	out.ObjectMeta = *in.ObjectMeta.DeepCopy()
+
+	if in.Spec.From != nil {
+		out.Spec.From = make([]CredentialGrantFrom, len(in.Spec.From))
+		copy(out.Spec.From, in.Spec.From)
+	}
+	if in.Spec.To != nil {
+		out.Spec.To = make([]CredentialGrantTo, len(in.Spec.To))
+		copy(out.Spec.To, in.Spec.To)
+	}
+
+	return out
+}
+
+// DeepCopyObject implements runtime.Object for CredentialGrantList.
+func (in *CredentialGrantList) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := new(CredentialGrantList)
+	*out = *in
+
+	out.ListMeta = *in.ListMeta.DeepCopy()
+
+	if in.Items != nil {
+		out.Items = make([]CredentialGrant, len(in.Items))
+		for i := range in.Items {
+			out.Items[i] = *in.Items[i].DeepCopyObject().(*CredentialGrant)
+		}
+	}
+
+	return out
+}
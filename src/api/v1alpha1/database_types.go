@@ -19,9 +19,13 @@ var SchemeGroupVersion = schema.GroupVersion{
 }
 
 type SecretRef struct {
-	// Name of the Secret in the same namespace as the Database resource
+	// Name of the Secret
 	Name string `json:"name"`
 
+	// Namespace of the Secret (optional, defaults to the Database's namespace if empty).
+	// Referencing another namespace requires a CredentialGrant in that namespace.
+	Namespace string `json:"namespace,omitempty"`
+
 	// Key in the Secret data that contains the admin username
 	UserKey string `json:"userKey"`
 
@@ -29,13 +33,51 @@ type SecretRef struct {
 	PasswordKey string `json:"passwordKey"`
 }
 
+// VaultRef references admin credentials stored in a HashiCorp Vault KV v2 secret.
+type VaultRef struct {
+	// Path of the KV v2 secret including its mount, e.g. "secret/platform/rds-admin".
+	Path string `json:"path"`
+
+	// Key in the Vault secret that contains the admin username (defaults to "username")
+	UserKey string `json:"userKey,omitempty"`
+
+	// Key in the Vault secret that contains the admin password (defaults to "password")
+	PasswordKey string `json:"passwordKey,omitempty"`
+}
+
+// SecretKeySelector selects a single key of a Secret in the resource's namespace.
+type SecretKeySelector struct {
+	// Name of the Secret
+	Name string `json:"name"`
+
+	// Key in the Secret data (defaults to "ca.crt")
+	Key string `json:"key,omitempty"`
+}
+
+// ClientCertSecretRef references a client certificate and key stored in a
+// Secret in the resource's namespace (e.g. a kubernetes.io/tls Secret).
+type ClientCertSecretRef struct {
+	// Name of the Secret
+	Name string `json:"name"`
+
+	// Key holding the PEM client certificate (defaults to "tls.crt")
+	CertKey string `json:"certKey,omitempty"`
+
+	// Key holding the PEM private key (defaults to "tls.key")
+	KeyKey string `json:"keyKey,omitempty"`
+}
+
 // DatabaseSpec: desired state of the Database CR
 type DatabaseSpec struct {
-	// Hostname or IP address of the target database server
-	Host string `json:"host"`
+	// Hostname or IP address of the target database server (unused with placement)
+	Host string `json:"host,omitempty"`
 
-	// Port number of the target database server (e.g., 5432)
-	Port int32 `json:"port"`
+	// Port number of the target database server, e.g. 5432 (unused with placement)
+	Port int32 `json:"port,omitempty"`
+
+	// Placement picks the server from a pool instead of Host/Port. The
+	// choice is made once, pinned in status.server and never changed.
+	Placement *Placement `json:"placement,omitempty"`
 
 	// Admin user with permissions to create databases (optional if adminSecretRef is used)
 	AdminUser string `json:"adminUser,omitempty"`
@@ -50,12 +92,160 @@ type DatabaseSpec struct {
 	// If set, this takes precedence over AdminUser/AdminPassword fields.
 	AdminSecretRef *SecretRef `json:"adminSecretRef,omitempty"`
 
+	// Reference to admin credentials stored in Vault.
+	// If set, this takes precedence over AdminSecretRef and AdminUser/AdminPassword.
+	AdminVaultRef *VaultRef `json:"adminVaultRef,omitempty"`
+
 	// SSLMode controls how the operator connects to the DB server.
 	// Example values (Postgres-style): "disable", "require", "verify-ca", "verify-full".
-	// If omitted, a sensible default is used by the service layer.
+	// If omitted, "require" is used.
 	SSLMode string `json:"sslMode,omitempty"`
+
+	// Secret key holding the PEM CA bundle used to verify the server certificate
+	// (needed for verify-ca/verify-full against private CAs or RDS).
+	SSLRootCertSecretRef *SecretKeySelector `json:"sslRootCertSecretRef,omitempty"`
+
+	// Secret holding a client certificate and key for certificate authentication.
+	SSLClientCertSecretRef *ClientCertSecretRef `json:"sslClientCertSecretRef,omitempty"`
+
+	// DriftPolicy controls what the periodic resync does when the database
+	// no longer exists on the server: Repair (default) or Report.
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+
+	// Adoption allows taking over a database that already exists on the
+	// server. Without it the operator refuses to touch databases it did not create.
+	Adoption *Adoption `json:"adoption,omitempty"`
+
+	// DryRun makes the operator record the statements it would execute in
+	// status.plan instead of running them. Passwords are redacted.
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// Extensions to create inside the database (CREATE EXTENSION IF NOT EXISTS).
+	// Removing an entry does not drop the extension.
+	Extensions []string `json:"extensions,omitempty"`
+
+	// Lease (ttl or expiresAt) makes the Database ephemeral: it is deleted
+	// once the lease expires.
+	Lease `json:",inline"`
+
+	// DeletionPolicy decides whether deleting the resource drops the
+	// database: Retain (default) or Delete. Unmanaged databases are never dropped.
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
+	// Source seeds the new database with a copy of another managed
+	// Database: with CREATE DATABASE ... TEMPLATE on the same server,
+	// or with pg_dump/pg_restore in a Job across servers.
+	Source *DatabaseSource `json:"source,omitempty"`
+
+	// InitSQL runs SQL scripts from ConfigMaps or Secrets once the database
+	// is created. Their checksum is recorded in status.initSQL.
+	InitSQL *InitSQL `json:"initSQL,omitempty"`
+
+	// Hardening restricts what PUBLIC may do in the database and verifies
+	// it on every resync. Defaults to the operator's --hardening-profile.
+	Hardening *Hardening `json:"hardening,omitempty"`
+}
+
+// Adoption controls whether an existing, unmanaged database object may be
+// taken over and marked as managed by the operator.
+type Adoption struct {
+	// Enabled allows taking over the existing object.
+	Enabled bool `json:"enabled"`
+}
+
+// HardeningProfile selects the security restrictions of a database.
+type HardeningProfile string
+
+const (
+	// HardeningNone keeps the PostgreSQL defaults.
+	HardeningNone HardeningProfile = "None"
+
+	// HardeningRestricted revokes CONNECT and TEMPORARY on the database and
+	// CREATE on schema public from PUBLIC, and sets the owner of both.
+	HardeningRestricted HardeningProfile = "Restricted"
+)
+
+// Hardening configures the security restrictions of a database.
+type Hardening struct {
+	// Profile: None or Restricted (default: the operator's --hardening-profile).
+	Profile HardeningProfile `json:"profile,omitempty"`
+
+	// Owner is the role owning the database and schema public (default:
+	// the admin user).
+	Owner string `json:"owner,omitempty"`
+}
+
+// PlacementStrategy decides which server of a pool receives a new database.
+type PlacementStrategy string
+
+const (
+	// PlacementLeastDatabases picks the server hosting the fewest databases.
+	PlacementLeastDatabases PlacementStrategy = "LeastDatabases"
+
+	// PlacementLeastSize picks the server whose databases use the least disk.
+	PlacementLeastSize PlacementStrategy = "LeastSize"
+
+	// PlacementRoundRobin cycles through the servers in list order.
+	PlacementRoundRobin PlacementStrategy = "RoundRobin"
+
+	// PlacementLabelAffinity picks the first server, in list order, whose
+	// labels match serverSelector.
+	PlacementLabelAffinity PlacementStrategy = "LabelAffinity"
+)
+
+// Placement describes a pool of servers sharing the admin credentials of
+// the spec and how one of them is picked.
+type Placement struct {
+	// Servers of the pool.
+	Servers []PoolServer `json:"servers"`
+
+	// Strategy used to pick a server (default LeastDatabases).
+	Strategy PlacementStrategy `json:"strategy,omitempty"`
+
+	// ServerSelector limits the candidates to servers carrying all of these
+	// labels. Required by the LabelAffinity strategy.
+	ServerSelector map[string]string `json:"serverSelector,omitempty"`
 }
 
+// PoolServer is a server of a placement pool.
+type PoolServer struct {
+	// Hostname or IP address of the server
+	Host string `json:"host"`
+
+	// Port of the server (e.g. 5432)
+	Port int32 `json:"port"`
+
+	// Labels matched by serverSelector.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// Matches reports whether the server carries every label of selector.
+func (s *PoolServer) Matches(selector map[string]string) bool {
+	for k, v := range selector {
+		if s.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ServerRef identifies the server a database was placed on.
+type ServerRef struct {
+	Host string `json:"host"`
+	Port int32  `json:"port"`
+}
+
+// DriftPolicy controls how drift found during a resync is handled.
+type DriftPolicy string
+
+const (
+	// DriftPolicyRepair re-applies the spec when drift is found.
+	DriftPolicyRepair DriftPolicy = "Repair"
+
+	// DriftPolicyReport only reports drift through the Drifted condition and an Event.
+	DriftPolicyReport DriftPolicy = "Report"
+)
+
 // DatabaseStatus: observed state updated by the operator
 type DatabaseStatus struct {
 	// Whether the database has been successfully created
@@ -66,6 +256,27 @@ type DatabaseStatus struct {
 
 	// Last time the resource was reconciled (RFC3339 format)
 	UpdatedAt string `json:"updatedAt,omitempty"`
+
+	// Value of the reconcile-requested-at annotation handled by the last reconcile.
+	LastHandledReconcileAt string `json:"lastHandledReconcileAt,omitempty"`
+
+	// Standard conditions (Ready, Paused). On failure the reason is the error category.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Statements the last dry run would have executed (passwords redacted).
+	Plan []string `json:"plan,omitempty"`
+
+	// Server picked by spec.placement. It is never changed once set.
+	Server *ServerRef `json:"server,omitempty"`
+
+	// Lease is the state of spec.ttl/spec.expiresAt.
+	Lease *LeaseStatus `json:"lease,omitempty"`
+
+	// Source is the progress of the copy from spec.source.
+	Source *SourceStatus `json:"source,omitempty"`
+
+	// InitSQL records the spec.initSQL scripts that ran.
+	InitSQL *InitSQLStatus `json:"initSQL,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -88,6 +299,18 @@ type DatabaseList struct {
 	Items []Database `json:"items"`
 }
 
+// Server returns the server hosting the database: the pinned placement
+// choice, or spec.host/spec.port. It is empty while a placement is pending.
+func (in *Database) Server() (string, int32) {
+	if in.Spec.Placement != nil {
+		if in.Status.Server == nil {
+			return "", 0
+		}
+		return in.Status.Server.Host, in.Status.Server.Port
+	}
+	return in.Spec.Host, in.Spec.Port
+}
+
 // DeepCopyObject implements runtime.Object for Database
 func (in *Database) DeepCopyObject() runtime.Object {
 	if in == nil {
@@ -100,9 +323,80 @@ func (in *Database) DeepCopyObject() runtime.Object {
 	// deep copy ObjectMeta (it has its own DeepCopy)
 	out.ObjectMeta = *in.ObjectMeta.DeepCopy()
 
+	// deep copy status slices
+	if in.Status.Conditions != nil {
+		out.Status.Conditions = make([]metav1.Condition, len(in.Status.Conditions))
+		copy(out.Status.Conditions, in.Status.Conditions)
+	}
+	if in.Status.Plan != nil {
+		out.Status.Plan = make([]string, len(in.Status.Plan))
+		copy(out.Status.Plan, in.Status.Plan)
+	}
+	if in.Status.Server != nil {
+		server := *in.Status.Server
+		out.Status.Server = &server
+	}
+	out.Status.Lease = in.Status.Lease.DeepCopy()
+	out.Status.Source = in.Status.Source.DeepCopy()
+	out.Status.InitSQL = in.Status.InitSQL.DeepCopy()
+
+	// deep copy pointer fields in Spec
+	if in.Spec.AdminSecretRef != nil {
+		ref := *in.Spec.AdminSecretRef
+		out.Spec.AdminSecretRef = &ref
+	}
+	if in.Spec.AdminVaultRef != nil {
+		ref := *in.Spec.AdminVaultRef
+		out.Spec.AdminVaultRef = &ref
+	}
+	if in.Spec.SSLRootCertSecretRef != nil {
+		ref := *in.Spec.SSLRootCertSecretRef
+		out.Spec.SSLRootCertSecretRef = &ref
+	}
+	if in.Spec.SSLClientCertSecretRef != nil {
+		ref := *in.Spec.SSLClientCertSecretRef
+		out.Spec.SSLClientCertSecretRef = &ref
+	}
+	if in.Spec.Adoption != nil {
+		adoption := *in.Spec.Adoption
+		out.Spec.Adoption = &adoption
+	}
+	if in.Spec.Extensions != nil {
+		out.Spec.Extensions = make([]string, len(in.Spec.Extensions))
+		copy(out.Spec.Extensions, in.Spec.Extensions)
+	}
+	out.Spec.Placement = in.Spec.Placement.DeepCopy()
+	out.Spec.Lease = in.Spec.Lease.DeepCopy()
+	if in.Spec.Source != nil {
+		source := *in.Spec.Source
+		out.Spec.Source = &source
+	}
+	out.Spec.InitSQL = in.Spec.InitSQL.DeepCopy()
+	if in.Spec.Hardening != nil {
+		hardening := *in.Spec.Hardening
+		out.Spec.Hardening = &hardening
+	}
+
 	return out
 }
 
+// DeepCopy returns a deep copy of the placement.
+func (in *Placement) DeepCopy() *Placement {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	if in.Servers != nil {
+		out.Servers = make([]PoolServer, len(in.Servers))
+		for i := range in.Servers {
+			out.Servers[i] = in.Servers[i]
+			out.Servers[i].Labels = copyStringMap(in.Servers[i].Labels)
+		}
+	}
+	out.ServerSelector = copyStringMap(in.ServerSelector)
+	return &out
+}
+
 // DeepCopyObject implements runtime.Object for DatabaseList
 func (in *DatabaseList) DeepCopyObject() runtime.Object {
 	if in == nil {
@@ -133,6 +427,20 @@ func AddToScheme(scheme *runtime.Scheme) error {
 		&DatabaseList{},
 		&User{},
 		&UserList{},
+		&CredentialGrant{},
+		&CredentialGrantList{},
+		&DatabaseClass{},
+		&DatabaseClassList{},
+		&DatabaseClaim{},
+		&DatabaseClaimList{},
+		&Backup{},
+		&BackupList{},
+		&BackupSchedule{},
+		&BackupScheduleList{},
+		&Restore{},
+		&RestoreList{},
+		&Migration{},
+		&MigrationList{},
 	)
 
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
@@ -0,0 +1,146 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// DatabaseClaimSpec defines the desired state of a DatabaseClaim.
+type DatabaseClaimSpec struct {
+	// ClassName of the DatabaseClass to provision from. If empty, the class
+	// annotated as default is used. The class is fixed once the claim is bound.
+	ClassName string `json:"className,omitempty"`
+
+	// SecretName of the Secret receiving the owner credentials together
+	// with host, port, database and sslMode (defaults to <name>-credentials).
+	SecretName string `json:"secretName,omitempty"`
+
+	// Lease (ttl or expiresAt) makes the claim ephemeral: it is deleted once
+	// the lease expires, and its Database and User with it.
+	Lease `json:",inline"`
+}
+
+// ClaimPhase is the lifecycle phase of a DatabaseClaim.
+type ClaimPhase string
+
+const (
+	// ClaimPending: the Database or User is not ready yet.
+	ClaimPending ClaimPhase = "Pending"
+
+	// ClaimBound: the database, its owner role and the Secret exist.
+	ClaimBound ClaimPhase = "Bound"
+
+	// ClaimFailed: the claim cannot be provisioned until it or its class changes.
+	ClaimFailed ClaimPhase = "Failed"
+)
+
+// ClaimedObject identifies a Database or User created for a claim. The UID
+// distinguishes it from objects created by others under the same name.
+type ClaimedObject struct {
+	Name string    `json:"name"`
+	UID  types.UID `json:"uid"`
+}
+
+// DatabaseClaimStatus defines the observed state of a DatabaseClaim.
+type DatabaseClaimStatus struct {
+	// Phase of the claim: Pending, Bound or Failed.
+	Phase ClaimPhase `json:"phase,omitempty"`
+
+	// ClassName the claim is bound to.
+	ClassName string `json:"className,omitempty"`
+
+	// DatabaseName on the server, rendered from the class's nameTemplate.
+	DatabaseName string `json:"databaseName,omitempty"`
+
+	// Username of the owner role.
+	Username string `json:"username,omitempty"`
+
+	// SecretName of the Secret holding the credentials.
+	SecretName string `json:"secretName,omitempty"`
+
+	// Database created for the claim.
+	Database *ClaimedObject `json:"database,omitempty"`
+
+	// User created for the claim.
+	User *ClaimedObject `json:"user,omitempty"`
+
+	// Last time the resource was reconciled (RFC3339 format).
+	UpdatedAt string `json:"updatedAt,omitempty"`
+
+	// Standard conditions (Ready).
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Lease is the state of spec.ttl/spec.expiresAt.
+	Lease *LeaseStatus `json:"lease,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DatabaseClaim requests a database with an owner role from a DatabaseClass,
+// like a PersistentVolumeClaim requests storage from a StorageClass. The
+// operator creates a Database and a User of the same name for it.
+type DatabaseClaim struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   DatabaseClaimSpec   `json:"spec,omitempty"`
+	Status DatabaseClaimStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DatabaseClaimList contains a list of DatabaseClaim.
+type DatabaseClaimList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DatabaseClaim `json:"items"`
+}
+
+// DeepCopyObject implements runtime.Object for DatabaseClaim.
+func (in *DatabaseClaim) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseClaim)
+	*out = *in
+
+	out.ObjectMeta = *in.ObjectMeta.DeepCopy()
+
+	if in.Status.Database != nil {
+		ref := *in.Status.Database
+		out.Status.Database = &ref
+	}
+	if in.Status.User != nil {
+		ref := *in.Status.User
+		out.Status.User = &ref
+	}
+	if in.Status.Conditions != nil {
+		out.Status.Conditions = make([]metav1.Condition, len(in.Status.Conditions))
+		copy(out.Status.Conditions, in.Status.Conditions)
+	}
+	out.Status.Lease = in.Status.Lease.DeepCopy()
+	out.Spec.Lease = in.Spec.Lease.DeepCopy()
+
+	return out
+}
+
+// DeepCopyObject implements runtime.Object for DatabaseClaimList.
+func (in *DatabaseClaimList) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseClaimList)
+	*out = *in
+
+	out.ListMeta = *in.ListMeta.DeepCopy()
+
+	if in.Items != nil {
+		out.Items = make([]DatabaseClaim, len(in.Items))
+		for i := range in.Items {
+			out.Items[i] = *in.Items[i].DeepCopyObject().(*DatabaseClaim)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,150 @@
+package v1alpha1
+
+import (
+	"slices"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DefaultClaimNameTemplate names the database of a claim when the class does
+// not set nameTemplate.
+const DefaultClaimNameTemplate = "{{ .Namespace }}_{{ .Name }}"
+
+// DatabaseClassSpec describes a database server (or a pool of servers) and
+// the defaults used for every DatabaseClaim of the class.
+type DatabaseClassSpec struct {
+	// Hostname or IP address of the database server (unused with placement).
+	Host string `json:"host,omitempty"`
+
+	// Port of the database server, e.g. 5432 (unused with placement).
+	Port int32 `json:"port,omitempty"`
+
+	// Placement picks the server of every claimed database from a pool
+	// instead of Host/Port.
+	Placement *Placement `json:"placement,omitempty"`
+
+	// Reference to a Secret containing admin credentials. An empty namespace
+	// means the namespace of the claim. Databases and Users created for
+	// claims of this class may reference it without a CredentialGrant.
+	AdminSecretRef *SecretRef `json:"adminSecretRef,omitempty"`
+
+	// Reference to admin credentials stored in Vault.
+	// If set, this takes precedence over AdminSecretRef.
+	AdminVaultRef *VaultRef `json:"adminVaultRef,omitempty"`
+
+	// SSL mode used by the operator and written to the claim's Secret.
+	SSLMode string `json:"sslMode,omitempty"`
+
+	// DriftPolicy of the created Database and User.
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+
+	// Extensions created in every database of the class.
+	Extensions []string `json:"extensions,omitempty"`
+
+	// NameTemplate is a Go template rendering the database name from the
+	// claim's .Namespace, .Name and .ClassName. Hyphens in the result become
+	// underscores and add a short hash of the result as suffix, so distinct
+	// results stay distinct. The owner role is named <database>_owner.
+	// Defaults to "{{ .Namespace }}_{{ .Name }}".
+	NameTemplate string `json:"nameTemplate,omitempty"`
+
+	// AllowedNamespaces limits the namespaces that may claim databases of
+	// this class. Empty allows every namespace.
+	AllowedNamespaces []string `json:"allowedNamespaces,omitempty"`
+
+	// PasswordPolicy of the owner role, refining the operator-wide policy.
+	PasswordPolicy *PasswordPolicy `json:"passwordPolicy,omitempty"`
+
+	// PasswordEncryption of the owner role (scram-sha-256 or md5).
+	PasswordEncryption string `json:"passwordEncryption,omitempty"`
+
+	// DeletionPolicy of the created Database and User. With Delete, deleting
+	// a claim drops its database and owner role.
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DatabaseClass is a cluster-scoped template for DatabaseClaims, modelled on
+// StorageClass: platform teams describe a server once and developers claim
+// databases on it without knowing its address or credentials.
+type DatabaseClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec DatabaseClassSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// DatabaseClassList contains a list of DatabaseClass.
+type DatabaseClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []DatabaseClass `json:"items"`
+}
+
+// AllowsNamespace reports whether claims in namespace may use the class.
+func (c *DatabaseClass) AllowsNamespace(namespace string) bool {
+	return len(c.Spec.AllowedNamespaces) == 0 || slices.Contains(c.Spec.AllowedNamespaces, namespace)
+}
+
+// IsDefault reports whether the class carries the default-class annotation.
+func (c *DatabaseClass) IsDefault() bool {
+	return c.GetAnnotations()[AnnotationDefaultClass] == "true"
+}
+
+// DeepCopyObject implements runtime.Object for DatabaseClass.
+func (in *DatabaseClass) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseClass)
+	*out = *in
+
+	out.ObjectMeta = *in.ObjectMeta.DeepCopy()
+
+	if in.Spec.AdminSecretRef != nil {
+		ref := *in.Spec.AdminSecretRef
+		out.Spec.AdminSecretRef = &ref
+	}
+	if in.Spec.AdminVaultRef != nil {
+		ref := *in.Spec.AdminVaultRef
+		out.Spec.AdminVaultRef = &ref
+	}
+	if in.Spec.Extensions != nil {
+		out.Spec.Extensions = make([]string, len(in.Spec.Extensions))
+		copy(out.Spec.Extensions, in.Spec.Extensions)
+	}
+	if in.Spec.AllowedNamespaces != nil {
+		out.Spec.AllowedNamespaces = make([]string, len(in.Spec.AllowedNamespaces))
+		copy(out.Spec.AllowedNamespaces, in.Spec.AllowedNamespaces)
+	}
+	if in.Spec.PasswordPolicy != nil {
+		out.Spec.PasswordPolicy = in.Spec.PasswordPolicy.DeepCopy()
+	}
+	out.Spec.Placement = in.Spec.Placement.DeepCopy()
+
+	return out
+}
+
+// DeepCopyObject implements runtime.Object for DatabaseClassList.
+func (in *DatabaseClassList) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseClassList)
+	*out = *in
+
+	out.ListMeta = *in.ListMeta.DeepCopy()
+
+	if in.Items != nil {
+		out.Items = make([]DatabaseClass, len(in.Items))
+		for i := range in.Items {
+			out.Items[i] = *in.Items[i].DeepCopyObject().(*DatabaseClass)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,74 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// InitSQL bootstraps a new database with SQL scripts, e.g. to create
+// schemas or insert reference rows.
+type InitSQL struct {
+	// Scripts run in order, all in one transaction, once the database is
+	// created (or copied from spec.source).
+	Scripts []InitSQLScript `json:"scripts"`
+
+	// RerunOnChange runs the scripts again when their checksum changes.
+	// Otherwise they run once and later edits are ignored.
+	RerunOnChange bool `json:"rerunOnChange,omitempty"`
+}
+
+// InitSQLScript selects a key holding SQL. Exactly one field must be set.
+type InitSQLScript struct {
+	// ConfigMapKeyRef selects a key of a ConfigMap in the same namespace.
+	ConfigMapKeyRef *KeySelector `json:"configMapKeyRef,omitempty"`
+
+	// SecretKeyRef selects a key of a Secret in the same namespace, for
+	// scripts containing credentials.
+	SecretKeyRef *KeySelector `json:"secretKeyRef,omitempty"`
+}
+
+// KeySelector selects a key of a ConfigMap or Secret.
+type KeySelector struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// InitSQLStatus records the scripts of spec.initSQL that ran.
+type InitSQLStatus struct {
+	// Checksum of the scripts that ran (sha256:<hex>).
+	Checksum string `json:"checksum"`
+
+	// AppliedAt is when they ran.
+	AppliedAt *metav1.Time `json:"appliedAt,omitempty"`
+}
+
+// DeepCopy returns a deep copy of the init SQL spec.
+func (in *InitSQL) DeepCopy() *InitSQL {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	if in.Scripts != nil {
+		out.Scripts = make([]InitSQLScript, len(in.Scripts))
+		for i, script := range in.Scripts {
+			if script.ConfigMapKeyRef != nil {
+				ref := *script.ConfigMapKeyRef
+				out.Scripts[i].ConfigMapKeyRef = &ref
+			}
+			if script.SecretKeyRef != nil {
+				ref := *script.SecretKeyRef
+				out.Scripts[i].SecretKeyRef = &ref
+			}
+		}
+	}
+	return &out
+}
+
+// DeepCopy returns a deep copy of the init SQL status.
+func (in *InitSQLStatus) DeepCopy() *InitSQLStatus {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	out.AppliedAt = in.AppliedAt.DeepCopy()
+	return &out
+}
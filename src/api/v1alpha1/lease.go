@@ -0,0 +1,82 @@
+package v1alpha1
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Lease limits the lifetime of a Database or DatabaseClaim, e.g. for preview
+// environments. Once it expires the resource is deleted; its deletionPolicy
+// decides whether the database goes with it.
+type Lease struct {
+	// TTL after creation of the resource, e.g. "72h".
+	TTL *metav1.Duration `json:"ttl,omitempty"`
+
+	// ExpiresAt is an absolute expiry time. It takes precedence over TTL.
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+}
+
+// Expiry returns when a lease created at created expires, or nil if it has
+// neither TTL nor ExpiresAt.
+func (l Lease) Expiry(created time.Time) *time.Time {
+	switch {
+	case l.ExpiresAt != nil:
+		t := l.ExpiresAt.Time
+		return &t
+	case l.TTL != nil:
+		t := created.Add(l.TTL.Duration)
+		return &t
+	default:
+		return nil
+	}
+}
+
+// DeepCopy returns a deep copy of the lease.
+func (l Lease) DeepCopy() Lease {
+	out := l
+	if l.TTL != nil {
+		ttl := *l.TTL
+		out.TTL = &ttl
+	}
+	out.ExpiresAt = l.ExpiresAt.DeepCopy()
+	return out
+}
+
+// LeaseStatus is the observed state of a Lease.
+type LeaseStatus struct {
+	// ExpiresAt is the effective expiry, including extensions.
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+
+	// ExtendedUntil is set by the extend-lease annotation. The lease does
+	// not expire before it.
+	ExtendedUntil *metav1.Time `json:"extendedUntil,omitempty"`
+
+	// WarnedFor is the expiry the ExpiringSoon warning was emitted for.
+	WarnedFor *metav1.Time `json:"warnedFor,omitempty"`
+}
+
+// DeepCopy returns a deep copy of the lease status.
+func (in *LeaseStatus) DeepCopy() *LeaseStatus {
+	if in == nil {
+		return nil
+	}
+	return &LeaseStatus{
+		ExpiresAt:     in.ExpiresAt.DeepCopy(),
+		ExtendedUntil: in.ExtendedUntil.DeepCopy(),
+		WarnedFor:     in.WarnedFor.DeepCopy(),
+	}
+}
+
+// DeletionPolicy controls what happens on the server when a Database or
+// User resource is deleted.
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyRetain leaves the database or role on the server.
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+
+	// DeletionPolicyDelete drops the database or role, if the operator
+	// manages it.
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+)
@@ -0,0 +1,62 @@
+package v1alpha1
+
+// Well-known labels set by the operator on objects it creates.
+const (
+	// LabelManagedBy marks objects created by the operator.
+	LabelManagedBy = "app.kubernetes.io/managed-by"
+
+	// ManagedByValue is the value of LabelManagedBy on operator-created objects.
+	ManagedByValue = "orchestrdb"
+
+	// LabelOwnerKind records the kind of the custom resource that owns an object.
+	// Used for objects that cannot carry an owner reference (e.g. cross-namespace Secrets).
+	LabelOwnerKind = GroupName + "/owner-kind"
+
+	// LabelOwnerName records the name of the owning custom resource.
+	LabelOwnerName = GroupName + "/owner-name"
+
+	// LabelOwnerNamespace records the namespace of the owning custom resource.
+	LabelOwnerNamespace = GroupName + "/owner-namespace"
+)
+
+// Annotations users can set on Database and User resources.
+const (
+	// AnnotationPaused set to "true" makes the operator skip the resource
+	// entirely (no connections to the server) and report a Paused condition.
+	AnnotationPaused = GroupName + "/paused"
+
+	// AnnotationReconcileRequestedAt triggers a fresh reconcile whenever its
+	// value changes (e.g. set it to the current timestamp). The handled value
+	// is echoed in status.lastHandledReconcileAt.
+	AnnotationReconcileRequestedAt = GroupName + "/reconcile-requested-at"
+
+	// AnnotationDiscoveredMemberOf is set by `orchestrdb discover` on User
+	// manifests and lists the roles the discovered role is a member of.
+	// It is informational only.
+	AnnotationDiscoveredMemberOf = GroupName + "/discovered-member-of"
+
+	// AnnotationDefaultClass set to "true" on a DatabaseClass makes it the
+	// class of DatabaseClaims that do not name one.
+	AnnotationDefaultClass = GroupName + "/is-default-class"
+
+	// AnnotationExtendLease set to a duration (e.g. "24h") on a Database or
+	// DatabaseClaim with a lease keeps it alive for that long from now. The
+	// operator removes the annotation once applied.
+	AnnotationExtendLease = GroupName + "/extend-lease"
+)
+
+// FinalizerCleanup is set on Databases, Users and Backups with
+// deletionPolicy Delete until the database, role or dump has been removed.
+const FinalizerCleanup = GroupName + "/cleanup"
+
+// copyStringMap returns a copy of the given map (nil stays nil).
+func copyStringMap(in map[string]string) map[string]string {
+	if in == nil {
+		return nil
+	}
+	out := make(map[string]string, len(in))
+	for k, v := range in {
+		out[k] = v
+	}
+	return out
+}
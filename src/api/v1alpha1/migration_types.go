@@ -0,0 +1,178 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DefaultMigrationTable is the tracking table used when spec.trackingTable is empty.
+const DefaultMigrationTable = "schema_migrations"
+
+// MigrationSpec defines the desired state of a Migration.
+type MigrationSpec struct {
+	// DatabaseRef names the Database resource migrated, in the same
+	// namespace. Migrations wait until it is created.
+	DatabaseRef DatabaseReference `json:"databaseRef"`
+
+	// Source of the migration files. Files are named <version>_<name>.sql
+	// and applied in the order of their numeric version.
+	Source MigrationSource `json:"source"`
+
+	// MigratorRef names the User resource whose role runs the migrations
+	// (SET ROLE) and owns the objects they create and the tracking table.
+	MigratorRef UserReference `json:"migratorRef"`
+
+	// TrackingTable records the applied migrations, optionally
+	// schema-qualified (default schema_migrations).
+	TrackingTable string `json:"trackingTable,omitempty"`
+}
+
+// MigrationSource is where migration files are read from. Exactly one
+// field must be set.
+type MigrationSource struct {
+	// ConfigMap whose keys ending in .sql are the migration files.
+	ConfigMap *MigrationFilesSource `json:"configMap,omitempty"`
+
+	// Secret whose keys ending in .sql are the migration files.
+	Secret *MigrationFilesSource `json:"secret,omitempty"`
+
+	// Archive is a tar (optionally gzipped) archive of migration files in
+	// a ConfigMap key, usually binaryData.
+	Archive *MigrationArchiveSource `json:"archive,omitempty"`
+
+	// Image is a container image containing the migration files. A Job
+	// copies them out, so the image needs sh and cp.
+	Image *MigrationImageSource `json:"image,omitempty"`
+}
+
+// MigrationFilesSource names a ConfigMap or Secret in the same namespace.
+type MigrationFilesSource struct {
+	Name string `json:"name"`
+}
+
+// MigrationArchiveSource selects a key of a ConfigMap in the same namespace.
+type MigrationArchiveSource struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// MigrationImageSource is a directory of a container image.
+type MigrationImageSource struct {
+	Image string `json:"image"`
+
+	// Path of the directory with the migration files (default /migrations).
+	Path string `json:"path,omitempty"`
+}
+
+// MigrationStatus defines the observed state of a Migration.
+type MigrationStatus struct {
+	// AppliedVersion is the highest version recorded in the tracking table.
+	AppliedVersion int64 `json:"appliedVersion,omitempty"`
+
+	// LatestVersion is the highest version in the source.
+	LatestVersion int64 `json:"latestVersion,omitempty"`
+
+	// Checksum of the migration files last applied (or that failed).
+	Checksum string `json:"checksum,omitempty"`
+
+	// ObservedGeneration is the generation Checksum was computed for.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Job copying the files of an image source.
+	Job string `json:"job,omitempty"`
+
+	// Last time the resource was reconciled (RFC3339 format).
+	UpdatedAt string `json:"updatedAt,omitempty"`
+
+	// Value of the reconcile-requested-at annotation handled by the last
+	// reconcile. Changing the annotation applies the source again.
+	LastHandledReconcileAt string `json:"lastHandledReconcileAt,omitempty"`
+
+	// Standard conditions (Ready, Paused). On failure the reason is the error category.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Table returns the tracking table of the migration.
+func (in *Migration) Table() string {
+	if in.Spec.TrackingTable == "" {
+		return DefaultMigrationTable
+	}
+	return in.Spec.TrackingTable
+}
+
+// +kubebuilder:object:root=true
+
+// Migration applies ordered SQL migrations to a Database as a dedicated
+// migrator role and reports the applied version.
+type Migration struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MigrationSpec   `json:"spec,omitempty"`
+	Status MigrationStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// MigrationList contains a list of Migration.
+type MigrationList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Migration `json:"items"`
+}
+
+// DeepCopyObject implements runtime.Object for Migration.
+func (in *Migration) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := new(Migration)
+	*out = *in
+
+	out.ObjectMeta = *in.ObjectMeta.DeepCopy()
+
+	source := &out.Spec.Source
+	if in.Spec.Source.ConfigMap != nil {
+		ref := *in.Spec.Source.ConfigMap
+		source.ConfigMap = &ref
+	}
+	if in.Spec.Source.Secret != nil {
+		ref := *in.Spec.Source.Secret
+		source.Secret = &ref
+	}
+	if in.Spec.Source.Archive != nil {
+		ref := *in.Spec.Source.Archive
+		source.Archive = &ref
+	}
+	if in.Spec.Source.Image != nil {
+		ref := *in.Spec.Source.Image
+		source.Image = &ref
+	}
+
+	if in.Status.Conditions != nil {
+		out.Status.Conditions = make([]metav1.Condition, len(in.Status.Conditions))
+		copy(out.Status.Conditions, in.Status.Conditions)
+	}
+
+	return out
+}
+
+// DeepCopyObject implements runtime.Object for MigrationList.
+func (in *MigrationList) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := new(MigrationList)
+	*out = *in
+
+	out.ListMeta = *in.ListMeta.DeepCopy()
+
+	if in.Items != nil {
+		out.Items = make([]Migration, len(in.Items))
+		for i := range in.Items {
+			out.Items[i] = *in.Items[i].DeepCopyObject().(*Migration)
+		}
+	}
+
+	return out
+}
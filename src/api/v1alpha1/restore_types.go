@@ -0,0 +1,228 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// RestoreSpec defines the desired state of a Restore. A Restore runs once;
+// its spec is not applied again after the restore started.
+type RestoreSpec struct {
+	// BackupRef names a completed Backup in the same namespace to restore.
+	BackupRef *BackupReference `json:"backupRef,omitempty"`
+
+	// Source is a dump given by its location, used instead of BackupRef.
+	Source *RestoreSource `json:"source,omitempty"`
+
+	// DatabaseRef names the Database resource restored into, in the same
+	// namespace. The restore waits until it is created.
+	DatabaseRef DatabaseReference `json:"databaseRef"`
+
+	// OwnerRef names the User resource whose role owns the restored
+	// objects. If unset, the only User with owner access to the database,
+	// if any, is used; otherwise the objects stay with the admin user.
+	OwnerRef *UserReference `json:"ownerRef,omitempty"`
+
+	// Options of pg_restore.
+	Options RestoreOptions `json:"options,omitempty"`
+}
+
+// BackupReference refers to a Backup resource in the same namespace.
+type BackupReference struct {
+	Name string `json:"name"`
+}
+
+// UserReference refers to a User resource in the same namespace.
+type UserReference struct {
+	Name string `json:"name"`
+}
+
+// RestoreSource is a dump outside of a Backup resource, e.g. one made by
+// another cluster.
+type RestoreSource struct {
+	// URL of the dump: pvc://<claim>/<path> or s3://<bucket>/<key>, as in
+	// status.location of a Backup.
+	URL string `json:"url"`
+
+	// Format of the dump: custom (default) or directory.
+	Format BackupFormat `json:"format,omitempty"`
+
+	// Endpoint URL of an S3-compatible store (s3:// only). Empty uses AWS.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Region of the bucket (default us-east-1).
+	Region string `json:"region,omitempty"`
+
+	// ForcePathStyle addresses the bucket in the path instead of the host name.
+	ForcePathStyle bool `json:"forcePathStyle,omitempty"`
+
+	// CredentialsSecretRef names the Secret with the access keys (s3:// only).
+	CredentialsSecretRef *S3CredentialsRef `json:"credentialsSecretRef,omitempty"`
+}
+
+// RestoreOptions are passed to pg_restore.
+type RestoreOptions struct {
+	// Clean drops the objects of the dump before recreating them
+	// (--clean --if-exists), to restore into a database that has them.
+	Clean bool `json:"clean,omitempty"`
+
+	// NoOwner restores objects owned by the admin user instead of the
+	// owners recorded in the dump, which may not exist on the target
+	// (default true). OwnerRef then receives them.
+	NoOwner *bool `json:"noOwner,omitempty"`
+
+	// NoPrivileges skips the grants recorded in the dump (default true).
+	NoPrivileges *bool `json:"noPrivileges,omitempty"`
+
+	// SchemaOnly restores the object definitions without data.
+	SchemaOnly bool `json:"schemaOnly,omitempty"`
+
+	// Schemas restores only these schemas. Empty restores all.
+	Schemas []string `json:"schemas,omitempty"`
+}
+
+// RestorePhase is the progress of a Restore.
+type RestorePhase string
+
+const (
+	// RestorePending: waiting for the Backup, the Database or the owner.
+	RestorePending RestorePhase = "Pending"
+
+	// RestoreRunning: the restore Job is running or ownership is being
+	// handed to the owner role.
+	RestoreRunning RestorePhase = "Running"
+
+	// RestoreCompleted: the dump was restored.
+	RestoreCompleted RestorePhase = "Completed"
+
+	// RestoreFailed: the restore failed and is not retried. pg_restore runs
+	// in a single transaction, so the database is left as it was.
+	RestoreFailed RestorePhase = "Failed"
+)
+
+// RestoreStatus defines the observed state of a Restore.
+type RestoreStatus struct {
+	Phase RestorePhase `json:"phase,omitempty"`
+
+	// Location of the restored dump.
+	Location string `json:"location,omitempty"`
+
+	// Database is the name of the target database on its server.
+	Database string `json:"database,omitempty"`
+
+	// Owner is the role the restored objects were handed to.
+	Owner string `json:"owner,omitempty"`
+
+	// Job running pg_restore.
+	Job string `json:"job,omitempty"`
+
+	// StartedAt and CompletedAt bound the restore.
+	StartedAt   *metav1.Time `json:"startedAt,omitempty"`
+	CompletedAt *metav1.Time `json:"completedAt,omitempty"`
+
+	// Message describes the current phase; for a failed Job it ends with
+	// the last lines of the pg_restore output.
+	Message string `json:"message,omitempty"`
+
+	// Last time the resource was reconciled (RFC3339 format).
+	UpdatedAt string `json:"updatedAt,omitempty"`
+
+	// Standard conditions (Ready).
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// Finished reports whether the restore completed or failed; neither is
+// retried.
+func (in *Restore) Finished() bool {
+	return in.Status.Phase == RestoreCompleted || in.Status.Phase == RestoreFailed
+}
+
+// +kubebuilder:object:root=true
+
+// Restore runs pg_restore of a Backup (or a dump given by its location)
+// into a Database once, in a Job.
+type Restore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RestoreSpec   `json:"spec,omitempty"`
+	Status RestoreStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// RestoreList contains a list of Restore.
+type RestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Restore `json:"items"`
+}
+
+// DeepCopyObject implements runtime.Object for Restore.
+func (in *Restore) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := new(Restore)
+	*out = *in
+
+	out.ObjectMeta = *in.ObjectMeta.DeepCopy()
+
+	if in.Spec.BackupRef != nil {
+		ref := *in.Spec.BackupRef
+		out.Spec.BackupRef = &ref
+	}
+	if in.Spec.Source != nil {
+		source := *in.Spec.Source
+		if in.Spec.Source.CredentialsSecretRef != nil {
+			ref := *in.Spec.Source.CredentialsSecretRef
+			source.CredentialsSecretRef = &ref
+		}
+		out.Spec.Source = &source
+	}
+	if in.Spec.OwnerRef != nil {
+		ref := *in.Spec.OwnerRef
+		out.Spec.OwnerRef = &ref
+	}
+	if in.Spec.Options.NoOwner != nil {
+		v := *in.Spec.Options.NoOwner
+		out.Spec.Options.NoOwner = &v
+	}
+	if in.Spec.Options.NoPrivileges != nil {
+		v := *in.Spec.Options.NoPrivileges
+		out.Spec.Options.NoPrivileges = &v
+	}
+	if in.Spec.Options.Schemas != nil {
+		out.Spec.Options.Schemas = make([]string, len(in.Spec.Options.Schemas))
+		copy(out.Spec.Options.Schemas, in.Spec.Options.Schemas)
+	}
+
+	out.Status.StartedAt = in.Status.StartedAt.DeepCopy()
+	out.Status.CompletedAt = in.Status.CompletedAt.DeepCopy()
+	if in.Status.Conditions != nil {
+		out.Status.Conditions = make([]metav1.Condition, len(in.Status.Conditions))
+		copy(out.Status.Conditions, in.Status.Conditions)
+	}
+
+	return out
+}
+
+// DeepCopyObject implements runtime.Object for RestoreList.
+func (in *RestoreList) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := new(RestoreList)
+	*out = *in
+
+	out.ListMeta = *in.ListMeta.DeepCopy()
+
+	if in.Items != nil {
+		out.Items = make([]Restore, len(in.Items))
+		for i := range in.Items {
+			out.Items[i] = *in.Items[i].DeepCopyObject().(*Restore)
+		}
+	}
+
+	return out
+}
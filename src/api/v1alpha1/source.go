@@ -0,0 +1,96 @@
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DatabaseSource seeds a new database with a copy of another managed
+// Database. It is only used when the database is created.
+type DatabaseSource struct {
+	// DatabaseRef names the Database resource to copy, in the same
+	// namespace. It must have been created by the operator.
+	DatabaseRef DatabaseReference `json:"databaseRef"`
+}
+
+// DatabaseReference refers to a Database resource in the same namespace.
+type DatabaseReference struct {
+	Name string `json:"name"`
+}
+
+// CloneMethod is how a database is copied from its source.
+type CloneMethod string
+
+const (
+	// CloneMethodTemplate uses CREATE DATABASE ... TEMPLATE; the source is
+	// on the same server.
+	CloneMethodTemplate CloneMethod = "Template"
+
+	// CloneMethodDump streams pg_dump into pg_restore in a Job; the source
+	// is on another server.
+	CloneMethodDump CloneMethod = "Dump"
+)
+
+// ClonePhase is the progress of a clone.
+type ClonePhase string
+
+const (
+	// ClonePending: waiting for the source or for the copy to start.
+	ClonePending ClonePhase = "Pending"
+
+	// CloneRunning: the copy is in progress.
+	CloneRunning ClonePhase = "Running"
+
+	// CloneCompleted: the database holds the copy.
+	CloneCompleted ClonePhase = "Completed"
+
+	// CloneFailed: the copy failed and is not retried. Delete the Database
+	// to start over.
+	CloneFailed ClonePhase = "Failed"
+)
+
+// SourceStatus is the observed state of spec.source.
+type SourceStatus struct {
+	Method CloneMethod `json:"method,omitempty"`
+	Phase  ClonePhase  `json:"phase,omitempty"`
+
+	// Database is the name of the source database on its server.
+	Database string `json:"database,omitempty"`
+
+	// SnapshotTime is the point in time of the source the copy reflects.
+	SnapshotTime *metav1.Time `json:"snapshotTime,omitempty"`
+
+	// StartedAt and CompletedAt bound the copy.
+	StartedAt   *metav1.Time `json:"startedAt,omitempty"`
+	CompletedAt *metav1.Time `json:"completedAt,omitempty"`
+
+	// Job copying the database (method Dump).
+	Job string `json:"job,omitempty"`
+
+	// Message describes the current phase.
+	Message string `json:"message,omitempty"`
+}
+
+// DeepCopy returns a deep copy of the source status.
+func (in *SourceStatus) DeepCopy() *SourceStatus {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	out.SnapshotTime = in.SnapshotTime.DeepCopy()
+	out.StartedAt = in.StartedAt.DeepCopy()
+	out.CompletedAt = in.CompletedAt.DeepCopy()
+	return &out
+}
+
+// Cloning reports whether the database still has to be copied from
+// spec.source. A source added after the database was created is ignored,
+// and a failed clone is not retried.
+func (in *Database) Cloning() bool {
+	if in.Spec.Source == nil {
+		return false
+	}
+	if in.Status.Source == nil {
+		return !in.Status.Created
+	}
+	return in.Status.Source.Phase == ClonePending || in.Status.Source.Phase == CloneRunning
+}
@@ -11,7 +11,8 @@ type AdminSecretRef struct {
 	// Name of the Secret
 	Name string `json:"name"`
 
-	// Namespace of the Secret (optional, defaults to User's namespace if empty)
+	// Namespace of the Secret (optional, defaults to User's namespace if empty).
+	// Referencing another namespace requires a CredentialGrant in that namespace.
 	Namespace string `json:"namespace,omitempty"`
 
 	// Key inside the Secret for the admin username
@@ -22,13 +23,32 @@ type AdminSecretRef struct {
 }
 
 // GeneratedSecret defines where the operator writes the generated username/password.
-// The Secret MUST NOT exist before the User is created.
+// The Secret MUST NOT exist before the User is created. Once created it is owned
+// by the User (owner reference in the same namespace, status.generatedSecretUID
+// otherwise)
+// and is recreated with a fresh password if it gets deleted.
 type GeneratedSecret struct {
-	// Name of the Secret that will be created by the operator
-	Name string `json:"name"`
+	// Name of the Secret that will be created by the operator.
+	// Not used when VaultPath is set.
+	Name string `json:"name,omitempty"`
 
 	// Namespace of the Secret (optional, defaults to User's namespace if empty)
 	Namespace string `json:"namespace,omitempty"`
+
+	// VaultPath, if set, makes the operator write username/password to this
+	// Vault KV v2 path (including the mount, e.g. "secret/apps/appdb-user")
+	// instead of creating a Kubernetes Secret.
+	VaultPath string `json:"vaultPath,omitempty"`
+
+	// Extra labels to set on the generated Secret.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Extra annotations to set on the generated Secret.
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// Database, if set, adds host, port, database and sslMode to the
+	// generated credentials so applications can connect with them alone.
+	Database string `json:"database,omitempty"`
 }
 
 // UserAccessRule describes access for a single database or instance.
@@ -67,10 +87,20 @@ type UserSpec struct {
 	// If set, this takes precedence over AdminUser/AdminPassword.
 	AdminSecretRef *AdminSecretRef `json:"adminSecretRef,omitempty"`
 
+	// Reference to admin credentials stored in Vault.
+	// If set, this takes precedence over AdminSecretRef and AdminUser/AdminPassword.
+	AdminVaultRef *VaultRef `json:"adminVaultRef,omitempty"`
+
 	// SSL mode used by the operator when connecting to the server.
 	// Example values: disable, require, verify-ca, verify-full.
 	SSLMode string `json:"sslMode,omitempty"`
 
+	// Secret key holding the PEM CA bundle used to verify the server certificate.
+	SSLRootCertSecretRef *SecretKeySelector `json:"sslRootCertSecretRef,omitempty"`
+
+	// Secret holding a client certificate and key for certificate authentication.
+	SSLClientCertSecretRef *ClientCertSecretRef `json:"sslClientCertSecretRef,omitempty"`
+
 	// Database-side username to create.
 	Username string `json:"username"`
 
@@ -81,6 +111,85 @@ type UserSpec struct {
 	// List of access rules for this user. Each entry may target a
 	// different database and role on the same instance.
 	Access []UserAccessRule `json:"access"`
+
+	// DriftPolicy controls what the periodic resync does when the role is
+	// missing, cannot log in or lacks expected grants: Repair (default) or Report.
+	DriftPolicy DriftPolicy `json:"driftPolicy,omitempty"`
+
+	// Adoption allows taking over a role that already exists on the server,
+	// keeping its current password. Without it the operator refuses to touch
+	// roles it did not create.
+	Adoption *UserAdoption `json:"adoption,omitempty"`
+
+	// DryRun makes the operator record the statements it would execute in
+	// status.plan instead of running them. Passwords are redacted.
+	DryRun bool `json:"dryRun,omitempty"`
+
+	// PasswordPolicy overrides the operator-wide password policy for this
+	// User. Fields left empty keep the operator-wide value.
+	PasswordPolicy *PasswordPolicy `json:"passwordPolicy,omitempty"`
+
+	// PasswordEncryption selects how the password is hashed before it is
+	// sent to the server: scram-sha-256 (default) or md5 for servers and
+	// clients that do not support SCRAM. The plaintext is never sent.
+	PasswordEncryption string `json:"passwordEncryption,omitempty"`
+
+	// DeletionPolicy decides whether deleting the resource drops the role:
+	// Retain (default) or Delete. Objects the role owns in the databases of
+	// spec.access are reassigned to the admin user first. Unmanaged roles
+	// are never dropped.
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// Character classes of a PasswordPolicy.
+const (
+	PasswordClassLowercase = "lowercase"
+	PasswordClassUppercase = "uppercase"
+	PasswordClassDigits    = "digits"
+	PasswordClassSymbols   = "symbols"
+)
+
+// PasswordPolicy controls how generated passwords look. Every selected
+// character class appears at least once.
+type PasswordPolicy struct {
+	// Length of the password (default 32).
+	Length int `json:"length,omitempty"`
+
+	// CharacterClasses to draw from: lowercase, uppercase, digits, symbols
+	// (default: all four).
+	CharacterClasses []string `json:"characterClasses,omitempty"`
+
+	// Symbols used by the symbols class (default "!@#$%^&*()-_=+").
+	Symbols string `json:"symbols,omitempty"`
+
+	// ExcludeCharacters are never used, e.g. look-alikes such as "0O1lI".
+	ExcludeCharacters string `json:"excludeCharacters,omitempty"`
+
+	// URLSafe restricts symbols to the URL unreserved characters "-._~" so
+	// the password can be embedded in a DSN or URL without escaping.
+	URLSafe *bool `json:"urlSafe,omitempty"`
+}
+
+// UserAdoption controls taking over an existing, unmanaged role.
+type UserAdoption struct {
+	// Enabled allows taking over the existing role.
+	Enabled bool `json:"enabled"`
+
+	// PasswordSecretRef references a Secret in the User's namespace holding
+	// the role's current password. It is written to the generated Secret
+	// instead of a new password; the password on the server is not changed.
+	// It may name the generatedSecret itself, which is then taken over as well.
+	// If omitted, the adopted role gets a generated password.
+	PasswordSecretRef *AdoptionPasswordSecretRef `json:"passwordSecretRef,omitempty"`
+}
+
+// AdoptionPasswordSecretRef references the current password of an adopted role.
+type AdoptionPasswordSecretRef struct {
+	// Name of the Secret
+	Name string `json:"name"`
+
+	// Key in the Secret data (defaults to "password")
+	Key string `json:"key,omitempty"`
 }
 
 // UserStatus defines the observed state of a User.
@@ -93,6 +202,22 @@ type UserStatus struct {
 
 	// Last time the resource was reconciled (RFC3339 format).
 	UpdatedAt string `json:"updatedAt,omitempty"`
+
+	// Value of the reconcile-requested-at annotation handled by the last reconcile.
+	LastHandledReconcileAt string `json:"lastHandledReconcileAt,omitempty"`
+
+	// Standard conditions (Ready, Paused). On failure the reason is the error category.
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Statements the last dry run would have executed (passwords redacted).
+	Plan []string `json:"plan,omitempty"`
+
+	// Encryption of the password last set by the operator (scram-sha-256 or md5).
+	PasswordEncryption string `json:"passwordEncryption,omitempty"`
+
+	// UID of the generated Secret when it lives outside the User's
+	// namespace, where it cannot carry an owner reference.
+	GeneratedSecretUID string `json:"generatedSecretUID,omitempty"`
 }
 
 // +kubebuilder:object:root=true
@@ -127,7 +252,46 @@ func (in *User) DeepCopyObject() runtime.Object {
 	// Deep copy ObjectMeta
 	out.ObjectMeta = *in.ObjectMeta.DeepCopy()
 
-	// Deep copy slice fields inside Spec if needed
+	// Deep copy status slices
+	if in.Status.Conditions != nil {
+		out.Status.Conditions = make([]metav1.Condition, len(in.Status.Conditions))
+		copy(out.Status.Conditions, in.Status.Conditions)
+	}
+	if in.Status.Plan != nil {
+		out.Status.Plan = make([]string, len(in.Status.Plan))
+		copy(out.Status.Plan, in.Status.Plan)
+	}
+
+	// Deep copy pointer, map and slice fields inside Spec
+	if in.Spec.AdminSecretRef != nil {
+		ref := *in.Spec.AdminSecretRef
+		out.Spec.AdminSecretRef = &ref
+	}
+	if in.Spec.AdminVaultRef != nil {
+		ref := *in.Spec.AdminVaultRef
+		out.Spec.AdminVaultRef = &ref
+	}
+	if in.Spec.SSLRootCertSecretRef != nil {
+		ref := *in.Spec.SSLRootCertSecretRef
+		out.Spec.SSLRootCertSecretRef = &ref
+	}
+	if in.Spec.SSLClientCertSecretRef != nil {
+		ref := *in.Spec.SSLClientCertSecretRef
+		out.Spec.SSLClientCertSecretRef = &ref
+	}
+	if in.Spec.PasswordPolicy != nil {
+		out.Spec.PasswordPolicy = in.Spec.PasswordPolicy.DeepCopy()
+	}
+	if in.Spec.Adoption != nil {
+		adoption := *in.Spec.Adoption
+		if in.Spec.Adoption.PasswordSecretRef != nil {
+			ref := *in.Spec.Adoption.PasswordSecretRef
+			adoption.PasswordSecretRef = &ref
+		}
+		out.Spec.Adoption = &adoption
+	}
+	out.Spec.GeneratedSecret.Labels = copyStringMap(in.Spec.GeneratedSecret.Labels)
+	out.Spec.GeneratedSecret.Annotations = copyStringMap(in.Spec.GeneratedSecret.Annotations)
 	if in.Spec.Access != nil {
 		out.Spec.Access = make([]UserAccessRule, len(in.Spec.Access))
 		copy(out.Spec.Access, in.Spec.Access)
@@ -159,3 +323,20 @@ func (in *UserList) DeepCopyObject() runtime.Object {
 
 	return out
 }
+
+// DeepCopy returns a deep copy of the policy.
+func (in *PasswordPolicy) DeepCopy() *PasswordPolicy {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	if in.CharacterClasses != nil {
+		out.CharacterClasses = make([]string, len(in.CharacterClasses))
+		copy(out.CharacterClasses, in.CharacterClasses)
+	}
+	if in.URLSafe != nil {
+		urlSafe := *in.URLSafe
+		out.URLSafe = &urlSafe
+	}
+	return &out
+}
@@ -0,0 +1,102 @@
+// Package audit emits a structured record for every statement the adapters
+// execute on a target server.
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Outcomes of an audited statement.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Record describes one executed statement. Statement is always redacted:
+// passwords never reach a Record.
+type Record struct {
+	Time       time.Time `json:"time"`
+	Kind       string    `json:"kind,omitempty"`
+	Namespace  string    `json:"namespace,omitempty"`
+	Name       string    `json:"name,omitempty"`
+	Generation int64     `json:"generation,omitempty"`
+	Server     string    `json:"server"`
+	Database   string    `json:"database"`
+	Statement  string    `json:"statement"`
+	Outcome    string    `json:"outcome"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Subject is the custom resource on whose behalf statements are executed.
+type Subject struct {
+	Kind       string
+	Namespace  string
+	Name       string
+	Generation int64
+}
+
+type subjectKey struct{}
+
+// WithSubject returns a context whose audited statements are attributed to s.
+func WithSubject(ctx context.Context, s Subject) context.Context {
+	return context.WithValue(ctx, subjectKey{}, s)
+}
+
+// SubjectFrom returns the subject set with WithSubject, if any.
+func SubjectFrom(ctx context.Context) Subject {
+	s, _ := ctx.Value(subjectKey{}).(Subject)
+	return s
+}
+
+// Sink receives audit records.
+type Sink interface {
+	Emit(ctx context.Context, rec Record) error
+}
+
+// Auditor fans records out to its sinks. Sink errors are logged and never
+// fail the audited operation. A nil *Auditor discards everything.
+type Auditor struct {
+	sinks []Sink
+	log   logr.Logger
+}
+
+// NewAuditor creates an Auditor; log is used to report sink failures.
+func NewAuditor(log logr.Logger, sinks ...Sink) *Auditor {
+	return &Auditor{sinks: sinks, log: log}
+}
+
+// Record completes rec with the time and the subject of ctx and emits it.
+func (a *Auditor) Record(ctx context.Context, rec Record) {
+	if a == nil {
+		return
+	}
+
+	s := SubjectFrom(ctx)
+	rec.Time = time.Now().UTC()
+	rec.Kind = s.Kind
+	rec.Namespace = s.Namespace
+	rec.Name = s.Name
+	rec.Generation = s.Generation
+
+	for _, sink := range a.sinks {
+		if err := sink.Emit(ctx, rec); err != nil {
+			a.log.Error(err, "failed to emit audit record", "sink", sinkName(sink))
+		}
+	}
+}
+
+func sinkName(s Sink) string {
+	switch s.(type) {
+	case *LogSink:
+		return "log"
+	case *FileSink:
+		return "file"
+	case *WebhookSink:
+		return "webhook"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// isPaused reports whether the paused annotation is set to "true".
+func isPaused(obj metav1.Object) bool {
+	return obj.GetAnnotations()[v1alpha1.AnnotationPaused] == "true"
+}
+
+// applyPause updates the Paused condition from the annotation and reports
+// whether the reconcile must be skipped.
+func applyPause(obj metav1.Object, conditions *[]metav1.Condition) bool {
+	if !isPaused(obj) {
+		meta.RemoveStatusCondition(conditions, v1alpha1.ConditionPaused)
+		return false
+	}
+
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               v1alpha1.ConditionPaused,
+		Status:             metav1.ConditionTrue,
+		Reason:             v1alpha1.ReasonPausedByAnnotation,
+		Message:            "reconciliation paused by the " + v1alpha1.AnnotationPaused + " annotation",
+		ObservedGeneration: obj.GetGeneration(),
+	})
+	return true
+}
+
+// reconcileRequestedAt returns the value of the reconcile-requested-at annotation.
+func reconcileRequestedAt(obj metav1.Object) string {
+	return obj.GetAnnotations()[v1alpha1.AnnotationReconcileRequestedAt]
+}
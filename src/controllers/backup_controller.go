@@ -0,0 +1,488 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/credentials"
+	"github.com/mertsaygi/orchestrdb/src/db"
+	"github.com/mertsaygi/orchestrdb/src/services"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// BackupReconciler runs the Job of every Backup once and records its outcome.
+type BackupReconciler struct {
+	client.Client
+	Scheme          *runtime.Scheme
+	Log             logr.Logger
+	DatabaseService *services.DatabaseService
+
+	// APIReader reads the Pods of backup Jobs (and Jobs the cache may not
+	// have seen yet) without caching every Pod of the cluster.
+	APIReader client.Reader
+
+	// Vault is used for adminVaultRef of the Database; nil when no Vault
+	// server is configured.
+	Vault credentials.Provider
+
+	// VaultPaths restricts the Vault paths of adminVaultRef.
+	VaultPaths *services.VaultPathPolicy
+
+	// Recorder emits Events on completion, failure and cleanup.
+	Recorder record.EventRecorder
+
+	// PGToolsImage is the image with pg_dump used by Jobs.
+	PGToolsImage string
+
+	// S3ToolsImage is the image with the AWS CLI used for S3 destinations.
+	S3ToolsImage string
+
+	// JobDeadline bounds how long a backup Job and its role live.
+	JobDeadline time.Duration
+
+	// ResyncInterval is how often a Backup waiting after a permanent
+	// adapter error is retried. Zero disables it.
+	ResyncInterval time.Duration
+}
+
+// Reconcile is called when a Backup, its Job or its Database changes.
+func (r *BackupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("backup", req.NamespacedName)
+
+	var backup v1alpha1.Backup
+	if err := r.Get(ctx, req.NamespacedName, &backup); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// With deletionPolicy Delete the finalizer keeps the resource until the
+	// dump is removed; otherwise deletion leaves the dump in place.
+	if err := syncCleanupFinalizer(ctx, r.Client, &backup, backup.Spec.DeletionPolicy); err != nil {
+		return ctrl.Result{}, err
+	}
+	if !backup.ObjectMeta.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(&backup, v1alpha1.FinalizerCleanup) {
+			return ctrl.Result{}, nil
+		}
+		return r.finalize(ctx, log, &backup)
+	}
+
+	if backup.Finished() {
+		return ctrl.Result{}, nil
+	}
+	if backup.Status.Job == "" {
+		return r.start(ctx, log, &backup)
+	}
+
+	status := &backup.Status
+	if err := r.observeBackupJob(ctx, &backup); err != nil {
+		log.Error(err, "failed to observe backup Job")
+		status.Message = err.Error()
+		setBackupCondition(&backup)
+		if err := r.Status().Update(ctx, &backup); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, err
+	}
+
+	if backup.Finished() {
+		// A finished Backup is not reconciled again, so the phase is only
+		// stored once the role is gone.
+		if err := r.finishBackupJob(ctx, log, &backup); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	switch status.Phase {
+	case v1alpha1.BackupCompleted:
+		log.Info("backup completed", "location", status.Location, "size", status.SizeBytes)
+		r.Recorder.Event(&backup, corev1.EventTypeNormal, v1alpha1.ReasonBackupCompleted, status.Message)
+	case v1alpha1.BackupFailed:
+		log.Info("backup failed", "reason", status.Message)
+		r.Recorder.Event(&backup, corev1.EventTypeWarning, v1alpha1.ReasonBackupFailed, status.Message)
+	}
+
+	status.UpdatedAt = time.Now().Format(time.RFC3339)
+	setBackupCondition(&backup)
+	// Owns() requeues us when the Job progresses.
+	return ctrl.Result{}, r.Status().Update(ctx, &backup)
+}
+
+// start creates the job role, the Secret with its connection string and
+// the Job dumping the database once the Database is created. The Secret and
+// the Job are owned by the Backup.
+func (r *BackupReconciler) start(ctx context.Context, log logr.Logger, backup *v1alpha1.Backup) (ctrl.Result, error) {
+	status := &backup.Status
+	wait := func(message string) error {
+		status.Phase = v1alpha1.BackupPending
+		status.Message = message
+		status.UpdatedAt = time.Now().Format(time.RFC3339)
+		setBackupCondition(backup)
+		return r.Status().Update(ctx, backup)
+	}
+
+	if err := services.ValidateBackupSpec(&backup.Spec); err != nil {
+		log.Error(err, "invalid Backup spec")
+		return ctrl.Result{}, wait(err.Error())
+	}
+
+	// The Database watch requeues us once it is created.
+	var dbRes v1alpha1.Database
+	dbName := backup.Spec.DatabaseRef.Name
+	err := r.Get(ctx, types.NamespacedName{Name: dbName, Namespace: backup.Namespace}, &dbRes)
+	if apierrors.IsNotFound(err) {
+		log.Info("waiting for Database", "name", dbName)
+		return ctrl.Result{}, wait(fmt.Sprintf("Database %s not found", dbName))
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !dbRes.Status.Created || dbRes.Cloning() {
+		log.Info("waiting for Database", "name", dbName)
+		return ctrl.Result{}, wait(fmt.Sprintf("Database %s is not created yet", dbName))
+	}
+
+	adminUser, adminPassword, err := databaseAdminCredentials(ctx, r.Client, r.Vault, r.VaultPaths, &dbRes)
+	if err != nil {
+		log.Error(err, "failed to resolve admin credentials of Database", "name", dbName)
+		if err := wait(err.Error()); err != nil {
+			return ctrl.Result{}, err
+		}
+		if apierrors.IsNotFound(err) || errors.Is(err, services.ErrReferenceNotPermitted) {
+			// The Database reports the same; its status update requeues us.
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+	role, err := r.DatabaseService.NewJobRole(services.JobRoleName(backup, ""), time.Now().Add(r.JobDeadline), false)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	data, err := r.DatabaseService.DumpSecretData(ctx, &dbRes, adminUser, adminPassword, role)
+	if err != nil {
+		log.Error(err, "failed to build backup connection", "category", db.CategoryOf(err))
+		if err := wait(err.Error()); err != nil {
+			return ctrl.Result{}, err
+		}
+		return resultForAdapterError(err, r.ResyncInterval)
+	}
+
+	name := backup.Name + "-backup"
+	job := services.BackupJob(backup, name, r.PGToolsImage, r.S3ToolsImage, r.JobDeadline)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: backup.Namespace, Labels: job.Labels},
+		Data:       data,
+	}
+	if err := controllerutil.SetControllerReference(backup, secret, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.Create(ctx, secret); apierrors.IsAlreadyExists(err) {
+		// Left over from an attempt that failed to create the Job.
+		if err := r.Update(ctx, secret); err != nil {
+			return ctrl.Result{}, err
+		}
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := controllerutil.SetControllerReference(backup, job, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.Create(ctx, job); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	now := metav1.Now()
+	status.Phase = v1alpha1.BackupRunning
+	status.Database = dbRes.Spec.Name
+	status.Job = name
+	status.Location = services.BackupLocation(backup)
+	status.StartedAt = &now
+	status.Message = fmt.Sprintf("backing up %s with Job %s", status.Database, name)
+	status.UpdatedAt = now.Format(time.RFC3339)
+	setBackupCondition(backup)
+	log.Info("backup started", "job", name, "location", status.Location)
+	return ctrl.Result{}, r.Status().Update(ctx, backup)
+}
+
+// observeBackupJob records the progress of the backup Job in the status.
+func (r *BackupReconciler) observeBackupJob(ctx context.Context, backup *v1alpha1.Backup) error {
+	status := &backup.Status
+	key := types.NamespacedName{Name: status.Job, Namespace: backup.Namespace}
+
+	var job batchv1.Job
+	err := r.Get(ctx, key, &job)
+	if apierrors.IsNotFound(err) {
+		// The cache may not have seen a Job created a moment ago.
+		err = r.APIReader.Get(ctx, key, &job)
+	}
+	if apierrors.IsNotFound(err) {
+		status.Phase = v1alpha1.BackupFailed
+		status.Message = fmt.Sprintf("Job %s was deleted before it completed", status.Job)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(&job, backup) {
+		return fmt.Errorf("backup Job %s already exists and was not created for this Backup", job.Name)
+	}
+
+	if job.Status.StartTime != nil {
+		status.StartedAt = job.Status.StartTime.DeepCopy()
+	}
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			status.Phase = v1alpha1.BackupCompleted
+			status.CompletedAt = job.Status.CompletionTime.DeepCopy()
+			if status.StartedAt != nil && status.CompletedAt != nil {
+				status.Duration = status.CompletedAt.Sub(status.StartedAt.Time).String()
+			}
+			result, err := r.backupResult(ctx, &job)
+			if err != nil {
+				status.Message = fmt.Sprintf("stored at %s; size and checksum unknown: %v", status.Location, err)
+				return nil
+			}
+			status.SizeBytes = result.SizeBytes
+			status.Checksum = result.Checksum
+			status.Message = fmt.Sprintf("stored at %s", status.Location)
+			return nil
+		case batchv1.JobFailed:
+			status.Phase = v1alpha1.BackupFailed
+			status.CompletedAt = job.Status.CompletionTime.DeepCopy()
+			status.Message = fmt.Sprintf("Job %s failed: %s", job.Name, cond.Message)
+			return nil
+		}
+	}
+	status.Phase = v1alpha1.BackupRunning
+	status.Message = fmt.Sprintf("backing up %s with Job %s", status.Database, job.Name)
+	return nil
+}
+
+// backupResult reads the size and checksum a completed backup Job wrote to
+// the termination message of its backup container.
+func (r *BackupReconciler) backupResult(ctx context.Context, job *batchv1.Job) (*services.BackupResult, error) {
+	pods, err := jobPods(ctx, r.APIReader, job)
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods {
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Name != services.BackupContainer || cs.State.Terminated == nil || cs.State.Terminated.ExitCode != 0 {
+				continue
+			}
+			return services.ParseBackupResult(cs.State.Terminated.Message)
+		}
+	}
+	return nil, errors.New("no Pod of the Job reported a result")
+}
+
+// jobPods lists the Pods of job through reader.
+func jobPods(ctx context.Context, reader client.Reader, job *batchv1.Job) ([]corev1.Pod, error) {
+	var pods corev1.PodList
+	if err := reader.List(ctx, &pods, client.InNamespace(job.Namespace),
+		client.MatchingLabels{batchv1.JobNameLabel: job.Name}); err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// jobFailureOutput returns the termination message of the failed container
+// of job, which ends with its output for containers using
+// TerminationMessageFallbackToLogsOnError.
+func jobFailureOutput(ctx context.Context, reader client.Reader, job *batchv1.Job) string {
+	pods, err := jobPods(ctx, reader, job)
+	if err != nil {
+		return ""
+	}
+	for _, pod := range pods {
+		statuses := append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...)
+		for _, cs := range statuses {
+			if t := cs.State.Terminated; t != nil && t.ExitCode != 0 && t.Message != "" {
+				return strings.TrimSpace(t.Message)
+			}
+		}
+	}
+	return ""
+}
+
+// finalize removes the dump of a Backup deleted with deletionPolicy Delete
+// with a cleanup Job and releases the cleanup finalizer. A running backup
+// Job is deleted first. A dump that cannot be removed is left in place with
+// a warning.
+func (r *BackupReconciler) finalize(ctx context.Context, log logr.Logger, backup *v1alpha1.Backup) (ctrl.Result, error) {
+	status := &backup.Status
+	if status.Location == "" {
+		// The backup never started, so nothing was stored.
+		return ctrl.Result{}, releaseCleanupFinalizer(ctx, r.Client, backup)
+	}
+	if err := services.ValidateBackupSpec(&backup.Spec); err != nil || services.BackupLocation(backup) != status.Location {
+		message := fmt.Sprintf("destination changed since the backup ran; %s not removed", status.Location)
+		log.Info("backup not removed", "reason", message)
+		r.Recorder.Event(backup, corev1.EventTypeWarning, v1alpha1.ReasonBackupCleanupFailed, message)
+		return ctrl.Result{}, releaseCleanupFinalizer(ctx, r.Client, backup)
+	}
+
+	if status.Phase == v1alpha1.BackupRunning {
+		var job batchv1.Job
+		err := r.Get(ctx, types.NamespacedName{Name: status.Job, Namespace: backup.Namespace}, &job)
+		if err == nil {
+			if job.DeletionTimestamp.IsZero() {
+				err := r.Delete(ctx, &job, client.PropagationPolicy(metav1.DeletePropagationForeground))
+				if client.IgnoreNotFound(err) != nil {
+					return ctrl.Result{}, err
+				}
+			}
+			// Owns() requeues us once the Job and its Pods are gone.
+			return ctrl.Result{}, nil
+		}
+		if !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+	}
+
+	name := backup.Name + "-cleanup"
+	var job batchv1.Job
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: backup.Namespace}, &job)
+	if apierrors.IsNotFound(err) {
+		job := services.BackupCleanupJob(backup, name, r.PGToolsImage, r.S3ToolsImage)
+		if err := controllerutil.SetControllerReference(backup, job, r.Scheme); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err := r.Create(ctx, job); err != nil && !apierrors.IsAlreadyExists(err) {
+			return ctrl.Result{}, err
+		}
+		log.Info("removing backup", "location", status.Location, "job", name)
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			log.Info("backup removed", "location", status.Location)
+			r.Recorder.Eventf(backup, corev1.EventTypeNormal, v1alpha1.ReasonBackupDeleted, "removed %s", status.Location)
+			return ctrl.Result{}, releaseCleanupFinalizer(ctx, r.Client, backup)
+		case batchv1.JobFailed:
+			log.Info("backup not removed", "reason", cond.Message)
+			r.Recorder.Eventf(backup, corev1.EventTypeWarning, v1alpha1.ReasonBackupCleanupFailed,
+				"Job %s failed to remove %s: %s", name, status.Location, cond.Message)
+			return ctrl.Result{}, releaseCleanupFinalizer(ctx, r.Client, backup)
+		}
+	}
+	return ctrl.Result{}, nil
+}
+
+// finishBackupJob drops the job role of a finished backup Job and deletes
+// its Secret. Transient failures are returned to be retried; otherwise a
+// role that cannot be dropped now expires and is dropped by a later Job on
+// the same server.
+func (r *BackupReconciler) finishBackupJob(ctx context.Context, log logr.Logger, backup *v1alpha1.Backup) error {
+	role := services.JobRoleName(backup, "")
+	var dbRes v1alpha1.Database
+	err := r.Get(ctx, types.NamespacedName{Name: backup.Spec.DatabaseRef.Name, Namespace: backup.Namespace}, &dbRes)
+	if err == nil {
+		var adminUser, adminPassword string
+		adminUser, adminPassword, err = databaseAdminCredentials(ctx, r.Client, r.Vault, r.VaultPaths, &dbRes)
+		if err == nil {
+			err = r.DatabaseService.DropJobRole(ctx, &dbRes, adminUser, adminPassword, role)
+			if err != nil && !db.CategoryOf(err).Permanent() {
+				return fmt.Errorf("drop backup role: %w", err)
+			}
+		}
+	}
+	if err != nil {
+		log.Error(err, "failed to drop backup role; it is dropped once expired", "role", role)
+	}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: backup.Status.Job, Namespace: backup.Namespace}}
+	return client.IgnoreNotFound(r.Delete(ctx, secret))
+}
+
+// setBackupCondition reflects the phase of backup in its Ready condition.
+func setBackupCondition(backup *v1alpha1.Backup) {
+	cond := metav1.Condition{
+		Type:               v1alpha1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             v1alpha1.ReasonBackupPending,
+		Message:            backup.Status.Message,
+		ObservedGeneration: backup.Generation,
+	}
+	switch backup.Status.Phase {
+	case v1alpha1.BackupRunning:
+		cond.Reason = v1alpha1.ReasonBackupRunning
+	case v1alpha1.BackupCompleted:
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = v1alpha1.ReasonBackupCompleted
+	case v1alpha1.BackupFailed:
+		cond.Reason = v1alpha1.ReasonBackupFailed
+	}
+	meta.SetStatusCondition(&backup.Status.Conditions, cond)
+}
+
+// backupsForDatabase maps a Database to the Backups waiting for it.
+func (r *BackupReconciler) backupsForDatabase(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list v1alpha1.BackupList
+	if err := r.List(ctx, &list, client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{backupDatabaseRefNameField: obj.GetName()}); err != nil {
+		r.Log.Error(err, "failed to list Backups for Database", "database", obj.GetName())
+		return nil
+	}
+
+	var reqs []reconcile.Request
+	for _, item := range list.Items {
+		if item.Status.Job != "" {
+			continue
+		}
+		reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{
+			Name:      item.Name,
+			Namespace: item.Namespace,
+		}})
+	}
+	return reqs
+}
+
+// SetupWithManager registers the controller with the manager.
+func (r *BackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1alpha1.Backup{}, backupDatabaseRefNameField,
+		func(obj client.Object) []string {
+			return []string{obj.(*v1alpha1.Backup).Spec.DatabaseRef.Name}
+		}); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.Backup{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controller.Options{RateLimiter: newRateLimiter()}).
+		Owns(&batchv1.Job{}).
+		Watches(&v1alpha1.Database{}, handler.EnqueueRequestsFromMapFunc(r.backupsForDatabase)).
+		Complete(r)
+}
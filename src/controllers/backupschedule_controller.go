@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/go-logr/logr"
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/db"
+	"github.com/mertsaygi/orchestrdb/src/services"
+	"github.com/robfig/cron/v3"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// BackupScheduleReconciler creates the Backups of every BackupSchedule at
+// its scheduled times and prunes them according to its retention.
+type BackupScheduleReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+	Log    logr.Logger
+
+	// Recorder emits Events for created and pruned Backups.
+	Recorder record.EventRecorder
+}
+
+// Reconcile is called when a BackupSchedule or one of its Backups changes,
+// and at the next scheduled time.
+func (r *BackupScheduleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("backupschedule", req.NamespacedName)
+
+	var schedule v1alpha1.BackupSchedule
+	if err := r.Get(ctx, req.NamespacedName, &schedule); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !schedule.ObjectMeta.DeletionTimestamp.IsZero() {
+		// Its Backups are not owned by it and outlive it.
+		return ctrl.Result{}, nil
+	}
+
+	now := time.Now()
+	status := &schedule.Status
+	status.UpdatedAt = now.Format(time.RFC3339)
+
+	cronSchedule, err := cron.ParseStandard(schedule.Spec.Schedule)
+	if err == nil {
+		err = services.ValidateBackupSpec(&schedule.Spec.Template)
+	}
+	if err != nil {
+		log.Error(err, "invalid BackupSchedule spec")
+		status.NextScheduleTime = nil
+		setScheduleCondition(&schedule, metav1.ConditionFalse, string(db.CategoryInvalidSpec), err.Error())
+		return ctrl.Result{}, r.Status().Update(ctx, &schedule)
+	}
+
+	var list v1alpha1.BackupList
+	if err := r.List(ctx, &list, client.InNamespace(schedule.Namespace),
+		client.MatchingLabels{v1alpha1.LabelBackupSchedule: schedule.Name}); err != nil {
+		return ctrl.Result{}, err
+	}
+	backups, err := r.scheduledBackups(ctx, &schedule, list.Items)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	for _, backup := range backups {
+		completed := backup.Status.CompletedAt
+		if backup.Status.Phase == v1alpha1.BackupCompleted && completed != nil &&
+			(status.LastSuccessfulTime == nil || status.LastSuccessfulTime.Before(completed)) {
+			status.LastSuccessfulTime = completed.DeepCopy()
+		}
+	}
+	if err := r.prune(ctx, log, &schedule, backups, now); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if schedule.Spec.Suspend {
+		status.NextScheduleTime = nil
+		setScheduleCondition(&schedule, metav1.ConditionFalse, v1alpha1.ReasonSuspended, "no Backups are created while suspended")
+		return ctrl.Result{}, r.Status().Update(ctx, &schedule)
+	}
+
+	last := schedule.CreationTimestamp.Time
+	if status.LastScheduleTime != nil {
+		last = status.LastScheduleTime.Time
+	}
+	next := cronSchedule.Next(last.UTC())
+	if !next.After(now) {
+		// Only the most recent missed time is caught up, like a CronJob.
+		scheduled := next
+		for n := cronSchedule.Next(scheduled); !n.After(now); n = cronSchedule.Next(n) {
+			scheduled = n
+		}
+
+		name, err := r.createBackup(ctx, &schedule, scheduled)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		log.Info("created Backup", "name", name, "scheduled", scheduled)
+		r.Recorder.Eventf(&schedule, corev1.EventTypeNormal, v1alpha1.ReasonScheduled, "created Backup %s", name)
+		status.LastScheduleTime = &metav1.Time{Time: scheduled}
+		status.LastBackup = name
+		next = cronSchedule.Next(scheduled)
+	}
+
+	status.NextScheduleTime = &metav1.Time{Time: next}
+	setScheduleCondition(&schedule, metav1.ConditionTrue, v1alpha1.ReasonScheduled,
+		"next Backup at "+next.Format(time.RFC3339))
+	if err := r.Status().Update(ctx, &schedule); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: next.Sub(now)}, nil
+}
+
+// scheduledBackups returns the Backups of items created by schedule. They
+// are not owned by it, so deleting the schedule does not garbage collect
+// them and their dumps; Backups still owned by it from earlier versions are
+// released here.
+func (r *BackupScheduleReconciler) scheduledBackups(
+	ctx context.Context,
+	schedule *v1alpha1.BackupSchedule,
+	items []v1alpha1.Backup,
+) ([]v1alpha1.Backup, error) {
+	var backups []v1alpha1.Backup
+	for _, item := range items {
+		if metav1.IsControlledBy(&item, schedule) {
+			item.OwnerReferences = slices.DeleteFunc(item.OwnerReferences, func(ref metav1.OwnerReference) bool {
+				return ref.UID == schedule.UID
+			})
+			item.Labels[v1alpha1.LabelBackupScheduleUID] = string(schedule.UID)
+			if err := r.Update(ctx, &item); err != nil {
+				return nil, err
+			}
+		}
+		if item.Labels[v1alpha1.LabelBackupScheduleUID] == string(schedule.UID) {
+			backups = append(backups, item)
+		}
+	}
+	return backups, nil
+}
+
+// createBackup creates the Backup of schedule for the scheduled time. Its
+// name is derived from that time, so a repeated attempt finds it instead of
+// creating a second one.
+func (r *BackupScheduleReconciler) createBackup(
+	ctx context.Context,
+	schedule *v1alpha1.BackupSchedule,
+	scheduled time.Time,
+) (string, error) {
+	backup := &v1alpha1.Backup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      schedule.Name + "-" + scheduled.UTC().Format("200601021504"),
+			Namespace: schedule.Namespace,
+			Labels: map[string]string{
+				v1alpha1.LabelManagedBy:         v1alpha1.ManagedByValue,
+				v1alpha1.LabelBackupSchedule:    schedule.Name,
+				v1alpha1.LabelBackupScheduleUID: string(schedule.UID),
+			},
+		},
+		Spec: *schedule.Spec.Template.DeepCopy(),
+	}
+	if err := r.Create(ctx, backup); err != nil && !apierrors.IsAlreadyExists(err) {
+		return "", err
+	}
+	return backup.Name, nil
+}
+
+// prune deletes the finished Backups of schedule that its retention does
+// not keep.
+func (r *BackupScheduleReconciler) prune(
+	ctx context.Context,
+	log logr.Logger,
+	schedule *v1alpha1.BackupSchedule,
+	backups []v1alpha1.Backup,
+	now time.Time,
+) error {
+	for _, backup := range backupsToPrune(schedule.Spec.Retention, backups, now) {
+		err := r.Delete(ctx, backup, client.Preconditions{UID: &backup.UID})
+		if client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		log.Info("pruned Backup", "name", backup.Name)
+		r.Recorder.Eventf(schedule, corev1.EventTypeNormal, v1alpha1.ReasonPruned, "deleted Backup %s", backup.Name)
+	}
+	return nil
+}
+
+// backupsToPrune returns the finished Backups retention does not keep,
+// newest first; backups is sorted in place. A completed Backup is kept while
+// it is one of the keepLast most recent completed ones or younger than
+// maxAge. Failed Backups are kept until a later Backup completed.
+func backupsToPrune(retention v1alpha1.BackupRetention, backups []v1alpha1.Backup, now time.Time) []*v1alpha1.Backup {
+	if retention.KeepLast == nil && retention.MaxAge == nil {
+		return nil
+	}
+
+	// Newest first.
+	slices.SortFunc(backups, func(a, b v1alpha1.Backup) int {
+		return b.CreationTimestamp.Time.Compare(a.CreationTimestamp.Time)
+	})
+
+	var prune []*v1alpha1.Backup
+	completed := 0
+	for i := range backups {
+		backup := &backups[i]
+		if !backup.Finished() || !backup.DeletionTimestamp.IsZero() {
+			continue
+		}
+
+		var keep bool
+		if backup.Status.Phase == v1alpha1.BackupCompleted {
+			completed++
+			keep = retention.KeepLast != nil && completed <= int(*retention.KeepLast)
+		} else {
+			keep = completed == 0
+		}
+		if retention.MaxAge != nil && now.Sub(backup.CreationTimestamp.Time) < retention.MaxAge.Duration {
+			keep = true
+		}
+		if !keep {
+			prune = append(prune, backup)
+		}
+	}
+	return prune
+}
+
+// setScheduleCondition records the state of schedule in its Ready condition.
+func setScheduleCondition(schedule *v1alpha1.BackupSchedule, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&schedule.Status.Conditions, metav1.Condition{
+		Type:               v1alpha1.ConditionReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: schedule.Generation,
+	})
+}
+
+// scheduleForBackup maps a Backup to the BackupSchedule that created it.
+func scheduleForBackup(_ context.Context, obj client.Object) []reconcile.Request {
+	name := obj.GetLabels()[v1alpha1.LabelBackupSchedule]
+	if name == "" {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name, Namespace: obj.GetNamespace()}}}
+}
+
+// SetupWithManager registers the controller with the manager.
+func (r *BackupScheduleReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.BackupSchedule{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&v1alpha1.Backup{}, handler.EnqueueRequestsFromMapFunc(scheduleForBackup)).
+		Complete(r)
+}
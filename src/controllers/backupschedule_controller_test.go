@@ -0,0 +1,194 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+// testBackup returns a Backup of the given phase created age ago.
+func testBackup(name string, phase v1alpha1.BackupPhase, age time.Duration, now time.Time) v1alpha1.Backup {
+	return v1alpha1.Backup{
+		ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(now.Add(-age))},
+		Status:     v1alpha1.BackupStatus{Phase: phase},
+	}
+}
+
+func TestBackupsToPrune(t *testing.T) {
+	now := time.Date(2024, 5, 1, 3, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	keep := func(n int32) *int32 { return &n }
+	maxAge := func(d time.Duration) *metav1.Duration { return &metav1.Duration{Duration: d} }
+
+	const (
+		completed = v1alpha1.BackupCompleted
+		failed    = v1alpha1.BackupFailed
+		running   = v1alpha1.BackupRunning
+	)
+	type backup struct {
+		name  string
+		phase v1alpha1.BackupPhase
+		age   time.Duration
+	}
+
+	tests := []struct {
+		name      string
+		retention v1alpha1.BackupRetention
+		backups   []backup
+		want      []string
+	}{
+		{
+			name:    "no retention keeps everything",
+			backups: []backup{{"a", completed, 1 * day}, {"b", completed, 2 * day}, {"c", failed, 3 * day}},
+		},
+		{
+			name:      "keepLast",
+			retention: v1alpha1.BackupRetention{KeepLast: keep(2)},
+			backups:   []backup{{"a", completed, 1 * day}, {"b", completed, 2 * day}, {"c", completed, 3 * day}, {"d", completed, 4 * day}},
+			want:      []string{"c", "d"},
+		},
+		{
+			name:      "keepLast sorts by creation time",
+			retention: v1alpha1.BackupRetention{KeepLast: keep(1)},
+			backups:   []backup{{"old", completed, 3 * day}, {"new", completed, 1 * day}, {"mid", completed, 2 * day}},
+			want:      []string{"mid", "old"},
+		},
+		{
+			name:      "keepLast counts completed Backups only",
+			retention: v1alpha1.BackupRetention{KeepLast: keep(1)},
+			backups:   []backup{{"a", failed, 1 * day}, {"b", completed, 2 * day}, {"c", completed, 3 * day}},
+			want:      []string{"c"},
+		},
+		{
+			name:      "failed Backups after the last completed one are kept",
+			retention: v1alpha1.BackupRetention{KeepLast: keep(1)},
+			backups:   []backup{{"a", failed, 1 * day}, {"b", completed, 2 * day}, {"c", failed, 3 * day}},
+			want:      []string{"c"},
+		},
+		{
+			name:      "failed Backups are kept while none completed",
+			retention: v1alpha1.BackupRetention{KeepLast: keep(1)},
+			backups:   []backup{{"a", failed, 1 * day}, {"b", failed, 2 * day}},
+		},
+		{
+			name:      "unfinished Backups are never pruned",
+			retention: v1alpha1.BackupRetention{KeepLast: keep(1)},
+			backups:   []backup{{"a", completed, 1 * day}, {"b", running, 2 * day}, {"c", "", 3 * day}},
+		},
+		{
+			name:      "maxAge",
+			retention: v1alpha1.BackupRetention{MaxAge: maxAge(2*day + time.Hour)},
+			backups:   []backup{{"a", completed, 1 * day}, {"b", completed, 2 * day}, {"c", completed, 3 * day}, {"d", failed, 4 * day}},
+			want:      []string{"c", "d"},
+		},
+		{
+			name:      "either rule keeps a Backup",
+			retention: v1alpha1.BackupRetention{KeepLast: keep(1), MaxAge: maxAge(2*day + time.Hour)},
+			backups:   []backup{{"a", completed, 1 * day}, {"b", completed, 2 * day}, {"c", completed, 3 * day}},
+			want:      []string{"c"},
+		},
+		{
+			name:      "keepLast zero with maxAge",
+			retention: v1alpha1.BackupRetention{KeepLast: keep(0), MaxAge: maxAge(day + time.Hour)},
+			backups:   []backup{{"a", completed, 1 * day}, {"b", completed, 2 * day}},
+			want:      []string{"b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var backups []v1alpha1.Backup
+			for _, b := range tt.backups {
+				backups = append(backups, testBackup(b.name, b.phase, b.age, now))
+			}
+			var got []string
+			for _, b := range backupsToPrune(tt.retention, backups, now) {
+				got = append(got, b.Name)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pruned %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackupsToPruneSkipsDeleted(t *testing.T) {
+	now := time.Now()
+	deleted := testBackup("deleted", v1alpha1.BackupCompleted, 2*time.Hour, now)
+	deleted.DeletionTimestamp = &metav1.Time{Time: now}
+	backups := []v1alpha1.Backup{testBackup("new", v1alpha1.BackupCompleted, time.Hour, now), deleted}
+
+	keepLast := int32(0)
+	got := backupsToPrune(v1alpha1.BackupRetention{KeepLast: &keepLast}, backups, now)
+	if len(got) != 1 || got[0].Name != "new" {
+		t.Errorf("pruned %v, want [new]", got)
+	}
+}
+
+func TestScheduledBackups(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := v1alpha1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+
+	schedule := &v1alpha1.BackupSchedule{ObjectMeta: metav1.ObjectMeta{
+		Name: "nightly", Namespace: "app", UID: types.UID("current"),
+	}}
+	labelled := func(name, uid string, owners ...metav1.OwnerReference) *v1alpha1.Backup {
+		return &v1alpha1.Backup{ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "app",
+			Labels: map[string]string{
+				v1alpha1.LabelBackupSchedule:    "nightly",
+				v1alpha1.LabelBackupScheduleUID: uid,
+			},
+			OwnerReferences: owners,
+		}}
+	}
+	isController := true
+	owner := metav1.OwnerReference{
+		APIVersion: v1alpha1.SchemeGroupVersion.String(),
+		Kind:       "BackupSchedule",
+		Name:       "nightly",
+		UID:        schedule.UID,
+		Controller: &isController,
+	}
+
+	ours := labelled("ours", "current")
+	legacy := labelled("legacy", "", owner)
+	previous := labelled("previous", "previous")
+
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(ours, legacy, previous).Build()
+	r := &BackupScheduleReconciler{Client: c, Scheme: scheme}
+
+	items := []v1alpha1.Backup{*ours, *legacy, *previous}
+	backups, err := r.scheduledBackups(context.Background(), schedule, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, b := range backups {
+		names = append(names, b.Name)
+	}
+	if want := []string{"ours", "legacy"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("scheduled Backups = %v, want %v", names, want)
+	}
+
+	var released v1alpha1.Backup
+	if err := c.Get(context.Background(), types.NamespacedName{Name: "legacy", Namespace: "app"}, &released); err != nil {
+		t.Fatal(err)
+	}
+	if len(released.OwnerReferences) != 0 {
+		t.Errorf("legacy Backup still has owner references %v", released.OwnerReferences)
+	}
+	if uid := released.Labels[v1alpha1.LabelBackupScheduleUID]; uid != "current" {
+		t.Errorf("legacy Backup has schedule UID label %q, want current", uid)
+	}
+}
@@ -0,0 +1,306 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/db"
+	"github.com/mertsaygi/orchestrdb/src/services"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// clone copies the database from spec.source while dbRes.Cloning(). It
+// reports whether the reconcile proceeds to EnsureDatabase: always for the
+// template method (CREATE DATABASE ... TEMPLATE runs there) and in dry run,
+// and for the dump method once the copy Job completed.
+func (r *DatabaseReconciler) clone(
+	ctx context.Context,
+	log logr.Logger,
+	dbRes *v1alpha1.Database,
+	adminUser string,
+	adminPassword string,
+	dryRun bool,
+) (bool, ctrl.Result, error) {
+	source, err := r.DatabaseService.ResolveSource(ctx, dbRes)
+	if err != nil {
+		if !errors.Is(err, services.ErrSourceNotReady) && db.CategoryOf(err) != db.CategoryInvalidSpec {
+			return false, ctrl.Result{}, err
+		}
+		// The Database watch requeues us once the source is created.
+		log.Info("waiting for source Database", "reason", err.Error())
+		if dbRes.Status.Source == nil {
+			dbRes.Status.Source = &v1alpha1.SourceStatus{Phase: v1alpha1.ClonePending}
+		}
+		dbRes.Status.Source.Message = err.Error()
+		setCloneCondition(dbRes, v1alpha1.ReasonSourceNotReady, err.Error())
+		return false, ctrl.Result{}, r.Status().Update(ctx, dbRes)
+	}
+
+	status := dbRes.Status.Source
+	if status == nil || status.Phase == v1alpha1.ClonePending {
+		status = &v1alpha1.SourceStatus{
+			Method:   services.CloneMethodFor(dbRes, source),
+			Phase:    v1alpha1.ClonePending,
+			Database: source.Spec.Name,
+		}
+		dbRes.Status.Source = status
+	}
+
+	if dryRun {
+		status.Message = fmt.Sprintf("dry run: %s copy of %s not started", status.Method, status.Database)
+		return true, ctrl.Result{}, nil
+	}
+
+	if status.Method == v1alpha1.CloneMethodTemplate {
+		if status.Phase == v1alpha1.ClonePending {
+			now := metav1.Now()
+			status.Phase = v1alpha1.CloneRunning
+			status.StartedAt = &now
+			status.Message = "creating from template " + status.Database
+		}
+		return true, ctrl.Result{}, nil
+	}
+
+	// -------------------------------------------------------------------------
+	// Dump: create the empty database, then restore into it with a Job
+	// -------------------------------------------------------------------------
+	if _, err := r.DatabaseService.EnsureDatabase(ctx, dbRes, adminUser, adminPassword); err != nil {
+		log.Error(err, "EnsureDatabase failed", "category", db.CategoryOf(err))
+		if err := r.Status().Update(ctx, dbRes); err != nil {
+			return false, ctrl.Result{}, err
+		}
+		result, err := resultForAdapterError(err, r.ResyncInterval)
+		return false, result, err
+	}
+
+	if err := r.observeCloneJob(ctx, dbRes, source, adminUser, adminPassword); err != nil {
+		log.Error(err, "clone Job failed to start")
+		dbRes.Status.Created = false
+		dbRes.Status.LastError = err.Error()
+		setCloneCondition(dbRes, v1alpha1.ReasonCloning, err.Error())
+		if err := r.Status().Update(ctx, dbRes); err != nil {
+			return false, ctrl.Result{}, err
+		}
+		return false, ctrl.Result{}, err
+	}
+
+	switch status.Phase {
+	case v1alpha1.CloneCompleted:
+		// The phase is only stored once the roles are gone, so a failed
+		// cleanup is retried.
+		if err := r.finishCloneJob(ctx, dbRes, source, adminUser, adminPassword, status.Job); err != nil {
+			return false, ctrl.Result{}, err
+		}
+		log.Info("database copied", "source", status.Database, "job", status.Job)
+		r.Recorder.Event(dbRes, corev1.EventTypeNormal, v1alpha1.ReasonCloned, status.Message)
+		return true, ctrl.Result{}, nil
+	case v1alpha1.CloneFailed:
+		if err := r.finishCloneJob(ctx, dbRes, source, adminUser, adminPassword, status.Job); err != nil {
+			return false, ctrl.Result{}, err
+		}
+		log.Info("database copy failed", "source", status.Database, "reason", status.Message)
+		r.Recorder.Event(dbRes, corev1.EventTypeWarning, v1alpha1.ReasonCloneFailed, status.Message)
+		setCloneCondition(dbRes, v1alpha1.ReasonCloneFailed, status.Message)
+	default:
+		setCloneCondition(dbRes, v1alpha1.ReasonCloning, status.Message)
+	}
+
+	// The database exists but holds no usable copy yet.
+	dbRes.Status.Created = false
+	if err := r.Status().Update(ctx, dbRes); err != nil {
+		return false, ctrl.Result{}, err
+	}
+	// Owns() requeues us when the Job progresses.
+	return false, ctrl.Result{}, nil
+}
+
+// observeCloneJob starts the copy Job of dbRes or records its progress in
+// status.source.
+func (r *DatabaseReconciler) observeCloneJob(
+	ctx context.Context,
+	dbRes *v1alpha1.Database,
+	source *v1alpha1.Database,
+	adminUser string,
+	adminPassword string,
+) error {
+	status := dbRes.Status.Source
+	name := dbRes.Name + "-clone"
+
+	var job batchv1.Job
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: dbRes.Namespace}, &job)
+	if apierrors.IsNotFound(err) {
+		if status.Job != "" {
+			status.Phase = v1alpha1.CloneFailed
+			status.Message = fmt.Sprintf("Job %s was deleted before it completed", status.Job)
+			return nil
+		}
+		return r.startCloneJob(ctx, dbRes, source, adminUser, adminPassword, name)
+	}
+	if err != nil {
+		return err
+	}
+	if !metav1.IsControlledBy(&job, dbRes) {
+		return fmt.Errorf("clone Job %s already exists and was not created for this Database", name)
+	}
+
+	status.Job = job.Name
+	if job.Status.StartTime != nil {
+		// pg_dump takes its snapshot right when the Job starts.
+		status.StartedAt = job.Status.StartTime.DeepCopy()
+		status.SnapshotTime = job.Status.StartTime.DeepCopy()
+	}
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			status.Phase = v1alpha1.CloneCompleted
+			status.CompletedAt = job.Status.CompletionTime.DeepCopy()
+			status.Message = fmt.Sprintf("copied from %s with Job %s", status.Database, job.Name)
+			return nil
+		case batchv1.JobFailed:
+			status.Phase = v1alpha1.CloneFailed
+			status.Message = fmt.Sprintf("Job %s failed: %s; delete the Database to start over", job.Name, cond.Message)
+			return nil
+		}
+	}
+	status.Phase = v1alpha1.CloneRunning
+	status.Message = fmt.Sprintf("copying from %s with Job %s", status.Database, job.Name)
+	return nil
+}
+
+// startCloneJob creates the job roles on both servers, the Secret with
+// their connection strings and the Job copying the source into dbRes. The
+// Secret and the Job are owned by dbRes.
+func (r *DatabaseReconciler) startCloneJob(
+	ctx context.Context,
+	dbRes *v1alpha1.Database,
+	source *v1alpha1.Database,
+	adminUser string,
+	adminPassword string,
+	name string,
+) error {
+	sourceUser, sourcePassword, err := r.adminCredentials(ctx, source)
+	if err != nil {
+		return fmt.Errorf("source Database %s: %w", source.Name, err)
+	}
+	validUntil := time.Now().Add(r.JobDeadline)
+	targetRole, err := r.DatabaseService.NewJobRole(services.JobRoleName(dbRes, "_target"), validUntil, true)
+	if err != nil {
+		return err
+	}
+	sourceRole, err := r.DatabaseService.NewJobRole(services.JobRoleName(dbRes, "_source"), validUntil, false)
+	if err != nil {
+		return err
+	}
+	data, err := r.DatabaseService.CloneSecretData(ctx, dbRes, adminUser, adminPassword, targetRole,
+		source, sourceUser, sourcePassword, sourceRole)
+	if err != nil {
+		return err
+	}
+
+	job := services.CloneJob(dbRes, name, r.PGToolsImage, r.JobDeadline)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: dbRes.Namespace, Labels: job.Labels},
+		Data:       data,
+	}
+	if err := controllerutil.SetControllerReference(dbRes, secret, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.Create(ctx, secret); apierrors.IsAlreadyExists(err) {
+		// Left over from an attempt that failed to create the Job.
+		if err := r.Update(ctx, secret); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	if err := controllerutil.SetControllerReference(dbRes, job, r.Scheme); err != nil {
+		return err
+	}
+	if err := r.Create(ctx, job); err != nil {
+		return err
+	}
+
+	now := metav1.Now()
+	status := dbRes.Status.Source
+	status.Phase = v1alpha1.CloneRunning
+	status.Job = name
+	status.StartedAt = &now
+	status.Message = fmt.Sprintf("copying from %s with Job %s", status.Database, name)
+	return nil
+}
+
+// finishCloneJob drops the job roles of a finished copy Job, handing the
+// copied objects to the admin user, and deletes its Secret.
+func (r *DatabaseReconciler) finishCloneJob(
+	ctx context.Context,
+	dbRes *v1alpha1.Database,
+	source *v1alpha1.Database,
+	adminUser string,
+	adminPassword string,
+	name string,
+) error {
+	if err := r.DatabaseService.DropJobRole(ctx, dbRes, adminUser, adminPassword, services.JobRoleName(dbRes, "_target")); err != nil {
+		return fmt.Errorf("drop clone role: %w", err)
+	}
+	sourceUser, sourcePassword, err := r.adminCredentials(ctx, source)
+	if err != nil {
+		return fmt.Errorf("source Database %s: %w", source.Name, err)
+	}
+	if err := r.DatabaseService.DropJobRole(ctx, source, sourceUser, sourcePassword, services.JobRoleName(dbRes, "_source")); err != nil {
+		return fmt.Errorf("drop clone role on source: %w", err)
+	}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: dbRes.Namespace}}
+	return client.IgnoreNotFound(r.Delete(ctx, secret))
+}
+
+// setCloneCondition marks dbRes not ready while it waits for or copies its source.
+func setCloneCondition(dbRes *v1alpha1.Database, reason, message string) {
+	meta.SetStatusCondition(&dbRes.Status.Conditions, metav1.Condition{
+		Type:               v1alpha1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: dbRes.Generation,
+	})
+}
+
+// databasesForSource maps a Database to the Databases copying it.
+func (r *DatabaseReconciler) databasesForSource(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list v1alpha1.DatabaseList
+	if err := r.List(ctx, &list, client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{sourceDatabaseRefNameField: obj.GetName()}); err != nil {
+		r.Log.Error(err, "failed to list Databases for source", "source", obj.GetName())
+		return nil
+	}
+
+	var reqs []reconcile.Request
+	for _, item := range list.Items {
+		if !item.Cloning() {
+			continue
+		}
+		reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{
+			Name:      item.Name,
+			Namespace: item.Namespace,
+		}})
+	}
+	return reqs
+}
@@ -2,18 +2,31 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/audit"
+	"github.com/mertsaygi/orchestrdb/src/credentials"
+	"github.com/mertsaygi/orchestrdb/src/db"
 	"github.com/mertsaygi/orchestrdb/src/services"
 
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 // DatabaseReconciler reconciles Database custom resources
@@ -22,6 +35,28 @@ type DatabaseReconciler struct {
 	Scheme          *runtime.Scheme
 	Log             logr.Logger
 	DatabaseService *services.DatabaseService
+
+	// Vault is used for adminVaultRef; nil when no Vault server is configured.
+	Vault credentials.Provider
+
+	// VaultPaths restricts the Vault paths of adminVaultRef.
+	VaultPaths *services.VaultPathPolicy
+
+	// Recorder emits drift Events.
+	Recorder record.EventRecorder
+
+	// ResyncInterval is how often a reconciled Database is checked for drift.
+	// Zero disables periodic resync.
+	ResyncInterval time.Duration
+
+	// DryRun plans every Database as if spec.dryRun was set.
+	DryRun bool
+
+	// PGToolsImage is the image with pg_dump/pg_restore used by Jobs.
+	PGToolsImage string
+
+	// JobDeadline bounds how long a clone Job and its roles live.
+	JobDeadline time.Duration
 }
 
 // Reconcile is called when a Database resource changes or is periodically requeued.
@@ -34,95 +69,176 @@ func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	// If the resource is being deleted, we currently do nothing.
-	if !dbRes.ObjectMeta.DeletionTimestamp.IsZero() {
-		// TODO: add optional cleanup logic (e.g., drop database) if desired.
+	// With deletionPolicy Delete the finalizer keeps the resource until the
+	// database is dropped; otherwise deletion leaves the server alone.
+	if err := syncCleanupFinalizer(ctx, r.Client, &dbRes, dbRes.Spec.DeletionPolicy); err != nil {
+		return ctrl.Result{}, err
+	}
+	deleting := !dbRes.ObjectMeta.DeletionTimestamp.IsZero()
+	if deleting && !controllerutil.ContainsFinalizer(&dbRes, v1alpha1.FinalizerCleanup) {
+		return ctrl.Result{}, nil
+	}
+
+	// Attribute every statement executed below to this resource.
+	ctx = audit.WithSubject(ctx, audit.Subject{
+		Kind:       "Database",
+		Namespace:  dbRes.Namespace,
+		Name:       dbRes.Name,
+		Generation: dbRes.Generation,
+	})
+
+	// Paused resources are left alone entirely; the annotation change that
+	// resumes them triggers a new reconcile.
+	if applyPause(&dbRes, &dbRes.Status.Conditions) {
+		log.Info("reconciliation paused")
+		if err := r.Status().Update(ctx, &dbRes); err != nil {
+			return ctrl.Result{}, err
+		}
 		return ctrl.Result{}, nil
 	}
 
+	// Decide before echoing the force-reconcile request below. A dry run
+	// never repairs drift, so it always plans the full spec.
+	dryRun := r.DryRun || dbRes.Spec.DryRun
+	checkDrift := !dryRun && verifyOnly(&dbRes, dbRes.Status.Conditions, dbRes.Status.LastHandledReconcileAt) &&
+		!r.DatabaseService.InitSQLPending(ctx, &dbRes)
+
+	// Echo a force-reconcile request; every status update below carries it.
+	dbRes.Status.LastHandledReconcileAt = reconcileRequestedAt(&dbRes)
+
 	// -------------------------------------------------------------------------
-	// Resolve admin credentials:
-	//   1. Start from inline spec fields (AdminUser/AdminPassword)
-	//   2. If adminSecretRef is set, override from Secret
+	// Resolve admin credentials
 	// -------------------------------------------------------------------------
-	adminUser := dbRes.Spec.AdminUser
-	adminPassword := dbRes.Spec.AdminPassword
-
-	if dbRes.Spec.AdminSecretRef != nil {
-		secRef := dbRes.Spec.AdminSecretRef
-
-		var secret corev1.Secret
-		if err := r.Get(ctx, types.NamespacedName{
-			Name:      secRef.Name,
-			Namespace: dbRes.Namespace, // Secret is expected to live in the same namespace
-		}, &secret); err != nil {
-
-			// Secret Provider / ExternalSecrets henüz yaratmadıysa: fatal değil, bekle.
-			if apierrors.IsNotFound(err) {
-				msg := "waiting for adminSecretRef Secret to be created"
-				dbRes.Status.Created = false
-				dbRes.Status.LastError = msg
-				dbRes.Status.UpdatedAt = time.Now().Format(time.RFC3339)
-				_ = r.Status().Update(ctx, &dbRes)
-
-				log.Info(msg,
-					"secret", secRef.Name,
-					"namespace", dbRes.Namespace)
-
-				// Just requeue, do not treat this as a hard error.
-				return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
-			}
+	adminUser, adminPassword, err := r.adminCredentials(ctx, &dbRes)
+	if err != nil {
+		dbRes.Status.Created = false
+		dbRes.Status.LastError = err.Error()
+		dbRes.Status.UpdatedAt = time.Now().Format(time.RFC3339)
+		_ = r.Status().Update(ctx, &dbRes)
 
-			// Other errors (RBAC, network, etc.) are real errors.
-			msg := "failed to get adminSecretRef Secret: " + err.Error()
-			dbRes.Status.Created = false
-			dbRes.Status.LastError = msg
-			dbRes.Status.UpdatedAt = time.Now().Format(time.RFC3339)
-			_ = r.Status().Update(ctx, &dbRes)
+		if apierrors.IsNotFound(err) {
+			// Not a hard error: the admin Secret watch requeues us once it appears.
+			log.Info("waiting for adminSecretRef Secret to be created", "reason", err.Error())
+			return ctrl.Result{}, nil
+		}
+		if errors.Is(err, services.ErrReferenceNotPermitted) {
+			// The CredentialGrant watch requeues us once a grant appears.
+			log.Error(err, "adminSecretRef not permitted")
+			return ctrl.Result{}, nil
+		}
 
-			log.Error(err, "failed to get adminSecretRef Secret",
-				"secret", secRef.Name,
-				"namespace", dbRes.Namespace)
+		log.Error(err, "failed to resolve admin credentials")
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
 
-			return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
-		}
+	if deleting {
+		return r.finalize(ctx, log, &dbRes, adminUser, adminPassword, dryRun)
+	}
 
-		userBytes, ok := secret.Data[secRef.UserKey]
-		if !ok {
-			msg := "userKey not found in adminSecretRef Secret"
-			dbRes.Status.Created = false
-			dbRes.Status.LastError = msg
-			dbRes.Status.UpdatedAt = time.Now().Format(time.RFC3339)
-			_ = r.Status().Update(ctx, &dbRes)
+	// -------------------------------------------------------------------------
+	// Pick a server from the placement pool once and pin it before anything
+	// is created, so the database never moves. A dry run pins it as well so
+	// the plan matches what a later run does.
+	// -------------------------------------------------------------------------
+	if dbRes.Spec.Placement != nil && dbRes.Status.Server == nil {
+		server, err := r.DatabaseService.PlaceDatabase(ctx, &dbRes, adminUser, adminPassword)
+		if err != nil {
+			log.Error(err, "placement failed", "category", db.CategoryOf(err))
+			if err := r.Status().Update(ctx, &dbRes); err != nil {
+				return ctrl.Result{}, err
+			}
+			return resultForAdapterError(err, r.ResyncInterval)
+		}
 
-			log.Error(nil, msg, "secret", secRef.Name, "key", secRef.UserKey)
-			return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+		dbRes.Status.Server = server
+		if err := r.Status().Update(ctx, &dbRes); err != nil {
+			return ctrl.Result{}, err
 		}
+		log.Info("placed database", "host", server.Host, "port", server.Port)
+		r.Recorder.Eventf(&dbRes, corev1.EventTypeNormal, v1alpha1.ReasonPlaced,
+			"placed on %s:%d", server.Host, server.Port)
+	}
 
-		passBytes, ok := secret.Data[secRef.PasswordKey]
-		if !ok {
-			msg := "passwordKey not found in adminSecretRef Secret"
-			dbRes.Status.Created = false
-			dbRes.Status.LastError = msg
-			dbRes.Status.UpdatedAt = time.Now().Format(time.RFC3339)
-			_ = r.Status().Update(ctx, &dbRes)
+	// -------------------------------------------------------------------------
+	// Copy the database from spec.source once, before it is used
+	// -------------------------------------------------------------------------
+	if dbRes.Cloning() {
+		proceed, result, err := r.clone(ctx, log, &dbRes, adminUser, adminPassword, dryRun)
+		if !proceed {
+			return result, err
+		}
+	}
 
-			log.Error(nil, msg, "secret", secRef.Name, "key", secRef.PasswordKey)
-			return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	// -------------------------------------------------------------------------
+	// Dry run: record the statements instead of executing them
+	// -------------------------------------------------------------------------
+	if dryRun {
+		plan, err := r.DatabaseService.PlanDatabase(ctx, &dbRes, adminUser, adminPassword)
+		if err != nil {
+			log.Error(err, "dry run failed", "category", db.CategoryOf(err))
+			dbRes.Status.LastError = err.Error()
+		} else {
+			if !slices.Equal(plan, dbRes.Status.Plan) {
+				r.Recorder.Eventf(&dbRes, corev1.EventTypeNormal, v1alpha1.ReasonDryRun,
+					"%d statement(s) planned, see status.plan", len(plan))
+			}
+			dbRes.Status.LastError = ""
+			dbRes.Status.Plan = plan
+		}
+		dbRes.Status.UpdatedAt = time.Now().Format(time.RFC3339)
+		if err := r.Status().Update(ctx, &dbRes); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err != nil {
+			return resultForAdapterError(err, r.ResyncInterval)
 		}
+		return ctrl.Result{RequeueAfter: r.ResyncInterval}, nil
+	}
+	dbRes.Status.Plan = nil
 
-		adminUser = string(userBytes)
-		adminPassword = string(passBytes)
+	// -------------------------------------------------------------------------
+	// A resync of an already applied spec only checks the server. The spec
+	// is re-applied when drift is found, unless driftPolicy is Report.
+	// -------------------------------------------------------------------------
+	var drift []string
+	if checkDrift {
+		var err error
+		drift, err = r.DatabaseService.DetectDrift(ctx, &dbRes, adminUser, adminPassword)
+		if err != nil {
+			// EnsureDatabase below reports the failure in the Ready condition.
+			log.Error(err, "drift detection failed", "category", db.CategoryOf(err))
+		} else if len(drift) == 0 {
+			setDriftedCondition(&dbRes, &dbRes.Status.Conditions, v1alpha1.ReasonInSync, nil)
+			if err := r.Status().Update(ctx, &dbRes); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: r.ResyncInterval}, nil
+		} else if dbRes.Spec.DriftPolicy == v1alpha1.DriftPolicyReport {
+			log.Info("drift detected", "drift", drift)
+			setDriftedCondition(&dbRes, &dbRes.Status.Conditions, v1alpha1.ReasonDriftDetected, drift)
+			r.Recorder.Event(&dbRes, corev1.EventTypeWarning, v1alpha1.ReasonDriftDetected, strings.Join(drift, "; "))
+			if err := r.Status().Update(ctx, &dbRes); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: r.ResyncInterval}, nil
+		}
 	}
 
 	// -------------------------------------------------------------------------
 	// Call service layer to ensure database exists
 	// -------------------------------------------------------------------------
-	created, errMsg := r.DatabaseService.EnsureDatabase(ctx, &dbRes, adminUser, adminPassword)
-	if errMsg != "" {
-		log.Error(nil, "EnsureDatabase failed", "error", errMsg)
-	} else if created {
-		log.Info("Database ensured/created", "name", dbRes.Spec.Name)
+	created, ensureErr := r.DatabaseService.EnsureDatabase(ctx, &dbRes, adminUser, adminPassword)
+	if ensureErr != nil {
+		log.Error(ensureErr, "EnsureDatabase failed", "category", db.CategoryOf(ensureErr))
+	} else if len(drift) > 0 {
+		log.Info("drift repaired", "drift", drift)
+		setDriftedCondition(&dbRes, &dbRes.Status.Conditions, v1alpha1.ReasonDriftRepaired, drift)
+		r.Recorder.Event(&dbRes, corev1.EventTypeNormal, v1alpha1.ReasonDriftRepaired, strings.Join(drift, "; "))
+	} else {
+		if created {
+			log.Info("Database ensured/created", "name", dbRes.Spec.Name)
+		}
+		setDriftedCondition(&dbRes, &dbRes.Status.Conditions, v1alpha1.ReasonInSync, nil)
 	}
 
 	if err := r.Status().Update(ctx, &dbRes); err != nil {
@@ -130,17 +246,262 @@ func (r *DatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, err
 	}
 
-	if !created {
-		// If creation failed, requeue after a delay
-		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	if ensureErr != nil {
+		// Back off on transient failures, wait for a change on permanent ones
+		return resultForAdapterError(ensureErr, r.ResyncInterval)
 	}
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: r.ResyncInterval}, nil
+}
+
+// finalize drops the database of a Database deleted with deletionPolicy
+// Delete and releases the cleanup finalizer. A database the operator does
+// not manage is left in place with a warning. A dry run only records the
+// plan and keeps the finalizer until dry run or the policy is turned off.
+func (r *DatabaseReconciler) finalize(
+	ctx context.Context,
+	log logr.Logger,
+	dbRes *v1alpha1.Database,
+	adminUser string,
+	adminPassword string,
+	dryRun bool,
+) (ctrl.Result, error) {
+	if host, _ := dbRes.Server(); host == "" {
+		// The placement never picked a server, so nothing was created.
+		return ctrl.Result{}, releaseCleanupFinalizer(ctx, r.Client, dbRes)
+	}
+
+	if dryRun {
+		plan, err := r.DatabaseService.PlanDropDatabase(ctx, dbRes, adminUser, adminPassword)
+		if err != nil {
+			log.Error(err, "dry run of drop failed", "category", db.CategoryOf(err))
+			dbRes.Status.LastError = err.Error()
+		} else {
+			if !slices.Equal(plan, dbRes.Status.Plan) {
+				r.Recorder.Eventf(dbRes, corev1.EventTypeNormal, v1alpha1.ReasonDryRun,
+					"dropping the database needs %d statement(s), see status.plan", len(plan))
+			}
+			dbRes.Status.LastError = ""
+			dbRes.Status.Plan = plan
+		}
+		dbRes.Status.UpdatedAt = time.Now().Format(time.RFC3339)
+		if err := r.Status().Update(ctx, dbRes); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err != nil {
+			return resultForAdapterError(err, r.ResyncInterval)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	err := r.DatabaseService.DropDatabase(ctx, dbRes, adminUser, adminPassword)
+	switch {
+	case err == nil:
+		log.Info("database dropped", "name", dbRes.Spec.Name)
+		r.Recorder.Eventf(dbRes, corev1.EventTypeNormal, v1alpha1.ReasonDropped, "database %s dropped", dbRes.Spec.Name)
+	case db.CategoryOf(err) == db.CategoryConflict:
+		log.Info("database not dropped", "reason", err.Error())
+		r.Recorder.Event(dbRes, corev1.EventTypeWarning, v1alpha1.ReasonDropSkipped, err.Error())
+	default:
+		log.Error(err, "DropDatabase failed", "category", db.CategoryOf(err))
+		dbRes.Status.LastError = err.Error()
+		dbRes.Status.UpdatedAt = time.Now().Format(time.RFC3339)
+		if err := r.Status().Update(ctx, dbRes); err != nil {
+			return ctrl.Result{}, err
+		}
+		return resultForAdapterError(err, r.ResyncInterval)
+	}
+
+	return ctrl.Result{}, releaseCleanupFinalizer(ctx, r.Client, dbRes)
+}
+
+// adminCredentials resolves the admin user/password of dbRes:
+//  1. Start from inline spec fields (AdminUser/AdminPassword)
+//  2. If adminSecretRef is set, override from Secret
+//  3. If adminVaultRef is set, override from Vault
+//
+// A missing Secret is reported as a NotFound error.
+func (r *DatabaseReconciler) adminCredentials(ctx context.Context, dbRes *v1alpha1.Database) (string, string, error) {
+	return databaseAdminCredentials(ctx, r.Client, r.Vault, r.VaultPaths, dbRes)
+}
+
+// databaseAdminCredentials implements adminCredentials for controllers
+// connecting with the credentials of a Database they do not reconcile.
+func databaseAdminCredentials(
+	ctx context.Context,
+	c client.Client,
+	vault credentials.Provider,
+	vaultPaths *services.VaultPathPolicy,
+	dbRes *v1alpha1.Database,
+) (string, string, error) {
+	if vaultRef := dbRes.Spec.AdminVaultRef; vaultRef != nil && vaultRef.Path != "" {
+		if vault == nil {
+			return "", "", errors.New("adminVaultRef is set but no Vault server is configured")
+		}
+		if err := vaultPaths.CheckAdminPath(ctx, c, "Database", dbRes, vaultRef.Path); err != nil {
+			return "", "", err
+		}
+		adminUser, adminPassword, err := services.ReadAdminCredentials(ctx, vault, vaultRef.Path, vaultRef.UserKey, vaultRef.PasswordKey)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read adminVaultRef %s: %w", vaultRef.Path, err)
+		}
+		return adminUser, adminPassword, nil
+	}
+
+	secRef := dbRes.Spec.AdminSecretRef
+	if secRef == nil {
+		return dbRes.Spec.AdminUser, dbRes.Spec.AdminPassword, nil
+	}
+	secNs := adminSecretNamespace(dbRes)
+
+	if err := services.CheckSecretReference(ctx, c, "Database", dbRes, secNs, secRef.Name); err != nil {
+		return "", "", err
+	}
+
+	// A Secret provider / ExternalSecrets may not have created it yet: the
+	// NotFound error is kept so callers can wait for it.
+	var secret corev1.Secret
+	if err := c.Get(ctx, types.NamespacedName{Name: secRef.Name, Namespace: secNs}, &secret); err != nil {
+		return "", "", fmt.Errorf("failed to get adminSecretRef Secret %s/%s: %w", secNs, secRef.Name, err)
+	}
+
+	userBytes, ok := secret.Data[secRef.UserKey]
+	if !ok {
+		return "", "", fmt.Errorf("userKey %s not found in adminSecretRef Secret %s/%s", secRef.UserKey, secNs, secRef.Name)
+	}
+	passBytes, ok := secret.Data[secRef.PasswordKey]
+	if !ok {
+		return "", "", fmt.Errorf("passwordKey %s not found in adminSecretRef Secret %s/%s", secRef.PasswordKey, secNs, secRef.Name)
+	}
+	return string(userBytes), string(passBytes), nil
+}
+
+// adminSecretNamespace returns the namespace of the Database's admin Secret.
+func adminSecretNamespace(dbRes *v1alpha1.Database) string {
+	if dbRes.Spec.AdminSecretRef != nil && dbRes.Spec.AdminSecretRef.Namespace != "" {
+		return dbRes.Spec.AdminSecretRef.Namespace
+	}
+	return dbRes.Namespace
+}
+
+// databasesForAdminSecret maps an admin Secret to the Databases referencing it.
+// The index only holds the Secret name, so the referenced namespace is checked here.
+func (r *DatabaseReconciler) databasesForAdminSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list v1alpha1.DatabaseList
+	if err := r.List(ctx, &list, client.MatchingFields{adminSecretRefNameField: obj.GetName()}); err != nil {
+		r.Log.Error(err, "failed to list Databases for admin Secret", "secret", obj.GetName())
+		return nil
+	}
+
+	var reqs []reconcile.Request
+	for _, item := range list.Items {
+		if adminSecretNamespace(&item) != obj.GetNamespace() {
+			continue
+		}
+		reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{
+			Name:      item.Name,
+			Namespace: item.Namespace,
+		}})
+	}
+	return reqs
+}
+
+// databasesForInitSQL returns a map function from a ConfigMap or Secret to
+// the Databases whose spec.initSQL reads it.
+func (r *DatabaseReconciler) databasesForInitSQL(kind string) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		var list v1alpha1.DatabaseList
+		if err := r.List(ctx, &list, client.InNamespace(obj.GetNamespace()),
+			client.MatchingFields{initSQLSourceField: kind + "/" + obj.GetName()}); err != nil {
+			r.Log.Error(err, "failed to list Databases for initSQL", "kind", kind, "name", obj.GetName())
+			return nil
+		}
+
+		var reqs []reconcile.Request
+		for _, item := range list.Items {
+			reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{
+				Name:      item.Name,
+				Namespace: item.Namespace,
+			}})
+		}
+		return reqs
+	}
+}
+
+// databasesForCredentialGrant maps a CredentialGrant to the Databases in other
+// namespaces that reference Secrets in the grant's namespace.
+func (r *DatabaseReconciler) databasesForCredentialGrant(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list v1alpha1.DatabaseList
+	if err := r.List(ctx, &list); err != nil {
+		r.Log.Error(err, "failed to list Databases for CredentialGrant", "grant", obj.GetName())
+		return nil
+	}
+
+	var reqs []reconcile.Request
+	for _, item := range list.Items {
+		if item.Spec.AdminSecretRef == nil || item.Namespace == obj.GetNamespace() ||
+			adminSecretNamespace(&item) != obj.GetNamespace() {
+			continue
+		}
+		reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{
+			Name:      item.Name,
+			Namespace: item.Namespace,
+		}})
+	}
+	return reqs
 }
 
 // SetupWithManager registers the controller with the manager.
 func (r *DatabaseReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1alpha1.Database{}, adminSecretRefNameField,
+		func(obj client.Object) []string {
+			dbRes := obj.(*v1alpha1.Database)
+			if dbRes.Spec.AdminSecretRef == nil || dbRes.Spec.AdminSecretRef.Name == "" {
+				return nil
+			}
+			return []string{dbRes.Spec.AdminSecretRef.Name}
+		}); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1alpha1.Database{}, sourceDatabaseRefNameField,
+		func(obj client.Object) []string {
+			dbRes := obj.(*v1alpha1.Database)
+			if dbRes.Spec.Source == nil {
+				return nil
+			}
+			return []string{dbRes.Spec.Source.DatabaseRef.Name}
+		}); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1alpha1.Database{}, initSQLSourceField,
+		func(obj client.Object) []string {
+			dbRes := obj.(*v1alpha1.Database)
+			if dbRes.Spec.InitSQL == nil {
+				return nil
+			}
+			var sources []string
+			for _, script := range dbRes.Spec.InitSQL.Scripts {
+				if ref := script.ConfigMapKeyRef; ref != nil {
+					sources = append(sources, "ConfigMap/"+ref.Name)
+				}
+				if ref := script.SecretKeyRef; ref != nil {
+					sources = append(sources, "Secret/"+ref.Name)
+				}
+			}
+			return sources
+		}); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha1.Database{}).
+		WithOptions(controller.Options{RateLimiter: newRateLimiter()}).
+		Owns(&batchv1.Job{}).
+		Watches(&v1alpha1.Database{}, handler.EnqueueRequestsFromMapFunc(r.databasesForSource)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.databasesForAdminSecret)).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.databasesForInitSQL("ConfigMap"))).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.databasesForInitSQL("Secret"))).
+		Watches(&v1alpha1.CredentialGrant{}, handler.EnqueueRequestsFromMapFunc(r.databasesForCredentialGrant)).
+		Watches(&v1alpha1.DatabaseClaim{}, handler.EnqueueRequestsFromMapFunc(claimedObjectFor("Database"))).
 		Complete(r)
 }
@@ -0,0 +1,380 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/db"
+	"github.com/mertsaygi/orchestrdb/src/services"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// errClassNotFound is returned when a claim names no class and no class is
+// annotated as default, or more than one is.
+var errClassNotFound = errors.New("DatabaseClass not found")
+
+// errNotClaimed is returned when an object with the name of a claim's
+// Database or User exists but was not created for the claim.
+var errNotClaimed = errors.New("object exists and was not created for this DatabaseClaim")
+
+// DatabaseClaimReconciler provisions DatabaseClaims by composing a Database
+// and a User from the claim's DatabaseClass.
+type DatabaseClaimReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+func (r *DatabaseClaimReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	var claim v1alpha1.DatabaseClaim
+	if err := r.Get(ctx, req.NamespacedName, &claim); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// The Database and User are garbage collected with the claim, unless
+	// the cleanup finalizer makes the claim wait for them (see finalize).
+	if !claim.ObjectMeta.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(&claim, v1alpha1.FinalizerCleanup) {
+			return ctrl.Result{}, nil
+		}
+		return r.finalize(ctx, &claim)
+	}
+
+	// -----------------------------------------------------------------
+	// 1) Resolve the class. The claim stays bound to the class it was
+	//    first provisioned from.
+	// -----------------------------------------------------------------
+	if claim.Status.ClassName != "" && claim.Spec.ClassName != "" && claim.Spec.ClassName != claim.Status.ClassName {
+		msg := fmt.Sprintf("className cannot be changed from %s once the claim is bound", claim.Status.ClassName)
+		return r.updateStatus(ctx, &claim, v1alpha1.ClaimFailed, string(db.CategoryInvalidSpec), msg)
+	}
+
+	class, err := r.resolveClass(ctx, &claim)
+	if apierrors.IsNotFound(err) || errors.Is(err, errClassNotFound) {
+		// The DatabaseClass watch requeues us once the class appears.
+		logger.Info("waiting for DatabaseClass", "reason", err.Error())
+		return r.updateStatus(ctx, &claim, v1alpha1.ClaimPending, v1alpha1.ReasonClassNotFound, err.Error())
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if !class.AllowsNamespace(claim.Namespace) {
+		msg := fmt.Sprintf("DatabaseClass %s does not allow claims in namespace %s", class.Name, claim.Namespace)
+		return r.updateStatus(ctx, &claim, v1alpha1.ClaimFailed, v1alpha1.ReasonNamespaceNotAllowed, msg)
+	}
+
+	if err := syncCleanupFinalizer(ctx, r.Client, &claim, class.Spec.DeletionPolicy); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	// -----------------------------------------------------------------
+	// 2) Fix the names on first reconcile; later class changes do not
+	//    rename existing databases.
+	// -----------------------------------------------------------------
+	claim.Status.ClassName = class.Name
+	if claim.Status.DatabaseName == "" {
+		name, err := services.ClaimDatabaseName(class, &claim)
+		if err != nil {
+			logger.Error(err, "failed to render database name", "class", class.Name)
+			return r.updateStatus(ctx, &claim, v1alpha1.ClaimFailed, string(db.CategoryOf(err)), err.Error())
+		}
+		other, err := r.claimOf(ctx, name)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if other != nil {
+			msg := fmt.Sprintf("database name %s is already used by DatabaseClaim %s/%s", name, other.Namespace, other.Name)
+			return r.updateStatus(ctx, &claim, v1alpha1.ClaimFailed, string(db.CategoryConflict), msg)
+		}
+		claim.Status.DatabaseName = name
+		claim.Status.Username = services.ClaimUsername(name)
+	}
+	if claim.Status.SecretName == "" {
+		claim.Status.SecretName = services.ClaimSecretName(&claim)
+	}
+
+	// -----------------------------------------------------------------
+	// 3) Database first; the owner role needs the database to exist.
+	// -----------------------------------------------------------------
+	dbRes := &v1alpha1.Database{ObjectMeta: metav1.ObjectMeta{Name: claim.Name, Namespace: claim.Namespace}}
+	err = r.ensureClaimed(ctx, &claim, dbRes, &claim.Status.Database, func() {
+		dbRes.Spec = services.ClaimDatabaseSpec(class, &claim)
+	})
+	if err != nil {
+		return r.claimedError(ctx, &claim, "Database", err)
+	}
+	if !dbRes.Status.Created {
+		msg := "waiting for Database " + dbRes.Name
+		if dbRes.Status.LastError != "" {
+			msg += ": " + dbRes.Status.LastError
+		}
+		return r.updateStatus(ctx, &claim, v1alpha1.ClaimPending, v1alpha1.ReasonProvisioning, msg)
+	}
+
+	user := &v1alpha1.User{ObjectMeta: metav1.ObjectMeta{Name: claim.Name, Namespace: claim.Namespace}}
+	err = r.ensureClaimed(ctx, &claim, user, &claim.Status.User, func() {
+		user.Spec = services.ClaimUserSpec(class, &claim, dbRes)
+	})
+	if err != nil {
+		return r.claimedError(ctx, &claim, "User", err)
+	}
+	if !user.Status.Created {
+		msg := "waiting for User " + user.Name
+		if user.Status.LastError != "" {
+			msg += ": " + user.Status.LastError
+		}
+		return r.updateStatus(ctx, &claim, v1alpha1.ClaimPending, v1alpha1.ReasonProvisioning, msg)
+	}
+
+	msg := fmt.Sprintf("database %s with owner %s, credentials in Secret %s",
+		claim.Status.DatabaseName, claim.Status.Username, claim.Status.SecretName)
+	return r.updateStatus(ctx, &claim, v1alpha1.ClaimBound, v1alpha1.ReasonBound, msg)
+}
+
+// finalize deletes the claim's User and then its Database, waiting for each
+// to be gone, before releasing the cleanup finalizer. Otherwise the claim
+// would be gone first and they could no longer use the class's admin
+// Secret (see services.CheckSecretReference) to drop the role and database.
+func (r *DatabaseClaimReconciler) finalize(ctx context.Context, claim *v1alpha1.DatabaseClaim) (ctrl.Result, error) {
+	claimed := []struct {
+		obj client.Object
+		ref *v1alpha1.ClaimedObject
+	}{
+		{&v1alpha1.User{}, claim.Status.User},
+		{&v1alpha1.Database{}, claim.Status.Database},
+	}
+
+	for _, c := range claimed {
+		if c.ref == nil {
+			continue
+		}
+		err := r.Get(ctx, types.NamespacedName{Name: c.ref.Name, Namespace: claim.Namespace}, c.obj)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if c.obj.GetUID() != c.ref.UID {
+			continue
+		}
+
+		if c.obj.GetDeletionTimestamp().IsZero() {
+			uid := c.ref.UID
+			if err := r.Delete(ctx, c.obj, client.Preconditions{UID: &uid}); client.IgnoreNotFound(err) != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		// Owns() requeues the claim once the object is gone.
+		return ctrl.Result{}, nil
+	}
+
+	return ctrl.Result{}, releaseCleanupFinalizer(ctx, r.Client, claim)
+}
+
+// claimOf returns the DatabaseClaim, in any namespace, whose database is
+// named name, or nil.
+func (r *DatabaseClaimReconciler) claimOf(ctx context.Context, name string) (*v1alpha1.DatabaseClaim, error) {
+	var list v1alpha1.DatabaseClaimList
+	if err := r.List(ctx, &list); err != nil {
+		return nil, err
+	}
+	for i := range list.Items {
+		if list.Items[i].Status.DatabaseName == name {
+			return &list.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// resolveClass returns the class the claim is bound to, the class it names,
+// or the default class.
+func (r *DatabaseClaimReconciler) resolveClass(ctx context.Context, claim *v1alpha1.DatabaseClaim) (*v1alpha1.DatabaseClass, error) {
+	name := claim.Status.ClassName
+	if name == "" {
+		name = claim.Spec.ClassName
+	}
+
+	if name != "" {
+		var class v1alpha1.DatabaseClass
+		if err := r.Get(ctx, types.NamespacedName{Name: name}, &class); err != nil {
+			return nil, err
+		}
+		return &class, nil
+	}
+
+	var list v1alpha1.DatabaseClassList
+	if err := r.List(ctx, &list); err != nil {
+		return nil, err
+	}
+	var found *v1alpha1.DatabaseClass
+	for i := range list.Items {
+		if !list.Items[i].IsDefault() {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("%w: more than one default DatabaseClass", errClassNotFound)
+		}
+		found = &list.Items[i]
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%w: no className set and no default DatabaseClass", errClassNotFound)
+	}
+	return found, nil
+}
+
+// ensureClaimed creates obj for claim and records it in *claimed, or
+// updates it when it is the recorded object. apply sets the desired spec.
+// An existing object that is not the recorded one is never touched.
+func (r *DatabaseClaimReconciler) ensureClaimed(
+	ctx context.Context,
+	claim *v1alpha1.DatabaseClaim,
+	obj client.Object,
+	claimed **v1alpha1.ClaimedObject,
+	apply func(),
+) error {
+	err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj)
+	if apierrors.IsNotFound(err) {
+		apply()
+		if err := controllerutil.SetControllerReference(claim, obj, r.Scheme); err != nil {
+			return err
+		}
+		if err := r.Create(ctx, obj); err != nil {
+			return err
+		}
+
+		// The recorded UID lets the object use the class's admin Secret
+		// (see services.CheckSecretReference); record it right away.
+		*claimed = &v1alpha1.ClaimedObject{Name: obj.GetName(), UID: obj.GetUID()}
+		claim.Status.UpdatedAt = time.Now().Format(time.RFC3339)
+		return r.Status().Update(ctx, claim)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *claimed == nil || (*claimed).UID != obj.GetUID() {
+		return errNotClaimed
+	}
+
+	before := obj.DeepCopyObject()
+	apply()
+	if equality.Semantic.DeepEqual(before, obj) {
+		return nil
+	}
+	return r.Update(ctx, obj)
+}
+
+// claimedError reports a failure to create or update the claim's Database or User.
+func (r *DatabaseClaimReconciler) claimedError(ctx context.Context, claim *v1alpha1.DatabaseClaim, kind string, err error) (ctrl.Result, error) {
+	if errors.Is(err, errNotClaimed) {
+		msg := fmt.Sprintf("%s %s already exists and was not created for this claim; delete it or rename the claim", kind, claim.Name)
+		log.FromContext(ctx).Error(err, msg)
+		return r.updateStatus(ctx, claim, v1alpha1.ClaimFailed, string(db.CategoryConflict), msg)
+	}
+	return ctrl.Result{}, err
+}
+
+// updateStatus sets the phase and the Ready condition and writes the status.
+func (r *DatabaseClaimReconciler) updateStatus(
+	ctx context.Context,
+	claim *v1alpha1.DatabaseClaim,
+	phase v1alpha1.ClaimPhase,
+	reason string,
+	message string,
+) (ctrl.Result, error) {
+	status := metav1.ConditionFalse
+	if phase == v1alpha1.ClaimBound {
+		status = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(&claim.Status.Conditions, metav1.Condition{
+		Type:               v1alpha1.ConditionReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: claim.Generation,
+	})
+	claim.Status.Phase = phase
+	claim.Status.UpdatedAt = time.Now().Format(time.RFC3339)
+
+	if err := r.Status().Update(ctx, claim); err != nil {
+		return ctrl.Result{}, err
+	}
+	// Changes of the class, the Database or the User requeue the claim.
+	return ctrl.Result{}, nil
+}
+
+// claimsForClass maps a DatabaseClass to the claims bound to it, naming it,
+// or still looking for a default class.
+func (r *DatabaseClaimReconciler) claimsForClass(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list v1alpha1.DatabaseClaimList
+	if err := r.List(ctx, &list); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list DatabaseClaims for DatabaseClass", "class", obj.GetName())
+		return nil
+	}
+
+	var reqs []reconcile.Request
+	for _, item := range list.Items {
+		className := item.Status.ClassName
+		if className == "" {
+			className = item.Spec.ClassName
+		}
+		if className != "" && className != obj.GetName() {
+			continue
+		}
+		reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{
+			Name:      item.Name,
+			Namespace: item.Namespace,
+		}})
+	}
+	return reqs
+}
+
+// SetupWithManager registers the DatabaseClaim controller with the manager.
+func (r *DatabaseClaimReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.DatabaseClaim{}).
+		Owns(&v1alpha1.Database{}).
+		Owns(&v1alpha1.User{}).
+		Watches(&v1alpha1.DatabaseClass{}, handler.EnqueueRequestsFromMapFunc(r.claimsForClass)).
+		Complete(r)
+}
+
+// claimedObjectFor maps a DatabaseClaim to the object it created of the
+// given kind, so that object is reconciled again once the claim records it
+// (see services.CheckSecretReference).
+func claimedObjectFor(kind string) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		claim, ok := obj.(*v1alpha1.DatabaseClaim)
+		if !ok {
+			return nil
+		}
+		claimed := claim.Status.Database
+		if kind == "User" {
+			claimed = claim.Status.User
+		}
+		if claimed == nil {
+			return nil
+		}
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{
+			Name:      claimed.Name,
+			Namespace: claim.Namespace,
+		}}}
+	}
+}
@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"context"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// syncCleanupFinalizer adds the cleanup finalizer when policy is Delete and
+// removes it otherwise. A finalizer cannot be added to an object that is
+// already being deleted, so only removal happens then.
+func syncCleanupFinalizer(ctx context.Context, c client.Client, obj client.Object, policy v1alpha1.DeletionPolicy) error {
+	var changed bool
+	if policy == v1alpha1.DeletionPolicyDelete {
+		if obj.GetDeletionTimestamp().IsZero() {
+			changed = controllerutil.AddFinalizer(obj, v1alpha1.FinalizerCleanup)
+		}
+	} else {
+		changed = controllerutil.RemoveFinalizer(obj, v1alpha1.FinalizerCleanup)
+	}
+	if !changed {
+		return nil
+	}
+	return c.Update(ctx, obj)
+}
+
+// releaseCleanupFinalizer removes the cleanup finalizer once the cleanup is
+// done, letting the deletion of obj complete.
+func releaseCleanupFinalizer(ctx context.Context, c client.Client, obj client.Object) error {
+	if !controllerutil.RemoveFinalizer(obj, v1alpha1.FinalizerCleanup) {
+		return nil
+	}
+	return c.Update(ctx, obj)
+}
@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"strings"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// verifyOnly reports whether the current generation was already applied
+// successfully, so that a reconcile (usually a periodic resync) only has to
+// check the server for drift. A pending force-reconcile request always
+// re-applies the spec.
+func verifyOnly(obj metav1.Object, conditions []metav1.Condition, lastHandledReconcileAt string) bool {
+	if reconcileRequestedAt(obj) != lastHandledReconcileAt {
+		return false
+	}
+	ready := meta.FindStatusCondition(conditions, v1alpha1.ConditionReady)
+	return ready != nil && ready.Status == metav1.ConditionTrue && ready.ObservedGeneration == obj.GetGeneration()
+}
+
+// setDriftedCondition records the outcome of a drift check. The condition is
+// only True for ReasonDriftDetected, i.e. while drift is left in place.
+func setDriftedCondition(obj metav1.Object, conditions *[]metav1.Condition, reason string, drift []string) {
+	cond := metav1.Condition{
+		Type:               v1alpha1.ConditionDrifted,
+		Status:             metav1.ConditionFalse,
+		Reason:             reason,
+		Message:            "server matches the spec",
+		ObservedGeneration: obj.GetGeneration(),
+	}
+	if len(drift) > 0 {
+		cond.Message = strings.Join(drift, "; ")
+	}
+	if reason == v1alpha1.ReasonDriftDetected {
+		cond.Status = metav1.ConditionTrue
+	}
+	meta.SetStatusCondition(conditions, cond)
+}
@@ -0,0 +1,244 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/services"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// errGeneratedSecretNotOwned is returned when the generated credentials
+// location is already taken by something the operator did not create.
+var errGeneratedSecretNotOwned = errors.New("generatedSecret already exists; refusing to overwrite")
+
+// generatedSecretStore is where the operator keeps the generated
+// username/password of a User.
+type generatedSecretStore interface {
+	// load returns the stored password and whether it exists. It returns
+	// errGeneratedSecretNotOwned if the location belongs to someone else.
+	load(ctx context.Context) (string, bool, error)
+
+	// save stores username/password for the first time.
+	save(ctx context.Context, password string) error
+}
+
+// newGeneratedSecretStore picks the store configured in spec.generatedSecret.
+func (r *UserReconciler) newGeneratedSecretStore(user *v1alpha1.User) generatedSecretStore {
+	if user.Spec.GeneratedSecret.VaultPath != "" {
+		return &vaultSecretStore{userService: r.UserService, user: user}
+	}
+	return &kubernetesSecretStore{client: r.Client, scheme: r.Scheme, user: user}
+}
+
+// kubernetesSecretStore keeps credentials in a Kubernetes Secret owned by the User.
+type kubernetesSecretStore struct {
+	client client.Client
+	scheme *runtime.Scheme
+	user   *v1alpha1.User
+}
+
+func (s *kubernetesSecretStore) key() types.NamespacedName {
+	ns := s.user.Spec.GeneratedSecret.Namespace
+	if ns == "" {
+		ns = s.user.Namespace
+	}
+	return types.NamespacedName{Name: s.user.Spec.GeneratedSecret.Name, Namespace: ns}
+}
+
+// load also keeps the labels/annotations of an existing Secret in sync with the spec.
+func (s *kubernetesSecretStore) load(ctx context.Context) (string, bool, error) {
+	var existing corev1.Secret
+	if err := s.client.Get(ctx, s.key(), &existing); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	if !isGeneratedSecretOwnedBy(&existing, s.user) {
+		if !s.adopts(&existing) {
+			return "", false, errGeneratedSecretNotOwned
+		}
+		return s.claim(ctx, &existing)
+	}
+
+	if syncGeneratedSecretMetadata(&existing, s.user) {
+		if err := s.client.Update(ctx, &existing); err != nil {
+			return "", false, err
+		}
+	}
+
+	return string(existing.Data["password"]), true, nil
+}
+
+// adopts reports whether secret is the adoption password Secret, which is
+// taken over as generated Secret instead of being refused.
+func (s *kubernetesSecretStore) adopts(secret *corev1.Secret) bool {
+	adoption := s.user.Spec.Adoption
+	return adoption != nil && adoption.Enabled && adoption.PasswordSecretRef != nil &&
+		adoption.PasswordSecretRef.Name == secret.Name && secret.Namespace == s.user.Namespace
+}
+
+// claim takes over an existing Secret holding the current password of an
+// adopted role: it gains the username/password keys, the tracking labels
+// and the owner reference of a generated Secret.
+func (s *kubernetesSecretStore) claim(ctx context.Context, secret *corev1.Secret) (string, bool, error) {
+	key := s.user.Spec.Adoption.PasswordSecretRef.Key
+	if key == "" {
+		key = "password"
+	}
+	password := string(secret.Data[key])
+	if password == "" {
+		return "", false, fmt.Errorf("key %q not found in adoption.passwordSecretRef Secret %s", key, secret.Name)
+	}
+
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	secret.Data["username"] = []byte(s.user.Spec.Username)
+	secret.Data["password"] = []byte(password)
+	syncGeneratedSecretMetadata(secret, s.user)
+	if err := controllerutil.SetControllerReference(s.user, secret, s.scheme); err != nil {
+		return "", false, err
+	}
+
+	if err := s.client.Update(ctx, secret); err != nil {
+		return "", false, err
+	}
+	return password, true, nil
+}
+
+func (s *kubernetesSecretStore) save(ctx context.Context, password string) error {
+	key := s.key()
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+		},
+		Type:       corev1.SecretTypeOpaque,
+		StringData: services.GeneratedCredentials(s.user, password),
+	}
+	syncGeneratedSecretMetadata(secret, s.user)
+
+	// Owner references cannot cross namespaces; the UID recorded in the
+	// status covers that case.
+	if key.Namespace == s.user.Namespace {
+		if err := controllerutil.SetControllerReference(s.user, secret, s.scheme); err != nil {
+			return err
+		}
+	}
+
+	if err := s.client.Create(ctx, secret); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			// Safety: in case of race, behave like "already exists" semantics
+			return errGeneratedSecretNotOwned
+		}
+		return err
+	}
+	if key.Namespace != s.user.Namespace {
+		s.user.Status.GeneratedSecretUID = string(secret.UID)
+	}
+	return nil
+}
+
+// vaultSecretStore keeps credentials in a Vault KV v2 secret.
+type vaultSecretStore struct {
+	userService *services.UserService
+	user        *v1alpha1.User
+}
+
+// load treats an existing Vault secret as ours when its custom_metadata
+// records the UID of the User; KV v2 has no owner references to check
+// against, and the data itself is whatever was written there.
+func (s *vaultSecretStore) load(ctx context.Context) (string, bool, error) {
+	data, found, err := s.userService.ReadGeneratedVaultSecret(ctx, s.user)
+	if err != nil || !found {
+		return "", false, err
+	}
+	owner, err := s.userService.GeneratedVaultSecretOwner(ctx, s.user)
+	if err != nil {
+		return "", false, err
+	}
+	if owner == "" || owner != string(s.user.UID) {
+		return "", false, errGeneratedSecretNotOwned
+	}
+	return data["password"], true, nil
+}
+
+// save refuses a path whose metadata already records another owner, even
+// when no data has been written there yet.
+func (s *vaultSecretStore) save(ctx context.Context, password string) error {
+	owner, err := s.userService.GeneratedVaultSecretOwner(ctx, s.user)
+	if err != nil {
+		return err
+	}
+	if owner != "" && owner != string(s.user.UID) {
+		return errGeneratedSecretNotOwned
+	}
+	return s.userService.WriteGeneratedVaultSecret(ctx, s.user, password)
+}
+
+// isGeneratedSecretOwnedBy reports whether secret was created by the operator
+// for user: in the User's namespace it must be controlled by the User (the
+// owner reference carries its UID), elsewhere its UID must be the one
+// recorded in status.generatedSecretUID. Tracking labels alone are not
+// enough, since anyone able to create the Secret can set them.
+func isGeneratedSecretOwnedBy(secret *corev1.Secret, user *v1alpha1.User) bool {
+	if secret.Namespace == user.Namespace {
+		return metav1.IsControlledBy(secret, user)
+	}
+	return user.Status.GeneratedSecretUID != "" && string(secret.UID) == user.Status.GeneratedSecretUID
+}
+
+// syncGeneratedSecretMetadata applies the configured and tracking labels and
+// the configured annotations to secret. It reports whether anything changed.
+func syncGeneratedSecretMetadata(secret *corev1.Secret, user *v1alpha1.User) bool {
+	changed := false
+
+	labels := secret.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	want := map[string]string{}
+	for k, v := range user.Spec.GeneratedSecret.Labels {
+		want[k] = v
+	}
+	// Tracking labels always win over user-provided ones.
+	want[v1alpha1.LabelManagedBy] = v1alpha1.ManagedByValue
+	want[v1alpha1.LabelOwnerKind] = "User"
+	want[v1alpha1.LabelOwnerName] = user.Name
+	want[v1alpha1.LabelOwnerNamespace] = user.Namespace
+	for k, v := range want {
+		if labels[k] != v {
+			labels[k] = v
+			changed = true
+		}
+	}
+	secret.SetLabels(labels)
+
+	if len(user.Spec.GeneratedSecret.Annotations) > 0 {
+		annotations := secret.GetAnnotations()
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		for k, v := range user.Spec.GeneratedSecret.Annotations {
+			if annotations[k] != v {
+				annotations[k] = v
+				changed = true
+			}
+		}
+		secret.SetAnnotations(annotations)
+	}
+
+	return changed
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/credentials"
+	"github.com/mertsaygi/orchestrdb/src/services"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// memoryVault is an in-memory credentials.MetadataProvider.
+type memoryVault struct {
+	data     map[string]map[string]string
+	metadata map[string]map[string]string
+}
+
+func (v *memoryVault) Read(_ context.Context, path string) (map[string]string, error) {
+	data, ok := v.data[path]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", credentials.ErrNotFound, path)
+	}
+	return data, nil
+}
+
+func (v *memoryVault) Write(_ context.Context, path string, data map[string]string) error {
+	v.data[path] = data
+	return nil
+}
+
+func (v *memoryVault) ReadMetadata(_ context.Context, path string) (map[string]string, error) {
+	return v.metadata[path], nil
+}
+
+func (v *memoryVault) WriteMetadata(_ context.Context, path string, metadata map[string]string) error {
+	v.metadata[path] = metadata
+	return nil
+}
+
+func TestVaultSecretStore(t *testing.T) {
+	const path = "secret/orchestrdb/app/alice"
+	user := &v1alpha1.User{
+		ObjectMeta: metav1.ObjectMeta{Name: "alice", Namespace: "app", UID: types.UID("alice-uid")},
+		Spec: v1alpha1.UserSpec{
+			Username:        "alice",
+			GeneratedSecret: v1alpha1.GeneratedSecret{VaultPath: path},
+		},
+	}
+	owned := func(uid string) map[string]string {
+		return map[string]string{services.VaultMetadataOwnerUID: uid}
+	}
+	credentialsOf := map[string]string{"username": "alice", "password": "secret"}
+
+	tests := []struct {
+		name      string
+		data      map[string]string
+		metadata  map[string]string
+		wantFound bool
+		wantErr   bool // errGeneratedSecretNotOwned
+	}{
+		{name: "nothing stored"},
+		{name: "ours", data: credentialsOf, metadata: owned("alice-uid"), wantFound: true},
+		{name: "no marker", data: credentialsOf, wantErr: true},
+		{name: "other User", data: credentialsOf, metadata: owned("bob-uid"), wantErr: true},
+		{name: "marker of another User without data", metadata: owned("bob-uid")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vault := &memoryVault{data: map[string]map[string]string{}, metadata: map[string]map[string]string{}}
+			if tt.data != nil {
+				vault.data[path] = tt.data
+			}
+			if tt.metadata != nil {
+				vault.metadata[path] = tt.metadata
+			}
+			paths, err := services.NewVaultPathPolicy("")
+			if err != nil {
+				t.Fatal(err)
+			}
+			store := &vaultSecretStore{
+				userService: services.NewUserService(nil, nil, vault, paths, v1alpha1.PasswordPolicy{}),
+				user:        user,
+			}
+
+			password, found, err := store.load(context.Background())
+			if tt.wantErr {
+				if !errors.Is(err, errGeneratedSecretNotOwned) {
+					t.Fatalf("load() error = %v, want errGeneratedSecretNotOwned", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if found != tt.wantFound || (found && password != "secret") {
+				t.Errorf("load() = %q, %v; want found %v", password, found, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestVaultSecretStoreSave(t *testing.T) {
+	const path = "secret/orchestrdb/app/alice"
+	user := &v1alpha1.User{
+		ObjectMeta: metav1.ObjectMeta{Name: "alice", Namespace: "app", UID: types.UID("alice-uid")},
+		Spec: v1alpha1.UserSpec{
+			Username:        "alice",
+			GeneratedSecret: v1alpha1.GeneratedSecret{VaultPath: path},
+		},
+	}
+	paths, err := services.NewVaultPathPolicy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vault := &memoryVault{data: map[string]map[string]string{}, metadata: map[string]map[string]string{}}
+	store := &vaultSecretStore{
+		userService: services.NewUserService(nil, nil, vault, paths, v1alpha1.PasswordPolicy{}),
+		user:        user,
+	}
+	if err := store.save(context.Background(), "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if uid := vault.metadata[path][services.VaultMetadataOwnerUID]; uid != "alice-uid" {
+		t.Errorf("owner UID = %q, want alice-uid", uid)
+	}
+	if password, found, err := store.load(context.Background()); err != nil || !found || password != "secret" {
+		t.Errorf("load() after save = %q, %v, %v", password, found, err)
+	}
+
+	vault.metadata[path] = map[string]string{services.VaultMetadataOwnerUID: "bob-uid"}
+	delete(vault.data, path)
+	if err := store.save(context.Background(), "secret"); !errors.Is(err, errGeneratedSecretNotOwned) {
+		t.Errorf("save() over another User's marker error = %v, want errGeneratedSecretNotOwned", err)
+	}
+}
@@ -0,0 +1,38 @@
+package controllers
+
+// adminSecretRefNameField indexes Database and User objects by the name of the
+// Secret referenced in spec.adminSecretRef, so that admin Secret changes can be
+// mapped back to the resources that depend on them.
+const adminSecretRefNameField = ".spec.adminSecretRef.name"
+
+// sourceDatabaseRefNameField indexes Database objects by the Database named
+// in spec.source, so that a source becoming ready requeues its copies.
+const sourceDatabaseRefNameField = ".spec.source.databaseRef.name"
+
+// backupDatabaseRefNameField indexes Backup objects by the Database named in
+// spec.databaseRef, so that a Database becoming ready starts its Backups.
+const backupDatabaseRefNameField = ".spec.databaseRef.name"
+
+// restoreDatabaseRefNameField indexes Restore objects by the Database named
+// in spec.databaseRef, so that a Database becoming ready starts its Restores.
+const restoreDatabaseRefNameField = ".spec.databaseRef.name"
+
+// restoreBackupRefNameField indexes Restore objects by the Backup named in
+// spec.backupRef, so that a Backup completing starts its Restores.
+const restoreBackupRefNameField = ".spec.backupRef.name"
+
+// migrationDatabaseRefNameField indexes Migration objects by the Database
+// named in spec.databaseRef, so that a Database becoming ready migrates it.
+const migrationDatabaseRefNameField = ".spec.databaseRef.name"
+
+// migrationMigratorRefNameField indexes Migration objects by the User named
+// in spec.migratorRef, so that the migrator role being created migrates.
+const migrationMigratorRefNameField = ".spec.migratorRef.name"
+
+// migrationSourceField indexes Migration objects by the ConfigMap or Secret
+// of spec.source as "<kind>/<name>", so that changed files are applied.
+const migrationSourceField = ".spec.source"
+
+// initSQLSourceField indexes Database objects by the ConfigMaps and Secrets
+// of spec.initSQL as "<kind>/<name>", so that changed scripts can run again.
+const initSQLSourceField = ".spec.initSQL.scripts"
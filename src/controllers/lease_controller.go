@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// LeaseReconciler deletes Databases or DatabaseClaims whose lease (spec.ttl
+// or spec.expiresAt) has expired, warning ahead of time. What happens on
+// the server is up to the deletion policy. It runs as a separate controller
+// per kind so expiry works without a connection to the database server.
+type LeaseReconciler struct {
+	client.Client
+
+	// Object is an empty Database or DatabaseClaim; it selects the kind.
+	Object client.Object
+
+	// Recorder emits ExpiringSoon, Expired and LeaseExtended Events.
+	Recorder record.EventRecorder
+
+	// WarningWindow is how long before expiry the ExpiringSoon warning is emitted.
+	WarningWindow time.Duration
+}
+
+// leaseOf returns the lease of obj and a pointer to its lease status.
+func leaseOf(obj client.Object) (v1alpha1.Lease, **v1alpha1.LeaseStatus) {
+	switch o := obj.(type) {
+	case *v1alpha1.Database:
+		return o.Spec.Lease, &o.Status.Lease
+	case *v1alpha1.DatabaseClaim:
+		return o.Spec.Lease, &o.Status.Lease
+	default:
+		panic(fmt.Sprintf("no lease on %T", obj))
+	}
+}
+
+func (r *LeaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	obj := r.Object.DeepCopyObject().(client.Object)
+	if err := r.Get(ctx, req.NamespacedName, obj); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !obj.GetDeletionTimestamp().IsZero() || isPaused(obj) {
+		return ctrl.Result{}, nil
+	}
+
+	lease, status := leaseOf(obj)
+	before := (*status).DeepCopy()
+
+	expiry := lease.Expiry(obj.GetCreationTimestamp().Time)
+	if expiry == nil {
+		// The lease was removed: the resource lives on.
+		if *status == nil {
+			return ctrl.Result{}, nil
+		}
+		*status = nil
+		return ctrl.Result{}, r.Status().Update(ctx, obj)
+	}
+	if *status == nil {
+		*status = &v1alpha1.LeaseStatus{}
+	}
+	st := *status
+
+	now := time.Now()
+
+	// -----------------------------------------------------------------
+	// 1) Apply an extend-lease request. The extension is stored before
+	//    the annotation is removed, so it is never lost.
+	// -----------------------------------------------------------------
+	value, extend := obj.GetAnnotations()[v1alpha1.AnnotationExtendLease]
+	if extend {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			r.Recorder.Eventf(obj, corev1.EventTypeWarning, v1alpha1.ReasonLeaseExtended,
+				"ignoring %s annotation %q: not a positive duration", v1alpha1.AnnotationExtendLease, value)
+		} else {
+			until := now.Add(d).Truncate(time.Second)
+			if st.ExtendedUntil == nil || until.After(st.ExtendedUntil.Time) {
+				st.ExtendedUntil = &metav1.Time{Time: until}
+			}
+			logger.Info("lease extended", "until", st.ExtendedUntil.Time)
+			r.Recorder.Eventf(obj, corev1.EventTypeNormal, v1alpha1.ReasonLeaseExtended,
+				"lease extended until %s", st.ExtendedUntil.UTC().Format(time.RFC3339))
+		}
+	}
+
+	// Status times are stored with second precision; compare at that precision.
+	expiresAt := expiry.Truncate(time.Second)
+	if st.ExtendedUntil != nil && st.ExtendedUntil.After(expiresAt) {
+		expiresAt = st.ExtendedUntil.Time
+	}
+	st.ExpiresAt = &metav1.Time{Time: expiresAt}
+
+	// -----------------------------------------------------------------
+	// 2) Delete an expired resource, warn about one expiring soon.
+	// -----------------------------------------------------------------
+	if !now.Before(expiresAt) {
+		logger.Info("lease expired, deleting", "expiresAt", expiresAt)
+		r.Recorder.Eventf(obj, corev1.EventTypeWarning, v1alpha1.ReasonExpired,
+			"lease expired at %s; deleting", expiresAt.UTC().Format(time.RFC3339))
+		uid := obj.GetUID()
+		return ctrl.Result{}, client.IgnoreNotFound(r.Delete(ctx, obj, client.Preconditions{UID: &uid}))
+	}
+
+	warnAt := expiresAt.Add(-r.WarningWindow)
+	warned := st.WarnedFor != nil && st.WarnedFor.Equal(st.ExpiresAt)
+	if !warned && !now.Before(warnAt) {
+		r.Recorder.Eventf(obj, corev1.EventTypeWarning, v1alpha1.ReasonExpiringSoon,
+			"lease expires at %s; set the %s annotation (e.g. \"24h\") to extend it",
+			expiresAt.UTC().Format(time.RFC3339), v1alpha1.AnnotationExtendLease)
+		st.WarnedFor = st.ExpiresAt.DeepCopy()
+		warned = true
+	}
+
+	if !equality.Semantic.DeepEqual(before, st) {
+		if err := r.Status().Update(ctx, obj); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if extend {
+		annotations := obj.GetAnnotations()
+		delete(annotations, v1alpha1.AnnotationExtendLease)
+		obj.SetAnnotations(annotations)
+		if err := r.Update(ctx, obj); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// Come back for the warning or the expiry, whichever is next.
+	next := expiresAt
+	if !warned {
+		next = warnAt
+	}
+	return ctrl.Result{RequeueAfter: time.Until(next)}, nil
+}
+
+// SetupWithManager registers the lease controller for r.Object's kind. Only
+// spec and annotation changes matter; status updates are ignored.
+func (r *LeaseReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	gvk, err := apiutil.GVKForObject(r.Object, mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		Named(strings.ToLower(gvk.Kind)+"-lease").
+		For(r.Object, builder.WithPredicates(predicate.Or(
+			predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
+		Complete(r)
+}
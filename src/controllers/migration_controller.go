@@ -0,0 +1,423 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/credentials"
+	"github.com/mertsaygi/orchestrdb/src/db"
+	"github.com/mertsaygi/orchestrdb/src/services"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// errMigrationWaiting is returned while the Database or the migrator User
+// of a Migration is not ready; their watches requeue the Migration.
+var errMigrationWaiting = errors.New("waiting")
+
+// MigrationReconciler applies the migration files of every Migration to its
+// Database whenever the files or the spec change.
+type MigrationReconciler struct {
+	client.Client
+	Scheme          *runtime.Scheme
+	Log             logr.Logger
+	DatabaseService *services.DatabaseService
+
+	// APIReader reads the Pods of fetch Jobs without caching every Pod of
+	// the cluster.
+	APIReader client.Reader
+
+	// PodLogs reads the output of fetch Jobs, which carries the files of
+	// image sources.
+	PodLogs corev1client.PodsGetter
+
+	// Vault is used for adminVaultRef of the Database; nil when no Vault
+	// server is configured.
+	Vault credentials.Provider
+
+	// VaultPaths restricts the Vault paths of adminVaultRef.
+	VaultPaths *services.VaultPathPolicy
+
+	// Recorder emits Events when migrations are applied or fail.
+	Recorder record.EventRecorder
+
+	// PGToolsImage packs the files of image sources in fetch Jobs.
+	PGToolsImage string
+}
+
+// Reconcile is called when a Migration, its source, its Database, its
+// migrator User or its fetch Job changes.
+func (r *MigrationReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("migration", req.NamespacedName)
+
+	var m v1alpha1.Migration
+	if err := r.Get(ctx, req.NamespacedName, &m); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !m.ObjectMeta.DeletionTimestamp.IsZero() {
+		// Applied migrations and the tracking table stay in the database;
+		// a fetch Job is garbage collected with the Migration.
+		return ctrl.Result{}, nil
+	}
+
+	status := &m.Status
+	if applyPause(&m, &status.Conditions) {
+		status.UpdatedAt = time.Now().Format(time.RFC3339)
+		return ctrl.Result{}, r.Status().Update(ctx, &m)
+	}
+
+	requestedAt := reconcileRequestedAt(&m)
+	result, err := r.migrate(ctx, log, &m, requestedAt != status.LastHandledReconcileAt)
+	status.LastHandledReconcileAt = requestedAt
+	status.UpdatedAt = time.Now().Format(time.RFC3339)
+	if err := r.Status().Update(ctx, &m); err != nil {
+		return ctrl.Result{}, err
+	}
+	return result, err
+}
+
+// migrate loads the migration files and applies the pending ones. Files
+// already applied for the current generation are not applied again unless
+// force is set.
+func (r *MigrationReconciler) migrate(ctx context.Context, log logr.Logger, m *v1alpha1.Migration, force bool) (ctrl.Result, error) {
+	status := &m.Status
+	if err := services.ValidateMigrationSpec(&m.Spec); err != nil {
+		r.fail(log, m, "", err)
+		return ctrl.Result{}, nil
+	}
+
+	var files map[string][]byte
+	var err error
+	if m.Spec.Source.Image != nil {
+		if !force && status.ObservedGeneration == m.Generation && migrationSettled(m) {
+			return ctrl.Result{}, nil
+		}
+		var fetched bool
+		files, fetched, err = r.fetchImage(ctx, log, m)
+		if err == nil && !fetched {
+			return ctrl.Result{}, nil
+		}
+	} else {
+		files, err = r.DatabaseService.LoadMigrationFiles(ctx, m)
+		if errors.Is(err, services.ErrMigrationNotReady) {
+			// The ConfigMap and Secret watches requeue us.
+			setMigrationCondition(m, metav1.ConditionFalse, v1alpha1.ReasonMigrationPending, err.Error())
+			return ctrl.Result{}, nil
+		}
+	}
+	if err != nil && !db.CategoryOf(err).Permanent() {
+		return ctrl.Result{}, err
+	}
+
+	var migrations []db.Migration
+	if err == nil {
+		migrations, err = services.ParseMigrations(files)
+	}
+	if err != nil {
+		r.fail(log, m, "", err)
+		r.deleteFetchJob(ctx, log, m)
+		return ctrl.Result{}, nil
+	}
+
+	checksum := services.MigrationsChecksum(migrations)
+	status.LatestVersion = migrations[len(migrations)-1].Version
+	if !force && checksum == status.Checksum && status.ObservedGeneration == m.Generation && migrationSettled(m) {
+		return ctrl.Result{}, nil
+	}
+
+	dbRes, adminUser, adminPassword, role, err := r.target(ctx, m)
+	if err != nil {
+		if errors.Is(err, errMigrationWaiting) || apierrors.IsNotFound(err) ||
+			errors.Is(err, services.ErrReferenceNotPermitted) {
+			log.Info("waiting for Database and migrator", "reason", err.Error())
+			setMigrationCondition(m, metav1.ConditionFalse, v1alpha1.ReasonMigrationPending, err.Error())
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	result, err := r.DatabaseService.ApplyMigrations(ctx, dbRes, adminUser, adminPassword, role, m.Table(), migrations)
+	if result.Version > 0 || err == nil {
+		status.AppliedVersion = result.Version
+	}
+	if result.Applied > 0 {
+		log.Info("migrations applied", "count", result.Applied, "version", result.Version)
+		r.Recorder.Eventf(m, corev1.EventTypeNormal, v1alpha1.ReasonMigrated,
+			"applied %d migrations, now at version %d", result.Applied, result.Version)
+	}
+	if err != nil {
+		if !db.CategoryOf(err).Permanent() {
+			log.Error(err, "failed to apply migrations", "category", db.CategoryOf(err))
+			setMigrationCondition(m, metav1.ConditionFalse, string(db.CategoryOf(err)), err.Error())
+			// Retried with backoff.
+			return ctrl.Result{}, err
+		}
+		r.fail(log, m, checksum, err)
+		r.deleteFetchJob(ctx, log, m)
+		return ctrl.Result{}, nil
+	}
+
+	status.Checksum = checksum
+	status.ObservedGeneration = m.Generation
+	setMigrationCondition(m, metav1.ConditionTrue, v1alpha1.ReasonMigrated,
+		fmt.Sprintf("all migrations applied, at version %d", status.AppliedVersion))
+	r.deleteFetchJob(ctx, log, m)
+	return ctrl.Result{}, nil
+}
+
+// fail records a permanent failure for checksum (empty when the files
+// could not be read). It is not retried until the files or the spec change.
+func (r *MigrationReconciler) fail(log logr.Logger, m *v1alpha1.Migration, checksum string, err error) {
+	prev := meta.FindStatusCondition(m.Status.Conditions, v1alpha1.ConditionReady)
+	if prev == nil || prev.Message != err.Error() || prev.ObservedGeneration != m.Generation {
+		// Watches may requeue us before the files change; report once.
+		log.Error(err, "migration failed", "category", db.CategoryOf(err))
+		r.Recorder.Event(m, corev1.EventTypeWarning, string(db.CategoryOf(err)), err.Error())
+	}
+	m.Status.Checksum = checksum
+	m.Status.ObservedGeneration = m.Generation
+	setMigrationCondition(m, metav1.ConditionFalse, string(db.CategoryOf(err)), err.Error())
+}
+
+// target returns the Database migrated, its admin credentials and the role
+// of the migrator User. It fails with errMigrationWaiting until both are
+// created.
+func (r *MigrationReconciler) target(ctx context.Context, m *v1alpha1.Migration) (*v1alpha1.Database, string, string, string, error) {
+	var dbRes v1alpha1.Database
+	name := m.Spec.DatabaseRef.Name
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: m.Namespace}, &dbRes)
+	if apierrors.IsNotFound(err) {
+		return nil, "", "", "", fmt.Errorf("%w: Database %s not found", errMigrationWaiting, name)
+	}
+	if err != nil {
+		return nil, "", "", "", err
+	}
+	if !dbRes.Status.Created || dbRes.Cloning() {
+		return nil, "", "", "", fmt.Errorf("%w: Database %s is not created yet", errMigrationWaiting, name)
+	}
+
+	var user v1alpha1.User
+	name = m.Spec.MigratorRef.Name
+	err = r.Get(ctx, types.NamespacedName{Name: name, Namespace: m.Namespace}, &user)
+	if apierrors.IsNotFound(err) {
+		return nil, "", "", "", fmt.Errorf("%w: User %s not found", errMigrationWaiting, name)
+	}
+	if err != nil {
+		return nil, "", "", "", err
+	}
+	if !user.Status.Created {
+		return nil, "", "", "", fmt.Errorf("%w: User %s is not created yet", errMigrationWaiting, name)
+	}
+
+	adminUser, adminPassword, err := databaseAdminCredentials(ctx, r.Client, r.Vault, r.VaultPaths, &dbRes)
+	if err != nil {
+		return nil, "", "", "", err
+	}
+	return &dbRes, adminUser, adminPassword, user.Spec.Username, nil
+}
+
+// fetchImage runs the fetch Job of the current generation of an image
+// source and returns the files it printed. It reports false while the Job
+// is running; Owns() requeues us when it progresses.
+func (r *MigrationReconciler) fetchImage(ctx context.Context, log logr.Logger, m *v1alpha1.Migration) (map[string][]byte, bool, error) {
+	status := &m.Status
+	name := fmt.Sprintf("%s-fetch-%d", m.Name, m.Generation)
+	if status.Job != "" && status.Job != name {
+		// Fetched for an older generation.
+		r.deleteFetchJob(ctx, log, m)
+	}
+
+	var job batchv1.Job
+	key := types.NamespacedName{Name: name, Namespace: m.Namespace}
+	err := r.Get(ctx, key, &job)
+	if apierrors.IsNotFound(err) {
+		// The cache may not have seen a Job created a moment ago.
+		err = r.APIReader.Get(ctx, key, &job)
+	}
+	if apierrors.IsNotFound(err) {
+		job := services.MigrationFetchJob(m, name, r.PGToolsImage)
+		if err := controllerutil.SetControllerReference(m, job, r.Scheme); err != nil {
+			return nil, false, err
+		}
+		if err := r.Create(ctx, job); err != nil {
+			return nil, false, err
+		}
+		log.Info("fetching migrations", "job", name, "image", m.Spec.Source.Image.Image)
+		status.Job = name
+		setMigrationCondition(m, metav1.ConditionFalse, v1alpha1.ReasonFetchingMigrations,
+			fmt.Sprintf("copying migrations from %s with Job %s", m.Spec.Source.Image.Image, name))
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !metav1.IsControlledBy(&job, m) {
+		return nil, false, fmt.Errorf("fetch Job %s already exists and was not created for this Migration", name)
+	}
+	status.Job = name
+
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			files, err := r.fetchOutput(ctx, &job)
+			return files, err == nil, err
+		case batchv1.JobFailed:
+			message := fmt.Sprintf("Job %s failed: %s", name, cond.Message)
+			if output := jobFailureOutput(ctx, r.APIReader, &job); output != "" {
+				message += ": " + output
+			}
+			return nil, false, &db.Error{Category: db.CategoryInvalidSpec, Err: errors.New(message)}
+		}
+	}
+	setMigrationCondition(m, metav1.ConditionFalse, v1alpha1.ReasonFetchingMigrations,
+		fmt.Sprintf("copying migrations from %s with Job %s", m.Spec.Source.Image.Image, name))
+	return nil, false, nil
+}
+
+// fetchOutput returns the files printed by the completed fetch Job.
+func (r *MigrationReconciler) fetchOutput(ctx context.Context, job *batchv1.Job) (map[string][]byte, error) {
+	pods, err := jobPods(ctx, r.APIReader, job)
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods {
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Name != services.MigrationFetchContainer || cs.State.Terminated == nil || cs.State.Terminated.ExitCode != 0 {
+				continue
+			}
+			output, err := r.PodLogs.Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+				Container: services.MigrationFetchContainer,
+			}).DoRaw(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return services.DecodeMigrationFetchOutput(output)
+		}
+	}
+	return nil, errors.New("no Pod of the fetch Job reported its output")
+}
+
+// deleteFetchJob removes the fetch Job recorded in the status, if any.
+func (r *MigrationReconciler) deleteFetchJob(ctx context.Context, log logr.Logger, m *v1alpha1.Migration) {
+	if m.Status.Job == "" {
+		return
+	}
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: m.Status.Job, Namespace: m.Namespace}}
+	err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground))
+	if client.IgnoreNotFound(err) != nil {
+		log.Error(err, "failed to delete fetch Job", "job", job.Name)
+		return
+	}
+	m.Status.Job = ""
+}
+
+// migrationSettled reports whether the Ready condition of m is final for its
+// generation: applied, or failed in a way that retrying does not fix.
+func migrationSettled(m *v1alpha1.Migration) bool {
+	cond := meta.FindStatusCondition(m.Status.Conditions, v1alpha1.ConditionReady)
+	if cond == nil || cond.ObservedGeneration != m.Generation {
+		return false
+	}
+	return cond.Status == metav1.ConditionTrue || db.ErrorCategory(cond.Reason).Permanent()
+}
+
+func setMigrationCondition(m *v1alpha1.Migration, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&m.Status.Conditions, metav1.Condition{
+		Type:               v1alpha1.ConditionReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: m.Generation,
+	})
+}
+
+// migrationsFor returns a map function from an object to the Migrations
+// referencing it through the given index. The index value is prefixed
+// with prefix, e.g. the kind of the object.
+func (r *MigrationReconciler) migrationsFor(field, prefix string) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		var list v1alpha1.MigrationList
+		if err := r.List(ctx, &list, client.InNamespace(obj.GetNamespace()),
+			client.MatchingFields{field: prefix + obj.GetName()}); err != nil {
+			r.Log.Error(err, "failed to list Migrations", "field", field, "name", obj.GetName())
+			return nil
+		}
+
+		reqs := make([]reconcile.Request, 0, len(list.Items))
+		for _, item := range list.Items {
+			reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{
+				Name:      item.Name,
+				Namespace: item.Namespace,
+			}})
+		}
+		return reqs
+	}
+}
+
+// SetupWithManager registers the controller with the manager.
+func (r *MigrationReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	indexer := mgr.GetFieldIndexer()
+	if err := indexer.IndexField(context.Background(), &v1alpha1.Migration{}, migrationDatabaseRefNameField,
+		func(obj client.Object) []string {
+			return []string{obj.(*v1alpha1.Migration).Spec.DatabaseRef.Name}
+		}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(context.Background(), &v1alpha1.Migration{}, migrationMigratorRefNameField,
+		func(obj client.Object) []string {
+			return []string{obj.(*v1alpha1.Migration).Spec.MigratorRef.Name}
+		}); err != nil {
+		return err
+	}
+	if err := indexer.IndexField(context.Background(), &v1alpha1.Migration{}, migrationSourceField,
+		func(obj client.Object) []string {
+			source := obj.(*v1alpha1.Migration).Spec.Source
+			switch {
+			case source.ConfigMap != nil:
+				return []string{"ConfigMap/" + source.ConfigMap.Name}
+			case source.Archive != nil:
+				return []string{"ConfigMap/" + source.Archive.Name}
+			case source.Secret != nil:
+				return []string{"Secret/" + source.Secret.Name}
+			}
+			return nil
+		}); err != nil {
+		return err
+	}
+
+	// Status updates must not requeue: the annotations pause and force
+	// a reconcile.
+	changed := predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{})
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.Migration{}, builder.WithPredicates(changed)).
+		WithOptions(controller.Options{RateLimiter: newRateLimiter()}).
+		Owns(&batchv1.Job{}).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.migrationsFor(migrationSourceField, "ConfigMap/"))).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.migrationsFor(migrationSourceField, "Secret/"))).
+		Watches(&v1alpha1.Database{}, handler.EnqueueRequestsFromMapFunc(r.migrationsFor(migrationDatabaseRefNameField, ""))).
+		Watches(&v1alpha1.User{}, handler.EnqueueRequestsFromMapFunc(r.migrationsFor(migrationMigratorRefNameField, ""))).
+		Complete(r)
+}
@@ -0,0 +1,30 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/mertsaygi/orchestrdb/src/db"
+
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
+)
+
+// newRateLimiter returns the per-object exponential backoff used for
+// transient adapter failures: 5s, 10s, 20s, ... up to 10 minutes.
+func newRateLimiter() ratelimiter.RateLimiter {
+	return workqueue.NewItemExponentialFailureRateLimiter(5*time.Second, 10*time.Minute)
+}
+
+// resultForAdapterError decides how to retry after an adapter error.
+// Transient failures are handed back to controller-runtime so the workqueue
+// retries them with exponential backoff. Permanent ones (auth, permissions,
+// invalid spec, conflicts) are retried when the resource or its admin
+// Secret changes, and otherwise after resync (zero: never), since the
+// server side may be fixed without either changing.
+func resultForAdapterError(err error, resync time.Duration) (ctrl.Result, error) {
+	if db.CategoryOf(err).Permanent() {
+		return ctrl.Result{RequeueAfter: resync}, nil
+	}
+	return ctrl.Result{}, err
+}
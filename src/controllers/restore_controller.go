@@ -0,0 +1,426 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/credentials"
+	"github.com/mertsaygi/orchestrdb/src/db"
+	"github.com/mertsaygi/orchestrdb/src/services"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// RestoreReconciler runs the pg_restore Job of every Restore once, hands the
+// restored objects to the owner role and records the outcome.
+type RestoreReconciler struct {
+	client.Client
+	Scheme          *runtime.Scheme
+	Log             logr.Logger
+	DatabaseService *services.DatabaseService
+
+	// APIReader reads the Pods of restore Jobs (and Jobs the cache may not
+	// have seen yet) without caching every Pod of the cluster.
+	APIReader client.Reader
+
+	// Vault is used for adminVaultRef of the Database; nil when no Vault
+	// server is configured.
+	Vault credentials.Provider
+
+	// VaultPaths restricts the Vault paths of adminVaultRef.
+	VaultPaths *services.VaultPathPolicy
+
+	// Recorder emits Events on completion and failure.
+	Recorder record.EventRecorder
+
+	// PGToolsImage is the image with pg_restore used by Jobs.
+	PGToolsImage string
+
+	// S3ToolsImage is the image with the AWS CLI used for dumps in S3.
+	S3ToolsImage string
+
+	// JobDeadline bounds how long a restore Job and its role live.
+	JobDeadline time.Duration
+
+	// ResyncInterval is how often a Restore waiting after a permanent
+	// adapter error is retried. Zero disables it.
+	ResyncInterval time.Duration
+}
+
+// Reconcile is called when a Restore, its Job, its Backup or its Database changes.
+func (r *RestoreReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("restore", req.NamespacedName)
+
+	var restore v1alpha1.Restore
+	if err := r.Get(ctx, req.NamespacedName, &restore); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	if !restore.ObjectMeta.DeletionTimestamp.IsZero() || restore.Finished() {
+		// The Job and Secret are garbage collected with the Restore.
+		return ctrl.Result{}, nil
+	}
+	if restore.Status.Job == "" {
+		return r.start(ctx, log, &restore)
+	}
+
+	status := &restore.Status
+	jobDone, err := r.observeRestoreJob(ctx, &restore)
+	if err != nil {
+		log.Error(err, "failed to observe restore Job")
+		status.Message = err.Error()
+		setRestoreCondition(&restore)
+		if err := r.Status().Update(ctx, &restore); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, err
+	}
+
+	if jobDone || status.Phase == v1alpha1.RestoreFailed {
+		// A finished Restore is not reconciled again, so the phase is only
+		// stored once the role is gone. Dropping it hands the restored
+		// objects to the admin user, and transferOwnership on to the owner.
+		if err := r.finishRestoreJob(ctx, log, &restore); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	var result ctrl.Result
+	if jobDone && status.Phase == v1alpha1.RestoreRunning {
+		result, err = r.transferOwnership(ctx, log, &restore)
+	}
+
+	switch status.Phase {
+	case v1alpha1.RestoreCompleted:
+		log.Info("restore completed", "location", status.Location, "database", status.Database)
+		r.Recorder.Event(&restore, corev1.EventTypeNormal, v1alpha1.ReasonRestoreCompleted, status.Message)
+	case v1alpha1.RestoreFailed:
+		log.Info("restore failed", "reason", status.Message)
+		r.Recorder.Event(&restore, corev1.EventTypeWarning, v1alpha1.ReasonRestoreFailed, status.Message)
+	}
+
+	status.UpdatedAt = time.Now().Format(time.RFC3339)
+	setRestoreCondition(&restore)
+	if err := r.Status().Update(ctx, &restore); err != nil {
+		return ctrl.Result{}, err
+	}
+	// Owns() requeues us when the Job progresses.
+	return result, err
+}
+
+// start creates the job role, the Secret with its connection string and
+// the restore Job once the dump and the Database are ready. The Secret and
+// the Job are owned by the Restore.
+func (r *RestoreReconciler) start(ctx context.Context, log logr.Logger, restore *v1alpha1.Restore) (ctrl.Result, error) {
+	status := &restore.Status
+	wait := func(message string) error {
+		status.Phase = v1alpha1.RestorePending
+		status.Message = message
+		status.UpdatedAt = time.Now().Format(time.RFC3339)
+		setRestoreCondition(restore)
+		return r.Status().Update(ctx, restore)
+	}
+
+	// The Backup watch requeues us once it completes.
+	dump, err := r.DatabaseService.ResolveRestoreDump(ctx, restore)
+	if err != nil {
+		if !errors.Is(err, services.ErrRestoreNotReady) && db.CategoryOf(err) != db.CategoryInvalidSpec {
+			return ctrl.Result{}, err
+		}
+		log.Info("waiting for dump", "reason", err.Error())
+		return ctrl.Result{}, wait(err.Error())
+	}
+
+	dbRes, adminUser, adminPassword, err := r.target(ctx, restore)
+	if err != nil {
+		log.Info("waiting for Database", "reason", err.Error())
+		if err := wait(err.Error()); err != nil {
+			return ctrl.Result{}, err
+		}
+		if errors.Is(err, services.ErrRestoreNotReady) || apierrors.IsNotFound(err) ||
+			errors.Is(err, services.ErrReferenceNotPermitted) {
+			// The Database watch requeues us.
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	owner, err := r.DatabaseService.ResolveRestoreOwner(ctx, restore, dbRes)
+	if err != nil {
+		log.Info("waiting for owner", "reason", err.Error())
+		if err := wait(err.Error()); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	role, err := r.DatabaseService.NewJobRole(services.JobRoleName(restore, ""), time.Now().Add(r.JobDeadline), true)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if owner != "" {
+		// Lets pg_restore --clean drop and replace the owner's objects.
+		role.MemberOf = []string{owner}
+	}
+	data, err := r.DatabaseService.DumpSecretData(ctx, dbRes, adminUser, adminPassword, role)
+	if err != nil {
+		log.Error(err, "failed to build restore connection", "category", db.CategoryOf(err))
+		if err := wait(err.Error()); err != nil {
+			return ctrl.Result{}, err
+		}
+		return resultForAdapterError(err, r.ResyncInterval)
+	}
+
+	name := restore.Name + "-restore"
+	job := services.RestoreJob(restore, dump, name, r.PGToolsImage, r.S3ToolsImage, r.JobDeadline)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: restore.Namespace, Labels: job.Labels},
+		Data:       data,
+	}
+	if err := controllerutil.SetControllerReference(restore, secret, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.Create(ctx, secret); apierrors.IsAlreadyExists(err) {
+		// Left over from an attempt that failed to create the Job.
+		if err := r.Update(ctx, secret); err != nil {
+			return ctrl.Result{}, err
+		}
+	} else if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := controllerutil.SetControllerReference(restore, job, r.Scheme); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.Create(ctx, job); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	now := metav1.Now()
+	status.Phase = v1alpha1.RestoreRunning
+	status.Location = dump.Location
+	status.Database = dbRes.Spec.Name
+	status.Owner = owner
+	status.Job = name
+	status.StartedAt = &now
+	status.Message = fmt.Sprintf("restoring %s into %s with Job %s", status.Location, status.Database, name)
+	status.UpdatedAt = now.Format(time.RFC3339)
+	setRestoreCondition(restore)
+	log.Info("restore started", "job", name, "location", status.Location)
+	return ctrl.Result{}, r.Status().Update(ctx, restore)
+}
+
+// target returns the Database restored into and its admin credentials. It
+// fails with ErrRestoreNotReady until the database is created.
+func (r *RestoreReconciler) target(ctx context.Context, restore *v1alpha1.Restore) (*v1alpha1.Database, string, string, error) {
+	name := restore.Spec.DatabaseRef.Name
+	var dbRes v1alpha1.Database
+	err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: restore.Namespace}, &dbRes)
+	if apierrors.IsNotFound(err) {
+		return nil, "", "", fmt.Errorf("%w: Database %s not found", services.ErrRestoreNotReady, name)
+	}
+	if err != nil {
+		return nil, "", "", err
+	}
+	if !dbRes.Status.Created || dbRes.Cloning() {
+		return nil, "", "", fmt.Errorf("%w: Database %s is not created yet", services.ErrRestoreNotReady, name)
+	}
+
+	adminUser, adminPassword, err := databaseAdminCredentials(ctx, r.Client, r.Vault, r.VaultPaths, &dbRes)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return &dbRes, adminUser, adminPassword, nil
+}
+
+// observeRestoreJob records the progress of the restore Job in the status.
+// It reports whether the Job completed successfully.
+func (r *RestoreReconciler) observeRestoreJob(ctx context.Context, restore *v1alpha1.Restore) (bool, error) {
+	status := &restore.Status
+	key := types.NamespacedName{Name: status.Job, Namespace: restore.Namespace}
+
+	var job batchv1.Job
+	err := r.Get(ctx, key, &job)
+	if apierrors.IsNotFound(err) {
+		// The cache may not have seen a Job created a moment ago.
+		err = r.APIReader.Get(ctx, key, &job)
+	}
+	if apierrors.IsNotFound(err) {
+		status.Phase = v1alpha1.RestoreFailed
+		status.Message = fmt.Sprintf("Job %s was deleted before it completed", status.Job)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !metav1.IsControlledBy(&job, restore) {
+		return false, fmt.Errorf("restore Job %s already exists and was not created for this Restore", job.Name)
+	}
+
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != corev1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			return true, nil
+		case batchv1.JobFailed:
+			status.Phase = v1alpha1.RestoreFailed
+			status.CompletedAt = job.Status.CompletionTime.DeepCopy()
+			status.Message = fmt.Sprintf("Job %s failed: %s", job.Name, cond.Message)
+			if output := jobFailureOutput(ctx, r.APIReader, &job); output != "" {
+				status.Message += ": " + output
+			}
+			return false, nil
+		}
+	}
+	status.Message = fmt.Sprintf("restoring %s into %s with Job %s", status.Location, status.Database, job.Name)
+	return false, nil
+}
+
+// transferOwnership hands the restored objects to status.owner and completes
+// the restore. Transient failures are retried; others fail the restore.
+func (r *RestoreReconciler) transferOwnership(ctx context.Context, log logr.Logger, restore *v1alpha1.Restore) (ctrl.Result, error) {
+	status := &restore.Status
+	complete := func() {
+		now := metav1.Now()
+		status.Phase = v1alpha1.RestoreCompleted
+		status.CompletedAt = &now
+		status.Message = fmt.Sprintf("restored %s into %s", status.Location, status.Database)
+		if status.Owner != "" {
+			status.Message += ", owned by " + status.Owner
+		}
+	}
+	if status.Owner == "" {
+		complete()
+		return ctrl.Result{}, nil
+	}
+
+	dbRes, adminUser, adminPassword, err := r.target(ctx, restore)
+	if err == nil {
+		err = r.DatabaseService.TransferOwnership(ctx, dbRes, adminUser, adminPassword, status.Owner)
+	}
+	if err != nil {
+		log.Error(err, "failed to hand restored objects to owner", "owner", status.Owner, "category", db.CategoryOf(err))
+		status.Message = fmt.Sprintf("restored, but handing objects to %s failed: %v", status.Owner, err)
+		if db.CategoryOf(err).Permanent() {
+			status.Phase = v1alpha1.RestoreFailed
+		}
+		return resultForAdapterError(err, r.ResyncInterval)
+	}
+	complete()
+	return ctrl.Result{}, nil
+}
+
+// finishRestoreJob drops the job role of a finished restore Job and deletes
+// its Secret. Transient failures are returned to be retried; otherwise a
+// role that cannot be dropped now expires and is dropped by a later Job on
+// the same server.
+func (r *RestoreReconciler) finishRestoreJob(ctx context.Context, log logr.Logger, restore *v1alpha1.Restore) error {
+	role := services.JobRoleName(restore, "")
+	dbRes, adminUser, adminPassword, err := r.target(ctx, restore)
+	if err == nil {
+		err = r.DatabaseService.DropJobRole(ctx, dbRes, adminUser, adminPassword, role)
+		if err != nil && !db.CategoryOf(err).Permanent() {
+			return fmt.Errorf("drop restore role: %w", err)
+		}
+	}
+	if err != nil {
+		log.Error(err, "failed to drop restore role; it is dropped once expired", "role", role)
+	}
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: restore.Status.Job, Namespace: restore.Namespace}}
+	return client.IgnoreNotFound(r.Delete(ctx, secret))
+}
+
+// setRestoreCondition reflects the phase of restore in its Ready condition.
+func setRestoreCondition(restore *v1alpha1.Restore) {
+	cond := metav1.Condition{
+		Type:               v1alpha1.ConditionReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             v1alpha1.ReasonRestorePending,
+		Message:            restore.Status.Message,
+		ObservedGeneration: restore.Generation,
+	}
+	switch restore.Status.Phase {
+	case v1alpha1.RestoreRunning:
+		cond.Reason = v1alpha1.ReasonRestoreRunning
+	case v1alpha1.RestoreCompleted:
+		cond.Status = metav1.ConditionTrue
+		cond.Reason = v1alpha1.ReasonRestoreCompleted
+	case v1alpha1.RestoreFailed:
+		cond.Reason = v1alpha1.ReasonRestoreFailed
+	}
+	meta.SetStatusCondition(&restore.Status.Conditions, cond)
+}
+
+// restoresFor returns a map function from an object to the Restores that
+// have not started yet and reference it through the given index.
+func (r *RestoreReconciler) restoresFor(field string) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		var list v1alpha1.RestoreList
+		if err := r.List(ctx, &list, client.InNamespace(obj.GetNamespace()),
+			client.MatchingFields{field: obj.GetName()}); err != nil {
+			r.Log.Error(err, "failed to list Restores", "field", field, "name", obj.GetName())
+			return nil
+		}
+
+		var reqs []reconcile.Request
+		for _, item := range list.Items {
+			if item.Status.Job != "" {
+				continue
+			}
+			reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{
+				Name:      item.Name,
+				Namespace: item.Namespace,
+			}})
+		}
+		return reqs
+	}
+}
+
+// SetupWithManager registers the controller with the manager.
+func (r *RestoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1alpha1.Restore{}, restoreDatabaseRefNameField,
+		func(obj client.Object) []string {
+			return []string{obj.(*v1alpha1.Restore).Spec.DatabaseRef.Name}
+		}); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1alpha1.Restore{}, restoreBackupRefNameField,
+		func(obj client.Object) []string {
+			restore := obj.(*v1alpha1.Restore)
+			if restore.Spec.BackupRef == nil {
+				return nil
+			}
+			return []string{restore.Spec.BackupRef.Name}
+		}); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.Restore{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		WithOptions(controller.Options{RateLimiter: newRateLimiter()}).
+		Owns(&batchv1.Job{}).
+		Watches(&v1alpha1.Database{}, handler.EnqueueRequestsFromMapFunc(r.restoresFor(restoreDatabaseRefNameField))).
+		Watches(&v1alpha1.Backup{}, handler.EnqueueRequestsFromMapFunc(r.restoresFor(restoreBackupRefNameField))).
+		Complete(r)
+}
@@ -2,18 +2,28 @@ package controllers
 
 import (
 	"context"
+	"errors"
+	"slices"
+	"strings"
 	"time"
 
 	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/audit"
+	"github.com/mertsaygi/orchestrdb/src/db"
 	"github.com/mertsaygi/orchestrdb/src/services"
 
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
 // UserReconciler reconciles User resources.
@@ -21,6 +31,16 @@ type UserReconciler struct {
 	client.Client
 	Scheme      *runtime.Scheme
 	UserService *services.UserService
+
+	// Recorder emits drift Events.
+	Recorder record.EventRecorder
+
+	// ResyncInterval is how often a reconciled User is checked for drift.
+	// Zero disables periodic resync.
+	ResyncInterval time.Duration
+
+	// DryRun plans every User as if spec.dryRun was set.
+	DryRun bool
 }
 
 func (r *UserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
@@ -31,36 +51,62 @@ func (r *UserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	// If being deleted, we currently do nothing (no DROP ROLE yet).
-	if !user.ObjectMeta.DeletionTimestamp.IsZero() {
+	// With deletionPolicy Delete the finalizer keeps the resource until the
+	// role is dropped; otherwise deletion leaves the server alone.
+	if err := syncCleanupFinalizer(ctx, r.Client, &user, user.Spec.DeletionPolicy); err != nil {
+		return ctrl.Result{}, err
+	}
+	deleting := !user.ObjectMeta.DeletionTimestamp.IsZero()
+	if deleting && !controllerutil.ContainsFinalizer(&user, v1alpha1.FinalizerCleanup) {
 		return ctrl.Result{}, nil
 	}
 
-	// -----------------------------------------------------------------
-	// 1) Ensure generated Secret does NOT already exist
-	// -----------------------------------------------------------------
-	secNs := user.Spec.GeneratedSecret.Namespace
-	if secNs == "" {
-		secNs = user.Namespace
+	// Attribute every statement executed below to this resource.
+	ctx = audit.WithSubject(ctx, audit.Subject{
+		Kind:       "User",
+		Namespace:  user.Namespace,
+		Name:       user.Name,
+		Generation: user.Generation,
+	})
+
+	// Paused resources are left alone entirely; the annotation change that
+	// resumes them triggers a new reconcile.
+	if applyPause(&user, &user.Status.Conditions) {
+		logger.Info("reconciliation paused")
+		if err := r.Status().Update(ctx, &user); err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
 	}
 
-	var existing corev1.Secret
-	err := r.Get(ctx, types.NamespacedName{
-		Name:      user.Spec.GeneratedSecret.Name,
-		Namespace: secNs,
-	}, &existing)
+	// Decide before echoing the force-reconcile request below. A dry run
+	// never repairs drift, so it always plans the full spec.
+	dryRun := r.DryRun || user.Spec.DryRun
+	if deleting {
+		return r.finalize(ctx, &user, dryRun)
+	}
+	checkDrift := !dryRun && verifyOnly(&user, user.Status.Conditions, user.Status.LastHandledReconcileAt)
+
+	// Echo a force-reconcile request; every status update below carries it.
+	user.Status.LastHandledReconcileAt = reconcileRequestedAt(&user)
+
+	// -----------------------------------------------------------------
+	// 1) Look up the generated credentials. They must either not exist
+	//    yet or be owned by this User.
+	// -----------------------------------------------------------------
+	store := r.newGeneratedSecretStore(&user)
 
-	if err == nil {
-		// Secret already exists -> fail as requested
-		msg := "generatedSecret already exists; refusing to overwrite"
+	generatedPassword, secretExists, err := store.load(ctx)
+	if errors.Is(err, errGeneratedSecretNotOwned) {
+		// Secret exists but was not created for this User -> fail as requested
 		user.Status.Created = false
-		user.Status.LastError = msg
+		user.Status.LastError = err.Error()
 		user.Status.UpdatedAt = time.Now().Format(time.RFC3339)
 		_ = r.Status().Update(ctx, &user)
 
-		logger.Error(nil, msg, "secret", user.Spec.GeneratedSecret.Name, "namespace", secNs)
+		logger.Error(nil, err.Error(), "secret", user.Spec.GeneratedSecret.Name, "vaultPath", user.Spec.GeneratedSecret.VaultPath)
 		return ctrl.Result{}, nil
-	} else if !apierrors.IsNotFound(err) {
+	} else if err != nil {
 		// Real error fetching Secret
 		user.Status.Created = false
 		user.Status.LastError = err.Error()
@@ -69,10 +115,13 @@ func (r *UserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 
 		logger.Error(err, "failed to get generatedSecret")
 		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	} else if !secretExists && user.Status.Created {
+		// The Secret was created before and has been deleted since. The role
+		// keeps a password nobody knows, so generate a new one and reset it.
+		logger.Info("generatedSecret was deleted; regenerating password",
+			"secret", user.Spec.GeneratedSecret.Name, "vaultPath", user.Spec.GeneratedSecret.VaultPath)
 	}
 
-	// At this point Secret does not exist -> we create it.
-
 	// -----------------------------------------------------------------
 	// 2) Resolve admin credentials
 	// -----------------------------------------------------------------
@@ -83,67 +132,147 @@ func (r *UserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 		user.Status.UpdatedAt = time.Now().Format(time.RFC3339)
 		_ = r.Status().Update(ctx, &user)
 
+		if apierrors.IsNotFound(err) {
+			// The admin Secret watch requeues us once it appears.
+			logger.Info("waiting for adminSecretRef Secret to be created")
+			return ctrl.Result{}, nil
+		}
+		if errors.Is(err, services.ErrReferenceNotPermitted) {
+			// The CredentialGrant watch requeues us once a grant appears.
+			logger.Error(err, "adminSecretRef not permitted")
+			return ctrl.Result{}, nil
+		}
+
 		logger.Error(err, "failed to resolve admin credentials")
 		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
 	}
 
 	// -----------------------------------------------------------------
-	// 3) Generate a strong password for this user
+	// A resync of an already applied spec only checks the server. The
+	// spec is re-applied when drift is found, unless driftPolicy is
+	// Report. Without stored credentials there is nothing to verify:
+	// the password is regenerated below.
 	// -----------------------------------------------------------------
-	generatedPassword, err := r.UserService.GeneratePassword(32)
-	if err != nil {
-		user.Status.Created = false
-		user.Status.LastError = err.Error()
-		user.Status.UpdatedAt = time.Now().Format(time.RFC3339)
-		_ = r.Status().Update(ctx, &user)
-
-		logger.Error(err, "failed to generate password")
-		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	var drift []string
+	if checkDrift && secretExists {
+		drift, err = r.UserService.DetectDrift(ctx, &user, adminUser, adminPassword)
+		if err != nil {
+			// EnsureUser below reports the failure in the Ready condition.
+			logger.Error(err, "drift detection failed", "category", db.CategoryOf(err))
+		} else if len(drift) == 0 {
+			setDriftedCondition(&user, &user.Status.Conditions, v1alpha1.ReasonInSync, nil)
+			if err := r.Status().Update(ctx, &user); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: r.ResyncInterval}, nil
+		} else if user.Spec.DriftPolicy == v1alpha1.DriftPolicyReport {
+			logger.Info("drift detected", "drift", drift)
+			setDriftedCondition(&user, &user.Status.Conditions, v1alpha1.ReasonDriftDetected, drift)
+			r.Recorder.Event(&user, corev1.EventTypeWarning, v1alpha1.ReasonDriftDetected, strings.Join(drift, "; "))
+			if err := r.Status().Update(ctx, &user); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{RequeueAfter: r.ResyncInterval}, nil
+		}
 	}
 
-	// -----------------------------------------------------------------
-	// 4) Create the Secret with username/password
-	// -----------------------------------------------------------------
-	secret := &corev1.Secret{
-		ObjectMeta: ctrl.ObjectMeta{
-			Name:      user.Spec.GeneratedSecret.Name,
-			Namespace: secNs,
-		},
-		Type: corev1.SecretTypeOpaque,
-		StringData: map[string]string{
-			"username": user.Spec.Username,
-			"password": generatedPassword,
-		},
-	}
-
-	if err := r.Create(ctx, secret); err != nil {
-		if apierrors.IsAlreadyExists(err) {
-			// Safety: in case of race, behave like "already exists" semantics
-			msg := "generatedSecret already exists during create"
+	if !secretExists {
+		// -------------------------------------------------------------
+		// 3) Take over the current password of a role being adopted, or
+		//    generate a strong password for this user
+		// -------------------------------------------------------------
+		var adopted bool
+		if !user.Status.Created {
+			generatedPassword, adopted, err = r.UserService.ReadAdoptionPassword(ctx, &user)
+		}
+		if err != nil {
 			user.Status.Created = false
-			user.Status.LastError = msg
+			user.Status.LastError = err.Error()
 			user.Status.UpdatedAt = time.Now().Format(time.RFC3339)
 			_ = r.Status().Update(ctx, &user)
 
-			logger.Error(err, msg)
-			return ctrl.Result{}, nil
+			logger.Error(err, "failed to read adoption.passwordSecretRef")
+			return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
 		}
+		if !adopted {
+			generatedPassword, err = r.UserService.GeneratePassword(&user)
+			if err != nil {
+				user.Status.Created = false
+				user.Status.LastError = err.Error()
+				user.Status.UpdatedAt = time.Now().Format(time.RFC3339)
+				_ = r.Status().Update(ctx, &user)
 
-		user.Status.Created = false
-		user.Status.LastError = err.Error()
+				logger.Error(err, "failed to generate password", "category", db.CategoryOf(err))
+				// An invalid policy waits for a spec change
+				return resultForAdapterError(err, r.ResyncInterval)
+			}
+		}
+	}
+
+	// -----------------------------------------------------------------
+	// Dry run: record the statements instead of executing them. Nothing
+	// is stored; a generated password is discarded.
+	// -----------------------------------------------------------------
+	if dryRun {
+		plan, err := r.UserService.PlanUser(ctx, &user, generatedPassword, adminUser, adminPassword)
+		if err != nil {
+			logger.Error(err, "dry run failed", "category", db.CategoryOf(err))
+			user.Status.LastError = err.Error()
+		} else {
+			if !slices.Equal(plan, user.Status.Plan) {
+				r.Recorder.Eventf(&user, corev1.EventTypeNormal, v1alpha1.ReasonDryRun,
+					"%d statement(s) planned, see status.plan", len(plan))
+			}
+			user.Status.LastError = ""
+			user.Status.Plan = plan
+		}
 		user.Status.UpdatedAt = time.Now().Format(time.RFC3339)
-		_ = r.Status().Update(ctx, &user)
+		if err := r.Status().Update(ctx, &user); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err != nil {
+			return resultForAdapterError(err, r.ResyncInterval)
+		}
+		return ctrl.Result{RequeueAfter: r.ResyncInterval}, nil
+	}
+	user.Status.Plan = nil
 
-		logger.Error(err, "failed to create generatedSecret")
-		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	// -----------------------------------------------------------------
+	// 4) Ensure the user exists in the DB with correct privileges.
+	//    Server-side changes come first: the credentials are only stored
+	//    once the server knows the password.
+	// -----------------------------------------------------------------
+	created, ensureErr := r.UserService.EnsureUser(ctx, &user, generatedPassword, adminUser, adminPassword)
+	if ensureErr != nil {
+		logger.Error(ensureErr, "EnsureUser failed", "category", db.CategoryOf(ensureErr))
+	} else if len(drift) > 0 {
+		logger.Info("drift repaired", "drift", drift)
+		setDriftedCondition(&user, &user.Status.Conditions, v1alpha1.ReasonDriftRepaired, drift)
+		r.Recorder.Event(&user, corev1.EventTypeNormal, v1alpha1.ReasonDriftRepaired, strings.Join(drift, "; "))
+	} else {
+		setDriftedCondition(&user, &user.Status.Conditions, v1alpha1.ReasonInSync, nil)
 	}
 
 	// -----------------------------------------------------------------
-	// 5) Ensure the user exists in the DB with correct privileges
+	// 5) Store username/password (Secret or Vault). If this fails the
+	//    Secret stays missing, so the next reconcile generates and sets
+	//    a fresh password again.
 	// -----------------------------------------------------------------
-	created, errMsg := r.UserService.EnsureUser(ctx, &user, generatedPassword, adminUser, adminPassword)
-	if errMsg != "" {
-		logger.Error(nil, "EnsureUser failed", "error", errMsg)
+	if created && !secretExists {
+		if err := store.save(ctx, generatedPassword); err != nil {
+			user.Status.Created = false
+			user.Status.LastError = err.Error()
+			user.Status.UpdatedAt = time.Now().Format(time.RFC3339)
+			_ = r.Status().Update(ctx, &user)
+
+			if errors.Is(err, errGeneratedSecretNotOwned) {
+				logger.Error(err, "generatedSecret already exists during create")
+				return ctrl.Result{}, nil
+			}
+
+			logger.Error(err, "failed to create generatedSecret")
+			return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+		}
 	}
 
 	if err := r.Status().Update(ctx, &user); err != nil {
@@ -152,15 +281,167 @@ func (r *UserReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.
 	}
 
 	if !created {
+		// Back off on transient failures, wait for a change on permanent ones
+		return resultForAdapterError(ensureErr, r.ResyncInterval)
+	}
+
+	return ctrl.Result{RequeueAfter: r.ResyncInterval}, nil
+}
+
+// finalize drops the role of a User deleted with deletionPolicy Delete and
+// releases the cleanup finalizer. A role the operator does not manage is
+// left in place with a warning. A dry run only records the plan and keeps
+// the finalizer until dry run or the policy is turned off.
+func (r *UserReconciler) finalize(ctx context.Context, user *v1alpha1.User, dryRun bool) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	adminUser, adminPassword, err := r.UserService.ResolveAdminCredentials(ctx, user)
+	if err != nil {
+		user.Status.LastError = err.Error()
+		user.Status.UpdatedAt = time.Now().Format(time.RFC3339)
+		_ = r.Status().Update(ctx, user)
+
+		if apierrors.IsNotFound(err) || errors.Is(err, services.ErrReferenceNotPermitted) {
+			// The admin Secret and CredentialGrant watches requeue us.
+			logger.Info("cannot drop role without admin credentials", "reason", err.Error())
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "failed to resolve admin credentials")
 		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
 	}
 
-	return ctrl.Result{}, nil
+	if dryRun {
+		plan, err := r.UserService.PlanDropUser(ctx, user, adminUser, adminPassword)
+		if err != nil {
+			logger.Error(err, "dry run of drop failed", "category", db.CategoryOf(err))
+			user.Status.LastError = err.Error()
+		} else {
+			if !slices.Equal(plan, user.Status.Plan) {
+				r.Recorder.Eventf(user, corev1.EventTypeNormal, v1alpha1.ReasonDryRun,
+					"dropping the role needs %d statement(s), see status.plan", len(plan))
+			}
+			user.Status.LastError = ""
+			user.Status.Plan = plan
+		}
+		user.Status.UpdatedAt = time.Now().Format(time.RFC3339)
+		if err := r.Status().Update(ctx, user); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err != nil {
+			return resultForAdapterError(err, r.ResyncInterval)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	err = r.UserService.DropUser(ctx, user, adminUser, adminPassword)
+	switch {
+	case err == nil:
+		logger.Info("role dropped", "username", user.Spec.Username)
+		r.Recorder.Eventf(user, corev1.EventTypeNormal, v1alpha1.ReasonDropped, "role %s dropped", user.Spec.Username)
+	case db.CategoryOf(err) == db.CategoryConflict:
+		logger.Info("role not dropped", "reason", err.Error())
+		r.Recorder.Event(user, corev1.EventTypeWarning, v1alpha1.ReasonDropSkipped, err.Error())
+	default:
+		logger.Error(err, "DropUser failed", "category", db.CategoryOf(err))
+		user.Status.LastError = err.Error()
+		user.Status.UpdatedAt = time.Now().Format(time.RFC3339)
+		if err := r.Status().Update(ctx, user); err != nil {
+			return ctrl.Result{}, err
+		}
+		return resultForAdapterError(err, r.ResyncInterval)
+	}
+
+	return ctrl.Result{}, releaseCleanupFinalizer(ctx, r.Client, user)
+}
+
+// userForGeneratedSecret maps a cross-namespace generated Secret back to its
+// User via the tracking labels. Same-namespace Secrets are handled by Owns().
+func (r *UserReconciler) userForGeneratedSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	labels := obj.GetLabels()
+	if labels[v1alpha1.LabelOwnerKind] != "User" {
+		return nil
+	}
+	name := labels[v1alpha1.LabelOwnerName]
+	ns := labels[v1alpha1.LabelOwnerNamespace]
+	if name == "" || ns == "" || ns == obj.GetNamespace() {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: name, Namespace: ns}}}
+}
+
+// usersForAdminSecret maps an admin Secret to the Users referencing it. The
+// index only holds the Secret name, so the referenced namespace is checked here.
+func (r *UserReconciler) usersForAdminSecret(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list v1alpha1.UserList
+	if err := r.List(ctx, &list, client.MatchingFields{adminSecretRefNameField: obj.GetName()}); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list Users for admin Secret", "secret", obj.GetName())
+		return nil
+	}
+
+	var reqs []reconcile.Request
+	for _, item := range list.Items {
+		if userAdminSecretNamespace(&item) != obj.GetNamespace() {
+			continue
+		}
+		reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{
+			Name:      item.Name,
+			Namespace: item.Namespace,
+		}})
+	}
+	return reqs
+}
+
+// userAdminSecretNamespace returns the namespace of the User's admin Secret.
+func userAdminSecretNamespace(user *v1alpha1.User) string {
+	if user.Spec.AdminSecretRef != nil && user.Spec.AdminSecretRef.Namespace != "" {
+		return user.Spec.AdminSecretRef.Namespace
+	}
+	return user.Namespace
+}
+
+// usersForCredentialGrant maps a CredentialGrant to the Users in other
+// namespaces that reference Secrets in the grant's namespace.
+func (r *UserReconciler) usersForCredentialGrant(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list v1alpha1.UserList
+	if err := r.List(ctx, &list); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list Users for CredentialGrant", "grant", obj.GetName())
+		return nil
+	}
+
+	var reqs []reconcile.Request
+	for _, item := range list.Items {
+		if item.Spec.AdminSecretRef == nil || item.Namespace == obj.GetNamespace() ||
+			userAdminSecretNamespace(&item) != obj.GetNamespace() {
+			continue
+		}
+		reqs = append(reqs, reconcile.Request{NamespacedName: types.NamespacedName{
+			Name:      item.Name,
+			Namespace: item.Namespace,
+		}})
+	}
+	return reqs
 }
 
 // SetupWithManager registers the User controller with the manager.
 func (r *UserReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1alpha1.User{}, adminSecretRefNameField,
+		func(obj client.Object) []string {
+			user := obj.(*v1alpha1.User)
+			if user.Spec.AdminSecretRef == nil || user.Spec.AdminSecretRef.Name == "" {
+				return nil
+			}
+			return []string{user.Spec.AdminSecretRef.Name}
+		}); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha1.User{}).
+		WithOptions(controller.Options{RateLimiter: newRateLimiter()}).
+		Owns(&corev1.Secret{}).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.userForGeneratedSecret)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.usersForAdminSecret)).
+		Watches(&v1alpha1.CredentialGrant{}, handler.EnqueueRequestsFromMapFunc(r.usersForCredentialGrant)).
+		Watches(&v1alpha1.DatabaseClaim{}, handler.EnqueueRequestsFromMapFunc(claimedObjectFor("User"))).
 		Complete(r)
 }
@@ -0,0 +1,37 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned by providers when nothing is stored at the requested path.
+var ErrNotFound = errors.New("credentials not found")
+
+// Provider reads and writes key/value credential documents in a backing store.
+//
+// Paths are provider specific:
+//   - Kubernetes Secrets: "<namespace>/<name>"
+//   - Vault KV v2:        "<mount>/<path>" (e.g. "secret/platform/rds-admin")
+type Provider interface {
+	// Read returns the data stored at path. It returns an error wrapping
+	// ErrNotFound if nothing is stored there.
+	Read(ctx context.Context, path string) (map[string]string, error)
+
+	// Write stores data at path, replacing any previous content.
+	Write(ctx context.Context, path string, data map[string]string) error
+}
+
+// MetadataProvider is implemented by providers that keep metadata next to
+// the data at a path, such as the custom_metadata of a Vault KV v2 secret.
+type MetadataProvider interface {
+	Provider
+
+	// ReadMetadata returns the metadata stored for path. It is empty if
+	// there is none.
+	ReadMetadata(ctx context.Context, path string) (map[string]string, error)
+
+	// WriteMetadata stores metadata for path, replacing any previous
+	// metadata. It may be written before any data exists at path.
+	WriteMetadata(ctx context.Context, path string, metadata map[string]string) error
+}
@@ -0,0 +1,86 @@
+package credentials
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// SecretProvider implements Provider on top of Kubernetes Secrets.
+type SecretProvider struct {
+	k8sClient client.Client
+}
+
+// NewSecretProvider creates a new SecretProvider.
+func NewSecretProvider(k8sClient client.Client) *SecretProvider {
+	return &SecretProvider{
+		k8sClient: k8sClient,
+	}
+}
+
+// SecretPath builds the provider path for a Secret.
+func SecretPath(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+func splitSecretPath(path string) (types.NamespacedName, error) {
+	ns, name, ok := strings.Cut(path, "/")
+	if !ok || ns == "" || name == "" {
+		return types.NamespacedName{}, fmt.Errorf("invalid secret path %q, expected <namespace>/<name>", path)
+	}
+	return types.NamespacedName{Namespace: ns, Name: name}, nil
+}
+
+// Read returns the Secret data as strings. The returned error wraps both
+// ErrNotFound and the Kubernetes NotFound error when the Secret is missing.
+func (p *SecretProvider) Read(ctx context.Context, path string) (map[string]string, error) {
+	key, err := splitSecretPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var secret corev1.Secret
+	if err := p.k8sClient.Get(ctx, key, &secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: %w", ErrNotFound, err)
+		}
+		return nil, err
+	}
+
+	data := make(map[string]string, len(secret.Data))
+	for k, v := range secret.Data {
+		data[k] = string(v)
+	}
+	return data, nil
+}
+
+// Write creates or replaces the data of an Opaque Secret.
+func (p *SecretProvider) Write(ctx context.Context, path string, data map[string]string) error {
+	key, err := splitSecretPath(path)
+	if err != nil {
+		return err
+	}
+
+	var secret corev1.Secret
+	err = p.k8sClient.Get(ctx, key, &secret)
+	if apierrors.IsNotFound(err) {
+		return p.k8sClient.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+			Type:       corev1.SecretTypeOpaque,
+			StringData: data,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	secret.Data = nil
+	secret.StringData = data
+	return p.k8sClient.Update(ctx, &secret)
+}
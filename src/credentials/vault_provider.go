@@ -0,0 +1,299 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// VaultConfig configures the Vault KV v2 provider.
+type VaultConfig struct {
+	// Address of the Vault server, e.g. "https://vault.example.com:8200".
+	Address string
+
+	// Namespace is sent as X-Vault-Namespace (Vault Enterprise only).
+	Namespace string
+
+	// AuthMethod is either "token" or "kubernetes".
+	AuthMethod string
+
+	// Token used with the "token" auth method.
+	Token string
+
+	// Role used with the "kubernetes" auth method.
+	KubernetesRole string
+
+	// Mount path of the Kubernetes auth method (defaults to "kubernetes").
+	KubernetesMount string
+
+	// Path of the service account token used to log in
+	// (defaults to the in-cluster service account token).
+	ServiceAccountTokenPath string
+
+	// Optional PEM file with the CA used to verify the Vault server.
+	CACertFile string
+}
+
+// VaultProvider implements Provider on top of the Vault KV v2 HTTP API.
+type VaultProvider struct {
+	cfg        VaultConfig
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// NewVaultProvider creates a new VaultProvider.
+func NewVaultProvider(cfg VaultConfig) (*VaultProvider, error) {
+	if cfg.Address == "" {
+		return nil, fmt.Errorf("vault address must be set")
+	}
+	if cfg.AuthMethod == "" {
+		cfg.AuthMethod = "token"
+	}
+	if cfg.KubernetesMount == "" {
+		cfg.KubernetesMount = "kubernetes"
+	}
+	if cfg.ServiceAccountTokenPath == "" {
+		cfg.ServiceAccountTokenPath = defaultServiceAccountTokenPath
+	}
+
+	switch cfg.AuthMethod {
+	case "token":
+		if cfg.Token == "" {
+			return nil, fmt.Errorf("vault token must be set for token auth")
+		}
+	case "kubernetes":
+		if cfg.KubernetesRole == "" {
+			return nil, fmt.Errorf("vault role must be set for kubernetes auth")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported vault auth method: %s", cfg.AuthMethod)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.CACertFile != "" {
+		pem, err := os.ReadFile(cfg.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read vault CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in vault CA file %s", cfg.CACertFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &VaultProvider{
+		cfg:        cfg,
+		httpClient: &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		token:      cfg.Token,
+	}, nil
+}
+
+// splitKVPath splits "<mount>/<path>" into its parts.
+func splitKVPath(path string) (string, string, error) {
+	mount, rest, ok := strings.Cut(strings.Trim(path, "/"), "/")
+	if !ok || mount == "" || rest == "" {
+		return "", "", fmt.Errorf("invalid vault path %q, expected <mount>/<path>", path)
+	}
+	return mount, rest, nil
+}
+
+// Read returns the latest version of the KV v2 secret at path.
+func (p *VaultProvider) Read(ctx context.Context, path string) (map[string]string, error) {
+	mount, rest, err := splitKVPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	status, err := p.do(ctx, http.MethodGet, "/v1/"+mount+"/data/"+rest, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound || resp.Data.Data == nil {
+		return nil, fmt.Errorf("%w: vault path %s", ErrNotFound, path)
+	}
+
+	data := make(map[string]string, len(resp.Data.Data))
+	for k, v := range resp.Data.Data {
+		switch val := v.(type) {
+		case string:
+			data[k] = val
+		default:
+			data[k] = fmt.Sprint(val)
+		}
+	}
+	return data, nil
+}
+
+// Write stores data as a new version of the KV v2 secret at path.
+func (p *VaultProvider) Write(ctx context.Context, path string, data map[string]string) error {
+	mount, rest, err := splitKVPath(path)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{"data": data}
+	_, err = p.do(ctx, http.MethodPost, "/v1/"+mount+"/data/"+rest, body, nil)
+	return err
+}
+
+// ReadMetadata returns the custom_metadata of the KV v2 secret at path.
+func (p *VaultProvider) ReadMetadata(ctx context.Context, path string) (map[string]string, error) {
+	mount, rest, err := splitKVPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data struct {
+			CustomMetadata map[string]string `json:"custom_metadata"`
+		} `json:"data"`
+	}
+	status, err := p.do(ctx, http.MethodGet, "/v1/"+mount+"/metadata/"+rest, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound || resp.Data.CustomMetadata == nil {
+		return map[string]string{}, nil
+	}
+	return resp.Data.CustomMetadata, nil
+}
+
+// WriteMetadata replaces the custom_metadata of the KV v2 secret at path.
+// The other metadata settings are left alone.
+func (p *VaultProvider) WriteMetadata(ctx context.Context, path string, metadata map[string]string) error {
+	mount, rest, err := splitKVPath(path)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{"custom_metadata": metadata}
+	_, err = p.do(ctx, http.MethodPost, "/v1/"+mount+"/metadata/"+rest, body, nil)
+	return err
+}
+
+// do performs an authenticated request. A 403 triggers one re-login for
+// Kubernetes auth. 404 is returned as status without an error.
+func (p *VaultProvider) do(ctx context.Context, method, apiPath string, body interface{}, out interface{}) (int, error) {
+	for attempt := 0; ; attempt++ {
+		token, err := p.clientToken(ctx)
+		if err != nil {
+			return 0, err
+		}
+
+		status, err := p.request(ctx, method, apiPath, token, body, out)
+		if status == http.StatusForbidden && attempt == 0 && p.cfg.AuthMethod == "kubernetes" {
+			p.mu.Lock()
+			p.token = ""
+			p.mu.Unlock()
+			continue
+		}
+		return status, err
+	}
+}
+
+func (p *VaultProvider) request(ctx context.Context, method, apiPath, token string, body interface{}, out interface{}) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(p.cfg.Address, "/")+apiPath, reader)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if p.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.cfg.Namespace)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("vault request error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return resp.StatusCode, nil
+	}
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return resp.StatusCode, fmt.Errorf("vault %s %s failed: %s: %s", method, apiPath, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("vault response decode error: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// clientToken returns a valid Vault token, logging in with the Kubernetes
+// auth method when needed.
+func (p *VaultProvider) clientToken(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cfg.AuthMethod == "token" {
+		return p.token, nil
+	}
+	if p.token != "" && time.Now().Before(p.tokenExpiry) {
+		return p.token, nil
+	}
+
+	jwt, err := os.ReadFile(p.cfg.ServiceAccountTokenPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read service account token: %w", err)
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	body := map[string]string{
+		"role": p.cfg.KubernetesRole,
+		"jwt":  strings.TrimSpace(string(jwt)),
+	}
+	status, err := p.request(ctx, http.MethodPost, "/v1/auth/"+p.cfg.KubernetesMount+"/login", "", body, &resp)
+	if err != nil {
+		return "", fmt.Errorf("vault kubernetes login failed: %w", err)
+	}
+	if status == http.StatusNotFound || resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault kubernetes login returned no token")
+	}
+
+	// Renew a bit before the lease actually runs out.
+	lease := time.Duration(resp.Auth.LeaseDuration) * time.Second
+	p.token = resp.Auth.ClientToken
+	p.tokenExpiry = time.Now().Add(lease * 9 / 10)
+	return p.token, nil
+}
@@ -2,20 +2,62 @@ package db
 
 import (
 	"context"
+	"time"
 )
 
-// CreateDatabaseParams contains all connection and database creation parameters.
-type CreateDatabaseParams struct {
+// ConnectionParams describes how an adapter connects to the target server
+// as the admin user.
+type ConnectionParams struct {
 	Host      string
 	Port      int32
 	AdminUser string
 	Password  string
-	Name      string
 
 	// SSLMode controls how the adapter connects to Postgres.
 	// Examples: "disable", "require", "verify-ca", "verify-full".
 	// If empty, the adapter will fall back to a safe default ("disable" or similar).
 	SSLMode string
+
+	// SSLRootCert is a PEM bundle of CA certificates used to verify the
+	// server certificate. If empty, the system roots are used.
+	SSLRootCert []byte
+
+	// SSLClientCert and SSLClientKey are a PEM client certificate and key
+	// used for certificate authentication. Both or neither must be set.
+	SSLClientCert []byte
+	SSLClientKey  []byte
+}
+
+// CreateDatabaseParams contains all connection and database creation parameters.
+type CreateDatabaseParams struct {
+	ConnectionParams
+
+	Name string
+
+	// Owner identifies the resource managing the database, recorded in its
+	// managed marker. A database marked for another owner is a Conflict.
+	Owner string
+
+	// Adopt allows taking over an existing database that is not marked as
+	// managed by the operator. Without it such a database is a Conflict.
+	Adopt bool
+
+	// Extensions to create inside the database if they are missing.
+	Extensions []string
+
+	// Template is a managed database on the same server the database is
+	// copied from when it is created. Sessions connected to it are
+	// terminated first.
+	Template string
+
+	// Hardening restricts PUBLIC in the database when set.
+	Hardening *Hardening
+}
+
+// Hardening revokes CONNECT and TEMPORARY on the database and CREATE on
+// schema public from PUBLIC, and makes Owner own both.
+type Hardening struct {
+	Owner string
 }
 
 // UserAccess describes access to a single database/instance.
@@ -27,20 +69,162 @@ type UserAccess struct {
 
 // EnsureUserParams contains all parameters needed to create/update a DB user.
 type EnsureUserParams struct {
-	Host      string
-	Port      int32
-	AdminUser string
-	Password  string
-	SSLMode   string
+	ConnectionParams
 
 	Username string
 	// GeneratedPassword is the password that will be set for the user.
 	GeneratedPassword string
 
 	Access []UserAccess
+
+	// Owner identifies the resource managing the role, recorded in its
+	// managed marker. A role marked for another owner is a Conflict.
+	Owner string
+
+	// Adopt allows taking over an existing role that is not marked as
+	// managed by the operator. Without it such a role is a Conflict.
+	Adopt bool
+
+	// KeepPassword leaves the password of an adopted role unchanged;
+	// GeneratedPassword is then its current password. Roles that are
+	// created or already managed always get GeneratedPassword.
+	KeepPassword bool
+
+	// PasswordEncryption selects how the password is hashed before it is
+	// sent: PasswordEncryptionSCRAM (default) or PasswordEncryptionMD5 for
+	// servers and clients that only support md5.
+	PasswordEncryption string
+}
+
+// EnsureUserResult reports what EnsureUser did.
+type EnsureUserResult struct {
+	// PasswordEncryption of the password that was set; empty when the
+	// password was left unchanged.
+	PasswordEncryption string
+}
+
+// PasswordRules describes what an engine accepts as password. Generated
+// passwords and password policies are validated against them.
+type PasswordRules struct {
+	// MinLength and MaxLength bound the password length (0: no bound).
+	MinLength int
+	MaxLength int
+
+	// MinClasses is the number of character classes (lowercase, uppercase,
+	// digits, symbols) a password must mix.
+	MinClasses int
+
+	// Forbidden characters are never used in generated passwords.
+	Forbidden string
+}
+
+// DatabaseState is the observed state of a database on the server.
+type DatabaseState struct {
+	Exists bool
+
+	// MissingExtensions lists the requested extensions not installed in the database.
+	MissingExtensions []string
+
+	// HardeningViolations describes every deviation from params.Hardening.
+	HardeningViolations []string
+}
+
+// ServerState is the observed load of a server, used to place new databases.
+type ServerState struct {
+	// Databases is the number of databases other than templates and "postgres".
+	Databases int
+
+	// SizeBytes is the total size of those databases. Databases the admin
+	// user cannot connect to are not counted.
+	SizeBytes int64
+
+	// HasDatabase reports whether the database of the params already exists.
+	HasDatabase bool
+}
+
+// Migration is one SQL migration file.
+type Migration struct {
+	// Version orders the migrations; each version is applied once.
+	Version int64
+
+	// Name is the file name, recorded in the tracking table.
+	Name string
+
+	// SQL may contain several statements. It runs in one transaction.
+	SQL string
+
+	// Checksum of SQL, compared with the recorded one to detect migrations
+	// changed after they were applied.
+	Checksum string
+}
+
+// MigrateParams describes the migrations to apply to the database params.Name.
+type MigrateParams struct {
+	CreateDatabaseParams
+
+	// Role runs the migrations (SET ROLE) and owns the objects they create
+	// and the tracking table.
+	Role string
+
+	// Table is the tracking table, optionally schema-qualified.
+	Table string
+
+	// Migrations ordered by version.
+	Migrations []Migration
+}
+
+// MigrateResult reports what ApplyMigrations did, also when it failed.
+type MigrateResult struct {
+	// Version is the highest applied version (0: none).
+	Version int64
+
+	// Applied is the number of migrations applied by this call.
+	Applied int
+}
+
+// SQLScript is SQL run by RunScripts, possibly several statements.
+type SQLScript struct {
+	// Name identifies the script in the audit log instead of its SQL,
+	// which may contain secrets.
+	Name string
+
+	SQL string
+}
+
+// JobRoleParams describes the short-lived role a Job connects to the
+// database DBName as.
+type JobRoleParams struct {
+	ConnectionParams
+
+	DBName   string
+	Role     string
+	Password string
+
+	// ValidUntil is when the role can no longer log in.
+	ValidUntil time.Time
+
+	// Write lets the role create objects in the database; otherwise it can
+	// only read.
+	Write bool
+
+	// MemberOf are roles the role is granted, e.g. the owner of the objects
+	// a restore replaces.
+	MemberOf []string
+}
+
+// UserState is the observed state of a role on the server, compared with
+// the access rules it was observed for.
+type UserState struct {
+	Exists   bool
+	CanLogin bool
+
+	// MissingPrivileges describes expected privileges the role does not hold.
+	MissingPrivileges []string
 }
 
 // Adapter defines the interface all DB backends must implement.
+// Errors returned by implementations should be *Error values so that
+// callers can use CategoryOf to decide how to retry.
 type Adapter interface {
 	// CreateDatabase ensures that a database exists on the target server.
 	// Implementations should be idempotent.
@@ -49,5 +233,50 @@ type Adapter interface {
 	// EnsureUser ensures that the given user exists and has the requested access.
 	// Implementations should be idempotent: if the user already exists, they
 	// should update the password and privileges accordingly.
-	EnsureUser(ctx context.Context, params EnsureUserParams) error
+	EnsureUser(ctx context.Context, params EnsureUserParams) (EnsureUserResult, error)
+
+	// PasswordRules describes which passwords the server accepts.
+	PasswordRules() PasswordRules
+
+	// ObserveDatabase reports the current state of the database on the server.
+	ObserveDatabase(ctx context.Context, params CreateDatabaseParams) (*DatabaseState, error)
+
+	// ObserveServer reports the load of the server of params and whether
+	// the database params.Name exists on it.
+	ObserveServer(ctx context.Context, params CreateDatabaseParams) (*ServerState, error)
+
+	// ObserveUser reports the current state of the role and which of the
+	// privileges implied by params.Access it is missing. The password is not checked.
+	ObserveUser(ctx context.Context, params EnsureUserParams) (*UserState, error)
+
+	// DropDatabase drops the database params.Name if it exists. A database
+	// not managed for params.Owner is a Conflict and is left in place.
+	DropDatabase(ctx context.Context, params CreateDatabaseParams) error
+
+	// DropUser drops the role params.Username if it exists, after handing the
+	// objects it owns in the databases of params.Access over to the admin
+	// user. A role not managed for params.Owner is a Conflict.
+	DropUser(ctx context.Context, params EnsureUserParams) error
+
+	// TransferOwnership hands the objects the admin user owns in the
+	// database params.Name over to the role owner. Objects belonging to
+	// extensions are left alone.
+	TransferOwnership(ctx context.Context, params CreateDatabaseParams, owner string) error
+
+	// ApplyMigrations applies the migrations of params not recorded in the
+	// tracking table yet, in order and each in its own transaction, while
+	// holding an advisory lock. It stops at the first failure.
+	ApplyMigrations(ctx context.Context, params MigrateParams) (MigrateResult, error)
+
+	// RunScripts runs scripts in the database params.Name as the admin
+	// user, in order and in one transaction.
+	RunScripts(ctx context.Context, params CreateDatabaseParams, scripts []SQLScript) error
+
+	// EnsureJobRole creates or renews the role a Job connects as instead
+	// of the admin user.
+	EnsureJobRole(ctx context.Context, params JobRoleParams) error
+
+	// DropJobRole drops the role of a finished Job, handing the objects it
+	// owns over to the admin user. A missing role is not an error.
+	DropJobRole(ctx context.Context, params JobRoleParams) error
 }
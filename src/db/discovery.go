@@ -0,0 +1,212 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// Inventory is the server-wide catalog information used to generate
+// manifests for existing databases and roles.
+type Inventory struct {
+	Databases      []DiscoveredDatabase
+	Roles          []DiscoveredRole
+	DatabaseGrants []DatabaseGrant
+}
+
+// DiscoveredDatabase is a database that accepts connections.
+type DiscoveredDatabase struct {
+	Name  string
+	Owner string
+}
+
+// DiscoveredRole is a role with its attributes and the roles it is a member of.
+type DiscoveredRole struct {
+	Name      string
+	CanLogin  bool
+	Superuser bool
+	MemberOf  []string
+}
+
+// DatabaseGrant is one explicitly granted database privilege (e.g. CONNECT).
+// Privileges granted to PUBLIC are not included.
+type DatabaseGrant struct {
+	Database  string
+	Role      string
+	Privilege string
+}
+
+// TableGrant is a privilege a role explicitly holds on tables of the public
+// schema. AllTables reports whether it is held on every table.
+type TableGrant struct {
+	Role      string
+	Privilege string
+	AllTables bool
+}
+
+// SchemaGrants lists what roles hold on the public schema of one database.
+type SchemaGrants struct {
+	// UsageRoles hold USAGE on the public schema.
+	UsageRoles []string
+	Tables     []TableGrant
+}
+
+// Discoverer is implemented by adapters that can list existing objects.
+type Discoverer interface {
+	// DiscoverServer lists databases, roles, memberships and database grants.
+	DiscoverServer(ctx context.Context, conn ConnectionParams) (*Inventory, error)
+
+	// DiscoverSchemaGrants lists schema and table grants inside one database.
+	DiscoverSchemaGrants(ctx context.Context, conn ConnectionParams, dbName string) (*SchemaGrants, error)
+}
+
+// DiscoverServer reads the instance-wide catalogs. Template databases and
+// databases that do not accept connections are skipped.
+func (p *PostgresAdapter) DiscoverServer(ctx context.Context, params ConnectionParams) (_ *Inventory, err error) {
+	defer func() { err = classify(err) }()
+
+	conn, err := p.connect(ctx, params, "postgres")
+	if err != nil {
+		return nil, fmt.Errorf("postgres connect error: %w", err)
+	}
+	defer conn.Release()
+
+	inv := &Inventory{}
+
+	rows, err := conn.Query(ctx, `
+SELECT d.datname, pg_get_userbyid(d.datdba)
+FROM pg_database d
+WHERE NOT d.datistemplate AND d.datallowconn
+ORDER BY 1`)
+	if err != nil {
+		return nil, fmt.Errorf("postgres list databases error: %w", err)
+	}
+	for rows.Next() {
+		var d DiscoveredDatabase
+		if err := rows.Scan(&d.Name, &d.Owner); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		inv.Databases = append(inv.Databases, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres list databases error: %w", err)
+	}
+
+	rows, err = conn.Query(ctx, `
+SELECT r.rolname, r.rolcanlogin, r.rolsuper,
+       coalesce(array_agg(m.rolname ORDER BY m.rolname) FILTER (WHERE m.rolname IS NOT NULL), '{}')
+FROM pg_roles r
+LEFT JOIN pg_auth_members am ON am.member = r.oid
+LEFT JOIN pg_roles m ON m.oid = am.roleid
+GROUP BY r.rolname, r.rolcanlogin, r.rolsuper
+ORDER BY 1`)
+	if err != nil {
+		return nil, fmt.Errorf("postgres list roles error: %w", err)
+	}
+	for rows.Next() {
+		var r DiscoveredRole
+		if err := rows.Scan(&r.Name, &r.CanLogin, &r.Superuser, &r.MemberOf); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		inv.Roles = append(inv.Roles, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres list roles error: %w", err)
+	}
+
+	rows, err = conn.Query(ctx, `
+SELECT d.datname, r.rolname, a.privilege_type
+FROM pg_database d
+CROSS JOIN LATERAL aclexplode(d.datacl) a
+JOIN pg_roles r ON r.oid = a.grantee
+WHERE NOT d.datistemplate AND d.datallowconn
+ORDER BY 1, 2, 3`)
+	if err != nil {
+		return nil, fmt.Errorf("postgres list database grants error: %w", err)
+	}
+	for rows.Next() {
+		var g DatabaseGrant
+		if err := rows.Scan(&g.Database, &g.Role, &g.Privilege); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		inv.DatabaseGrants = append(inv.DatabaseGrants, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres list database grants error: %w", err)
+	}
+
+	return inv, nil
+}
+
+// DiscoverSchemaGrants reads the explicit grants on the public schema of
+// dbName and on the tables and views in it.
+func (p *PostgresAdapter) DiscoverSchemaGrants(ctx context.Context, params ConnectionParams, dbName string) (_ *SchemaGrants, err error) {
+	defer func() { err = classify(err) }()
+
+	conn, err := p.connect(ctx, params, dbName)
+	if err != nil {
+		return nil, fmt.Errorf("postgres connect to db %s error: %w", dbName, err)
+	}
+	defer conn.Release()
+
+	grants := &SchemaGrants{}
+
+	rows, err := conn.Query(ctx, `
+SELECT r.rolname
+FROM pg_namespace n
+CROSS JOIN LATERAL aclexplode(n.nspacl) a
+JOIN pg_roles r ON r.oid = a.grantee
+WHERE n.nspname = 'public' AND a.privilege_type = 'USAGE'
+ORDER BY 1`)
+	if err != nil {
+		return nil, fmt.Errorf("postgres list schema grants on %s error: %w", dbName, err)
+	}
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		grants.UsageRoles = append(grants.UsageRoles, role)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres list schema grants on %s error: %w", dbName, err)
+	}
+
+	rows, err = conn.Query(ctx, `
+WITH t AS (
+  SELECT c.relacl
+  FROM pg_class c
+  JOIN pg_namespace n ON n.oid = c.relnamespace
+  WHERE n.nspname = 'public' AND c.relkind IN ('r', 'p', 'v', 'm', 'f')
+)
+SELECT r.rolname, a.privilege_type, count(*) = (SELECT count(*) FROM t)
+FROM t
+CROSS JOIN LATERAL aclexplode(t.relacl) a
+JOIN pg_roles r ON r.oid = a.grantee
+GROUP BY r.rolname, a.privilege_type
+ORDER BY 1, 2`)
+	if err != nil {
+		return nil, fmt.Errorf("postgres list table grants on %s error: %w", dbName, err)
+	}
+	for rows.Next() {
+		var g TableGrant
+		if err := rows.Scan(&g.Role, &g.Privilege, &g.AllTables); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		grants.Tables = append(grants.Tables, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("postgres list table grants on %s error: %w", dbName, err)
+	}
+
+	return grants, nil
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrorCategory classifies adapter failures so that callers can decide
+// whether and how to retry.
+type ErrorCategory string
+
+const (
+	// CategoryAuthFailed: the server rejected the admin credentials.
+	CategoryAuthFailed ErrorCategory = "AuthFailed"
+
+	// CategoryUnreachable: the server could not be reached (network, TLS, shutdown).
+	CategoryUnreachable ErrorCategory = "Unreachable"
+
+	// CategoryPermissionDenied: the admin user lacks a required privilege.
+	CategoryPermissionDenied ErrorCategory = "PermissionDenied"
+
+	// CategoryInvalidSpec: the request cannot succeed as specified
+	// (unknown role/scope, missing database, bad identifier...).
+	CategoryInvalidSpec ErrorCategory = "InvalidSpec"
+
+	// CategoryConflict: the target object is in a state that conflicts with
+	// the request (already exists, in use...).
+	CategoryConflict ErrorCategory = "Conflict"
+
+	// CategoryTransient: anything that is likely to succeed when retried.
+	CategoryTransient ErrorCategory = "Transient"
+)
+
+// Permanent reports whether retrying is pointless until the spec or the
+// credentials change.
+func (c ErrorCategory) Permanent() bool {
+	switch c {
+	case CategoryAuthFailed, CategoryPermissionDenied, CategoryInvalidSpec, CategoryConflict:
+		return true
+	}
+	return false
+}
+
+// Error is an adapter error tagged with its category.
+type Error struct {
+	Category ErrorCategory
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// newError creates a categorised error from a format string.
+func newError(category ErrorCategory, format string, args ...interface{}) error {
+	return &Error{Category: category, Err: fmt.Errorf(format, args...)}
+}
+
+// CategoryOf returns the category of err. Errors that were not classified
+// by an adapter are considered transient.
+func CategoryOf(err error) ErrorCategory {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Category
+	}
+	return CategoryTransient
+}
+
+// classify wraps err with the category derived from its SQLSTATE code or
+// network error type. Already classified errors are returned unchanged.
+func classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return &Error{Category: categorize(err), Err: err}
+}
+
+func categorize(err error) ErrorCategory {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return categorizeSQLState(pgErr.Code)
+	}
+
+	var netErr net.Error
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certInvalid x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &netErr),
+		errors.Is(err, io.EOF),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &unknownAuthority),
+		errors.As(err, &hostnameErr),
+		errors.As(err, &certInvalid):
+		return CategoryUnreachable
+	}
+
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) {
+		return CategoryUnreachable
+	}
+
+	return CategoryTransient
+}
+
+// categorizeSQLState maps Postgres SQLSTATE codes to categories.
+// See https://www.postgresql.org/docs/current/errcodes-appendix.html
+func categorizeSQLState(code string) ErrorCategory {
+	switch code {
+	case "28000", "28P01": // invalid_authorization_specification, invalid_password
+		return CategoryAuthFailed
+	case "42501": // insufficient_privilege
+		return CategoryPermissionDenied
+	case "42P04", "42710", "23505", "55006": // duplicate_database, duplicate_object, unique_violation, object_in_use
+		return CategoryConflict
+	case "57P01", "57P02", "57P03": // admin_shutdown, crash_shutdown, cannot_connect_now
+		return CategoryUnreachable
+	case "42704": // undefined_object
+		return CategoryInvalidSpec
+	case "40001", "40P01", "55P03", "57014": // serialization_failure, deadlock_detected, lock_not_available, query_canceled
+		return CategoryTransient
+	case "3D000": // invalid_catalog_name: the database may not be created yet
+		return CategoryTransient
+	}
+
+	switch {
+	case strings.HasPrefix(code, "08"): // connection_exception
+		return CategoryUnreachable
+	case strings.HasPrefix(code, "53"): // insufficient_resources
+		return CategoryTransient
+	case strings.HasPrefix(code, "42"), strings.HasPrefix(code, "22"): // syntax/access rule, data exception
+		return CategoryInvalidSpec
+	}
+
+	return CategoryTransient
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestCategorizeSQLState(t *testing.T) {
+	tests := []struct {
+		code string
+		want ErrorCategory
+	}{
+		{"28000", CategoryAuthFailed},
+		{"28P01", CategoryAuthFailed},
+		{"42501", CategoryPermissionDenied},
+		{"42P04", CategoryConflict},
+		{"42710", CategoryConflict},
+		{"23505", CategoryConflict},
+		{"55006", CategoryConflict},
+		{"57P01", CategoryUnreachable},
+		{"57P02", CategoryUnreachable},
+		{"57P03", CategoryUnreachable},
+		{"08006", CategoryUnreachable},
+		{"08001", CategoryUnreachable},
+		{"42704", CategoryInvalidSpec},
+		{"42601", CategoryInvalidSpec},
+		{"42P01", CategoryInvalidSpec},
+		{"22023", CategoryInvalidSpec},
+		{"3D000", CategoryTransient},
+		{"40001", CategoryTransient},
+		{"40P01", CategoryTransient},
+		{"55P03", CategoryTransient},
+		{"57014", CategoryTransient},
+		{"53300", CategoryTransient},
+		{"XX000", CategoryTransient},
+		{"", CategoryTransient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			if got := categorizeSQLState(tt.code); got != tt.want {
+				t.Errorf("categorizeSQLState(%q) = %s, want %s", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorCategory
+	}{
+		{"pg error", &pgconn.PgError{Code: "28P01"}, CategoryAuthFailed},
+		{"wrapped pg error", fmt.Errorf("postgres create role error: %w", &pgconn.PgError{Code: "42501"}), CategoryPermissionDenied},
+		{"already classified", newError(CategoryConflict, "taken"), CategoryConflict},
+		{"eof", io.ErrUnexpectedEOF, CategoryUnreachable},
+		{"deadline", context.DeadlineExceeded, CategoryUnreachable},
+		{"other", errors.New("boom"), CategoryTransient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classify(tt.err)
+			if got := CategoryOf(err); got != tt.want {
+				t.Errorf("CategoryOf(classify(%v)) = %s, want %s", tt.err, got, tt.want)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("classify(%v) does not wrap the original error", tt.err)
+			}
+		})
+	}
+	if classify(nil) != nil {
+		t.Error("classify(nil) is not nil")
+	}
+}
+
+func TestErrorCategoryPermanent(t *testing.T) {
+	tests := []struct {
+		category ErrorCategory
+		want     bool
+	}{
+		{CategoryAuthFailed, true},
+		{CategoryPermissionDenied, true},
+		{CategoryInvalidSpec, true},
+		{CategoryConflict, true},
+		{CategoryUnreachable, false},
+		{CategoryTransient, false},
+	}
+	for _, tt := range tests {
+		if got := tt.category.Permanent(); got != tt.want {
+			t.Errorf("%s.Permanent() = %v, want %v", tt.category, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mertsaygi/orchestrdb/src/audit"
+)
+
+// execer is implemented by pooled connections and transactions.
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// target is the server and database a statement runs on, for auditing.
+type target struct {
+	server   string
+	database string
+}
+
+func targetOf(conn ConnectionParams, dbName string) target {
+	return target{
+		server:   net.JoinHostPort(conn.Host, strconv.Itoa(int(conn.Port))),
+		database: dbName,
+	}
+}
+
+// exec runs a statement that changes the server and audits it, or records
+// it in the dry-run plan.
+func (p *PostgresAdapter) exec(ctx context.Context, q execer, t target, stmt string) error {
+	return p.execRedacted(ctx, q, t, stmt, stmt)
+}
+
+// execRedacted is exec for statements containing secrets: redacted is
+// audited and planned instead of stmt.
+func (p *PostgresAdapter) execRedacted(ctx context.Context, q execer, t target, stmt, redacted string) error {
+	if plan := planFrom(ctx); plan != nil {
+		plan.Statements = append(plan.Statements, redacted)
+		return nil
+	}
+	_, err := q.Exec(ctx, stmt)
+	p.audit(ctx, t, redacted, err)
+	return err
+}
+
+// commit commits tx and audits it. Statements run in a transaction only
+// take effect if a successful COMMIT for the same target follows them.
+func (p *PostgresAdapter) commit(ctx context.Context, tx pgx.Tx, t target) error {
+	err := tx.Commit(ctx)
+	if planFrom(ctx) == nil {
+		p.audit(ctx, t, "COMMIT", err)
+	}
+	return err
+}
+
+func (p *PostgresAdapter) audit(ctx context.Context, t target, stmt string, err error) {
+	rec := audit.Record{
+		Server:    t.server,
+		Database:  t.database,
+		Statement: stmt,
+		Outcome:   audit.OutcomeSuccess,
+	}
+	if err != nil {
+		rec.Outcome = audit.OutcomeFailure
+		rec.Error = err.Error()
+	}
+	p.auditor.Record(ctx, rec)
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Password encryptions for EnsureUserParams.PasswordEncryption.
+const (
+	PasswordEncryptionSCRAM = "scram-sha-256"
+	PasswordEncryptionMD5   = "md5"
+)
+
+// scramIterations matches the PostgreSQL default (scram_iterations).
+const scramIterations = 4096
+
+// passwordVerifier returns the form of password stored by the server for the
+// given encryption. The server recognises pre-hashed values and stores them
+// as-is, so the plaintext never appears in statement logs or
+// pg_stat_statements.
+func passwordVerifier(encryption, username, password string) (string, error) {
+	switch encryption {
+	case "", PasswordEncryptionSCRAM:
+		return scramSHA256Verifier(password)
+	case PasswordEncryptionMD5:
+		return md5Verifier(username, password), nil
+	default:
+		return "", newError(CategoryInvalidSpec, "unsupported password encryption: %s", encryption)
+	}
+}
+
+// scramSHA256Verifier computes a SCRAM-SHA-256 verifier (RFC 5802/7677) in
+// the format of pg_authid.rolpassword:
+//
+//	SCRAM-SHA-256$<iterations>:<salt>$<StoredKey>:<ServerKey>
+//
+// The server applies SASLprep to the password during authentication; that is
+// the identity for the ASCII passwords the operator generates.
+func scramSHA256Verifier(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return scramSHA256VerifierWithSalt(password, salt, scramIterations), nil
+}
+
+// scramSHA256VerifierWithSalt computes the verifier for a given salt and
+// iteration count.
+func scramSHA256VerifierWithSalt(password string, salt []byte, iterations int) string {
+	salted := pbkdf2.Key([]byte(password), salt, iterations, sha256.Size, sha256.New)
+	clientKey := hmacSHA256(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	serverKey := hmacSHA256(salted, "Server Key")
+
+	enc := base64.StdEncoding
+	return fmt.Sprintf("SCRAM-SHA-256$%d:%s$%s:%s",
+		iterations,
+		enc.EncodeToString(salt),
+		enc.EncodeToString(storedKey[:]),
+		enc.EncodeToString(serverKey),
+	)
+}
+
+func hmacSHA256(key []byte, msg string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
+
+// md5Verifier computes the legacy "md5" || md5(password || username) form.
+func md5Verifier(username, password string) string {
+	sum := md5.Sum([]byte(password + username))
+	return "md5" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// rfc7677 is the SCRAM-SHA-256 exchange of RFC 7677, section 3.
+var rfc7677 = struct {
+	password, salt               string
+	iterations                   int
+	authMessage                  string
+	clientProof, serverSignature string
+}{
+	password:   "pencil",
+	salt:       "W22ZaJ0SNY7soEsUEjb6gQ==",
+	iterations: 4096,
+	authMessage: "n=user,r=rOprNGfwEbeRWgbNEkqO," +
+		"r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096," +
+		"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0",
+	clientProof:     "dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=",
+	serverSignature: "6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=",
+}
+
+var scramVerifierPattern = regexp.MustCompile(`^SCRAM-SHA-256\$(\d+):([A-Za-z0-9+/=]+)\$([A-Za-z0-9+/=]+):([A-Za-z0-9+/=]+)$`)
+
+// parseSCRAMVerifier splits a verifier into iterations, salt, StoredKey and ServerKey.
+func parseSCRAMVerifier(t *testing.T, verifier string) (int, []byte, []byte, []byte) {
+	t.Helper()
+	match := scramVerifierPattern.FindStringSubmatch(verifier)
+	if match == nil {
+		t.Fatalf("malformed verifier %q", verifier)
+	}
+	iterations, _ := strconv.Atoi(match[1])
+	var parts [3][]byte
+	for i, s := range match[2:] {
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatalf("verifier %q: %v", verifier, err)
+		}
+		parts[i] = b
+	}
+	return iterations, parts[0], parts[1], parts[2]
+}
+
+// TestSCRAMSHA256VerifierRFC7677 checks that a server holding the verifier
+// accepts the client proof of RFC 7677 and answers with its server signature.
+func TestSCRAMSHA256VerifierRFC7677(t *testing.T) {
+	salt, _ := base64.StdEncoding.DecodeString(rfc7677.salt)
+	verifier := scramSHA256VerifierWithSalt(rfc7677.password, salt, rfc7677.iterations)
+
+	iterations, gotSalt, storedKey, serverKey := parseSCRAMVerifier(t, verifier)
+	if iterations != rfc7677.iterations || base64.StdEncoding.EncodeToString(gotSalt) != rfc7677.salt {
+		t.Fatalf("verifier %q does not carry the iterations and salt", verifier)
+	}
+
+	proof, _ := base64.StdEncoding.DecodeString(rfc7677.clientProof)
+	clientSignature := hmacSHA256(storedKey, rfc7677.authMessage)
+	clientKey := make([]byte, len(proof))
+	for i := range proof {
+		clientKey[i] = proof[i] ^ clientSignature[i]
+	}
+	if sum := sha256.Sum256(clientKey); !hmac.Equal(sum[:], storedKey) {
+		t.Errorf("StoredKey of %q does not accept the RFC 7677 client proof", verifier)
+	}
+
+	serverSignature := base64.StdEncoding.EncodeToString(hmacSHA256(serverKey, rfc7677.authMessage))
+	if serverSignature != rfc7677.serverSignature {
+		t.Errorf("server signature = %s, want %s", serverSignature, rfc7677.serverSignature)
+	}
+}
+
+func TestPasswordVerifier(t *testing.T) {
+	tests := []struct {
+		name       string
+		encryption string
+		username   string
+		password   string
+		want       string // exact verifier; empty for salted ones
+		wantPrefix string
+		wantErr    bool
+	}{
+		{name: "default is scram", username: "app", password: "pencil", wantPrefix: "SCRAM-SHA-256$4096:"},
+		{name: "scram", encryption: PasswordEncryptionSCRAM, username: "app", password: "pencil", wantPrefix: "SCRAM-SHA-256$4096:"},
+		{name: "md5", encryption: PasswordEncryptionMD5, username: "postgres", password: "postgres", want: "md53175bce1d3201d16594cebf9d7eb3f9d"},
+		{name: "unknown", encryption: "password", username: "app", password: "pencil", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := passwordVerifier(tt.encryption, tt.username, tt.password)
+			if tt.wantErr {
+				if CategoryOf(err) != CategoryInvalidSpec {
+					t.Fatalf("err = %v, want an InvalidSpec error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != "" && got != tt.want {
+				t.Errorf("verifier = %s, want %s", got, tt.want)
+			}
+			if !strings.HasPrefix(got, tt.wantPrefix) {
+				t.Errorf("verifier = %s, want prefix %s", got, tt.wantPrefix)
+			}
+			if strings.Contains(got, tt.password) {
+				t.Errorf("verifier %s contains the password", got)
+			}
+		})
+	}
+}
+
+func TestSCRAMSHA256VerifierIsSalted(t *testing.T) {
+	a, err := scramSHA256Verifier("pencil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := scramSHA256Verifier("pencil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Errorf("two verifiers of the same password are equal: %s", a)
+	}
+	if _, salt, _, _ := parseSCRAMVerifier(t, a); len(salt) != 16 {
+		t.Errorf("salt has %d bytes, want 16", len(salt))
+	}
+}
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"context"
+)
+
+// Plan collects the statements an adapter would execute in dry-run mode.
+type Plan struct {
+	Statements []string
+}
+
+type planKey struct{}
+
+// WithPlan returns a context that puts adapter calls into dry-run mode:
+// statements that change the server are appended to plan instead of being
+// executed. Catalog reads still run, so the plan reflects the server state.
+func WithPlan(ctx context.Context, plan *Plan) context.Context {
+	return context.WithValue(ctx, planKey{}, plan)
+}
+
+// planFrom returns the dry-run plan of ctx, or nil outside dry-run mode.
+func planFrom(ctx context.Context) *Plan {
+	plan, _ := ctx.Value(planKey{}).(*Plan)
+	return plan
+}
+
+// redactedPassword replaces password literals in recorded statements.
+const redactedPassword = "'********'"
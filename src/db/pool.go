@@ -0,0 +1,237 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PoolOptions configures the connection pools kept by the PostgresAdapter.
+type PoolOptions struct {
+	// MaxConnsPerServer limits the number of connections used concurrently
+	// against a single host:port, across all databases and users. Changes
+	// hold one connection at a time; observations and drops hold up to two
+	// (instance + database), so values below 2 are raised to 2.
+	MaxConnsPerServer int32
+
+	// AcquireTimeout bounds the wait for a free connection slot. Calls
+	// holding a connection while waiting for a second one could otherwise
+	// block each other forever; on timeout they fail as Transient, release
+	// their connection and are retried.
+	AcquireTimeout time.Duration
+
+	// IdleTimeout closes pools (and idle connections) that have not been used
+	// for this long.
+	IdleTimeout time.Duration
+}
+
+// poolKey identifies a pool: one per (host, port, user, db, sslmode).
+type poolKey struct {
+	host    string
+	port    int32
+	user    string
+	dbName  string
+	sslMode string
+}
+
+type poolEntry struct {
+	pool *pgxpool.Pool
+	// fingerprint of the password and TLS material the pool was built with.
+	// A different fingerprint means the admin credentials changed.
+	fingerprint [sha256.Size]byte
+	lastUsed    time.Time
+}
+
+// pooledConn is a pool connection that also holds a per-server slot.
+type pooledConn struct {
+	*pgxpool.Conn
+	slot chan struct{}
+}
+
+// Release returns the connection to its pool and frees the server slot.
+func (c *pooledConn) Release() {
+	c.Conn.Release()
+	<-c.slot
+}
+
+// poolCache keeps pgxpool pools keyed by poolKey.
+type poolCache struct {
+	opts PoolOptions
+
+	mu      sync.Mutex
+	pools   map[poolKey]*poolEntry
+	servers map[string]chan struct{}
+}
+
+func newPoolCache(opts PoolOptions) *poolCache {
+	if opts.MaxConnsPerServer <= 0 {
+		opts.MaxConnsPerServer = 5
+	}
+	if opts.MaxConnsPerServer < 2 {
+		opts.MaxConnsPerServer = 2
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = 5 * time.Minute
+	}
+	if opts.AcquireTimeout <= 0 {
+		opts.AcquireTimeout = 30 * time.Second
+	}
+	return &poolCache{
+		opts:    opts,
+		pools:   map[poolKey]*poolEntry{},
+		servers: map[string]chan struct{}{},
+	}
+}
+
+func connFingerprint(conn ConnectionParams) [sha256.Size]byte {
+	h := sha256.New()
+	for _, part := range [][]byte{
+		[]byte(conn.Password), conn.SSLRootCert, conn.SSLClientCert, conn.SSLClientKey,
+	} {
+		// Length-prefix every part so boundaries cannot be shifted.
+		fmt.Fprintf(h, "%d:", len(part))
+		h.Write(part)
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// acquire returns a connection to dbName, creating or replacing the pool as
+// needed. It blocks while the server is at its connection limit, for at
+// most AcquireTimeout.
+func (c *poolCache) acquire(ctx context.Context, conn ConnectionParams, dbName string, build func() (*pgxpool.Config, error)) (*pooledConn, error) {
+	key := poolKey{
+		host:    conn.Host,
+		port:    conn.Port,
+		user:    conn.AdminUser,
+		dbName:  dbName,
+		sslMode: conn.SSLMode,
+	}
+	fp := connFingerprint(conn)
+
+	pool, slot, err := c.pool(key, fp, build)
+	if err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(c.opts.AcquireTimeout)
+	defer timer.Stop()
+	select {
+	case slot <- struct{}{}:
+	case <-timer.C:
+		return nil, newError(CategoryTransient, "server %s:%d is at its limit of %d connections",
+			key.host, key.port, c.opts.MaxConnsPerServer)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	pc, err := pool.Acquire(ctx)
+	if err != nil {
+		<-slot
+		// Drop the pool so the next attempt starts from scratch (e.g. after
+		// a password rotation that happened on the server first).
+		c.invalidate(key, pool)
+		return nil, err
+	}
+
+	return &pooledConn{Conn: pc, slot: slot}, nil
+}
+
+// pool returns the pool for key, replacing it if the credentials changed.
+func (c *poolCache) pool(key poolKey, fp [sha256.Size]byte, build func() (*pgxpool.Config, error)) (*pgxpool.Pool, chan struct{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.evictIdleLocked(now)
+
+	server := fmt.Sprintf("%s:%d", key.host, key.port)
+	slot, ok := c.servers[server]
+	if !ok {
+		slot = make(chan struct{}, c.opts.MaxConnsPerServer)
+		c.servers[server] = slot
+	}
+
+	if entry, ok := c.pools[key]; ok {
+		if entry.fingerprint == fp {
+			entry.lastUsed = now
+			return entry.pool, slot, nil
+		}
+		// Admin credentials or TLS material changed: retire the old pool.
+		delete(c.pools, key)
+		go entry.pool.Close()
+	}
+
+	cfg, err := build()
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg.MaxConns = c.opts.MaxConnsPerServer
+	cfg.MinConns = 0
+	cfg.MaxConnIdleTime = c.opts.IdleTimeout
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.pools[key] = &poolEntry{pool: pool, fingerprint: fp, lastUsed: now}
+	return pool, slot, nil
+}
+
+// invalidate removes pool from the cache if it is still the current one for key.
+func (c *poolCache) invalidate(key poolKey, pool *pgxpool.Pool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.pools[key]; ok && entry.pool == pool {
+		delete(c.pools, key)
+		go pool.Close()
+	}
+}
+
+// closeDatabase retires every pool connected to dbName on host:port, so no
+// new sessions are opened to a database about to be dropped.
+func (c *poolCache) closeDatabase(host string, port int32, dbName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, entry := range c.pools {
+		if key.host == host && key.port == port && key.dbName == dbName {
+			delete(c.pools, key)
+			go entry.pool.Close()
+		}
+	}
+}
+
+// evictIdle closes pools that have not been used within the idle timeout.
+func (c *poolCache) evictIdle() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evictIdleLocked(time.Now())
+}
+
+func (c *poolCache) evictIdleLocked(now time.Time) {
+	for key, entry := range c.pools {
+		if now.Sub(entry.lastUsed) > c.opts.IdleTimeout {
+			delete(c.pools, key)
+			go entry.pool.Close()
+		}
+	}
+}
+
+// closeAll closes every pool.
+func (c *poolCache) closeAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, entry := range c.pools {
+		delete(c.pools, key)
+		entry.pool.Close()
+	}
+}
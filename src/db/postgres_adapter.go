@@ -2,22 +2,52 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
-	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/mertsaygi/orchestrdb/src/audit"
 )
 
 // PostgresAdapter implements the Adapter interface for PostgreSQL.
-type PostgresAdapter struct{}
+// Connections are pooled per (host, port, user, db, sslmode).
+type PostgresAdapter struct {
+	pools   *poolCache
+	auditor *audit.Auditor
+}
+
+// NewPostgresAdapter creates a new PostgresAdapter. Every statement that
+// changes a server is reported to auditor, which may be nil.
+func NewPostgresAdapter(opts PoolOptions, auditor *audit.Auditor) *PostgresAdapter {
+	return &PostgresAdapter{
+		pools:   newPoolCache(opts),
+		auditor: auditor,
+	}
+}
+
+// Start evicts idle pools periodically and closes all pools when ctx is done.
+// It implements manager.Runnable so the adapter can be added to the manager.
+func (p *PostgresAdapter) Start(ctx context.Context) error {
+	ticker := time.NewTicker(p.pools.opts.IdleTimeout / 2)
+	defer ticker.Stop()
 
-// NewPostgresAdapter creates a new PostgresAdapter.
-func NewPostgresAdapter() *PostgresAdapter {
-	return &PostgresAdapter{}
+	for {
+		select {
+		case <-ctx.Done():
+			p.pools.closeAll()
+			return nil
+		case <-ticker.C:
+			p.pools.evictIdle()
+		}
+	}
 }
 
-func (p *PostgresAdapter) buildAdminConnString(host string, port int32, user, password, sslMode, dbName string) string {
+func (p *PostgresAdapter) buildAdminConnString(host string, port int32, sslMode, dbName string) string {
 	if sslMode == "" {
 		sslMode = "disable"
 	}
@@ -26,154 +56,553 @@ func (p *PostgresAdapter) buildAdminConnString(host string, port int32, user, pa
 	}
 
 	return fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		"host=%s port=%d dbname=%s sslmode=%s",
 		host,
 		port,
-		user,
-		password,
 		dbName,
 		sslMode,
 	)
 }
 
-// CreateDatabase is unchanged from before (idempotent).
-func (p *PostgresAdapter) CreateDatabase(ctx context.Context, params CreateDatabaseParams) error {
-	dsn := p.buildAdminConnString(params.Host, params.Port, params.AdminUser, params.Password, params.SSLMode, "postgres")
+// connect returns a pooled admin connection to dbName. Credentials are set
+// on the parsed config rather than in the DSN so they never need escaping,
+// and the TLS settings are replaced by the ones built from the connection
+// params. Callers must Release the connection.
+func (p *PostgresAdapter) connect(ctx context.Context, conn ConnectionParams, dbName string) (*pooledConn, error) {
+	return p.pools.acquire(ctx, conn, dbName, func() (*pgxpool.Config, error) {
+		cfg, err := pgxpool.ParseConfig(p.buildAdminConnString(conn.Host, conn.Port, conn.SSLMode, dbName))
+		if err != nil {
+			return nil, err
+		}
+		cfg.ConnConfig.User = conn.AdminUser
+		cfg.ConnConfig.Password = conn.Password
+
+		tlsCfg, err := buildTLSConfig(conn)
+		if err != nil {
+			return nil, err
+		}
+		if tlsCfg != nil {
+			cfg.ConnConfig.TLSConfig = tlsCfg
+			cfg.ConnConfig.Fallbacks = nil
+		}
+		return cfg, nil
+	})
+}
+
+// PasswordRules returns the rules of common PostgreSQL setups: the
+// passwordcheck module and managed services (RDS, Azure) require at least
+// 8 characters mixing letters and non-letters, and Azure caps at 128.
+// Quotes and backslashes are accepted by the server but excluded because
+// they are frequently mishandled by clients and .pgpass files.
+func (p *PostgresAdapter) PasswordRules() PasswordRules {
+	return PasswordRules{
+		MinLength:  8,
+		MaxLength:  128,
+		MinClasses: 2,
+		Forbidden:  "'\"\\",
+	}
+}
+
+// managedComment marks databases and roles created or adopted by the
+// operator. The resource managing them follows as " owner=<Owner>"; the
+// bare comment was written by versions without owners.
+const managedComment = "managed-by=orchestrdb"
+
+// managedMarker returns the comment marking an object managed by owner.
+func managedMarker(owner string) string {
+	return managedComment + " owner=" + owner
+}
+
+// marker is the managed marker found on a database or role.
+type marker struct {
+	// managed is set for objects carrying a managed marker.
+	managed bool
+
+	// owner is the resource managing the object; empty for markers
+	// written without owner.
+	owner string
+}
+
+// parseMarker reads the managed marker from the comment of an object.
+func parseMarker(comment *string) marker {
+	switch {
+	case comment == nil:
+		return marker{}
+	case *comment == managedComment:
+		return marker{managed: true}
+	case strings.HasPrefix(*comment, managedComment+" owner="):
+		return marker{managed: true, owner: strings.TrimPrefix(*comment, managedComment+" owner=")}
+	}
+	return marker{}
+}
+
+// claim decides whether owner may manage the object kind name carrying m.
+// It reports whether the object is marked for owner already. Objects of
+// another owner are a Conflict; those marked without owner were created by
+// the operator before owners were recorded and are marked for owner.
+// Unmarked ones are taken over with adopt only.
+func (m marker) claim(kind, name, owner string, adopt bool) (bool, error) {
+	switch {
+	case m.managed && m.owner == owner:
+		return true, nil
+	case m.managed && m.owner != "":
+		return false, newError(CategoryConflict, "%s %s is managed by %s", kind, name, m.owner)
+	case m.managed:
+		return false, nil
+	case !adopt:
+		return false, newError(CategoryConflict,
+			"%s %s already exists and is not managed by this resource; enable adoption to take it over", kind, name)
+	}
+	return false, nil
+}
+
+// CreateDatabase creates the database, marks it as managed, creates the
+// missing extensions and applies params.Hardening (idempotent). An existing
+// database without the marker is only taken over with params.Adopt. Errors
+// are classified, see CategoryOf. Each step releases its connection before
+// the next one connects.
+func (p *PostgresAdapter) CreateDatabase(ctx context.Context, params CreateDatabaseParams) (err error) {
+	defer func() { err = classify(err) }()
 
-	conn, err := pgx.Connect(ctx, dsn)
+	exists, err := p.createDatabase(ctx, params)
 	if err != nil {
-		return fmt.Errorf("postgres connect error: %w", err)
+		return err
 	}
-	defer conn.Close(ctx)
+	if err := p.ensureExtensions(ctx, params, exists); err != nil {
+		return err
+	}
+	return p.ensureHardening(ctx, params, exists)
+}
 
-	query := fmt.Sprintf(`CREATE DATABASE "%s"`, params.Name)
+// createDatabase creates the database and marks it as managed. It reports
+// whether the database existed before.
+func (p *PostgresAdapter) createDatabase(ctx context.Context, params CreateDatabaseParams) (bool, error) {
+	conn, err := p.connect(ctx, params.ConnectionParams, "postgres")
+	if err != nil {
+		return false, fmt.Errorf("postgres connect error: %w", err)
+	}
+	defer conn.Release()
 
-	_, err = conn.Exec(ctx, query)
+	exists, m, err := lookupManaged(ctx, conn,
+		`SELECT shobj_description(oid, 'pg_database') FROM pg_database WHERE datname = $1`, params.Name)
 	if err != nil {
-		if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "42P04" {
-			// duplicate_database -> treat as success
-			return nil
+		return false, fmt.Errorf("postgres lookup database error: %w", err)
+	}
+	if exists {
+		ours, err := m.claim("database", params.Name, params.Owner, params.Adopt)
+		if err != nil || ours {
+			return true, err
+		}
+	}
+
+	if !exists {
+		query := fmt.Sprintf(`CREATE DATABASE %s`, quoteIdent(params.Name))
+		if params.Template != "" {
+			if err := p.prepareTemplate(ctx, conn, params); err != nil {
+				return false, err
+			}
+			query += ` TEMPLATE ` + quoteIdent(params.Template)
+		}
+		if err := p.exec(ctx, conn, targetOf(params.ConnectionParams, "postgres"), query); err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "42P04" {
+				// duplicate_database: created concurrently, not by us
+				return false, newError(CategoryConflict, "database %s was created concurrently by someone else", params.Name)
+			}
+			if errors.As(err, &pgErr) && pgErr.Code == "55006" {
+				// object_in_use: someone connected to the template in between
+				return false, newError(CategoryTransient, "template database %s is in use: %w", params.Template, err)
+			}
+			return false, fmt.Errorf("postgres create database error: %w", err)
+		}
+	}
+
+	comment := fmt.Sprintf(`COMMENT ON DATABASE %s IS %s`, quoteIdent(params.Name), quoteLiteral(managedMarker(params.Owner)))
+	if err := p.exec(ctx, conn, targetOf(params.ConnectionParams, "postgres"), comment); err != nil {
+		return false, fmt.Errorf("postgres mark database managed error: %w", err)
+	}
+	return exists, nil
+}
+
+// prepareTemplate checks that the template of params is a managed database
+// and terminates the sessions connected to it; CREATE DATABASE ... TEMPLATE
+// fails while anyone else is connected.
+func (p *PostgresAdapter) prepareTemplate(ctx context.Context, conn *pooledConn, params CreateDatabaseParams) error {
+	exists, m, err := lookupManaged(ctx, conn,
+		`SELECT shobj_description(oid, 'pg_database') FROM pg_database WHERE datname = $1`, params.Template)
+	if err != nil {
+		return fmt.Errorf("postgres lookup template error: %w", err)
+	}
+	if !exists {
+		return newError(CategoryTransient, "template database %s does not exist", params.Template)
+	}
+	if !m.managed {
+		return newError(CategoryConflict,
+			"template database %s is not managed by orchestrdb; refusing to copy it", params.Template)
+	}
+
+	return p.terminateSessions(ctx, conn, params.ConnectionParams, params.Template)
+}
+
+// ensureExtensions creates the extensions of params missing in the database.
+// A dry run cannot connect to a database it has only planned to create, so
+// it plans every extension in that case.
+func (p *PostgresAdapter) ensureExtensions(ctx context.Context, params CreateDatabaseParams, exists bool) error {
+	if len(params.Extensions) == 0 {
+		return nil
+	}
+
+	missing := params.Extensions
+	var q execer
+	if exists || planFrom(ctx) == nil {
+		conn, err := p.connect(ctx, params.ConnectionParams, params.Name)
+		if err != nil {
+			return fmt.Errorf("postgres connect to db %s error: %w", params.Name, err)
 		}
-		return fmt.Errorf("postgres create database error: %w", err)
+		defer conn.Release()
+
+		if missing, err = missingExtensions(ctx, conn, params.Extensions); err != nil {
+			return err
+		}
+		q = conn
 	}
 
+	for _, ext := range missing {
+		stmt := fmt.Sprintf(`CREATE EXTENSION IF NOT EXISTS %s`, quoteIdent(ext))
+		if err := p.exec(ctx, q, targetOf(params.ConnectionParams, params.Name), stmt); err != nil {
+			return fmt.Errorf("postgres create extension %s error: %w", ext, err)
+		}
+	}
 	return nil
 }
 
+// missingExtensions returns the entries of names not installed in the
+// database conn is connected to.
+func missingExtensions(ctx context.Context, conn *pooledConn, names []string) ([]string, error) {
+	rows, err := conn.Query(ctx, `SELECT extname FROM pg_extension WHERE extname = ANY($1)`, names)
+	if err != nil {
+		return nil, fmt.Errorf("postgres lookup extensions error: %w", err)
+	}
+	installed, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("postgres lookup extensions error: %w", err)
+	}
+
+	var missing []string
+	for _, name := range names {
+		if !slices.Contains(installed, name) {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
+
+// release checks that owner may drop the object kind name carrying m: it
+// must be marked for owner, or without owner (objects marked before owners
+// were recorded).
+func (m marker) release(kind, name, owner string) error {
+	switch {
+	case !m.managed:
+		return newError(CategoryConflict, "%s %s is not managed by orchestrdb; refusing to drop it", kind, name)
+	case m.owner != "" && m.owner != owner:
+		return newError(CategoryConflict, "%s %s is managed by %s; refusing to drop it", kind, name, m.describeOwner())
+	}
+	return nil
+}
+
+// describeOwner names the owner of m in error messages.
+func (m marker) describeOwner() string {
+	if m.owner == "" {
+		return "an unknown resource"
+	}
+	return m.owner
+}
+
+// lookupManaged runs query, which selects the comment of a single catalog
+// object, and reports whether the object exists and its managed marker.
+func lookupManaged(ctx context.Context, conn *pooledConn, query, name string) (bool, marker, error) {
+	var comment *string
+	if err := conn.QueryRow(ctx, query, name).Scan(&comment); err != nil {
+		if isNoRows(err) {
+			return false, marker{}, nil
+		}
+		return false, marker{}, err
+	}
+	return true, parseMarker(comment), nil
+}
+
 // EnsureUser ensures that a role exists and has the given privileges.
-func (p *PostgresAdapter) EnsureUser(ctx context.Context, params EnsureUserParams) error {
-	// Connect to the instance (postgres db)
-	dsn := p.buildAdminConnString(params.Host, params.Port, params.AdminUser, params.Password, params.SSLMode, "postgres")
+//
+// Changes are applied in this order so that a failure leaves nothing half-applied:
+//
+//  1. The role is created NOLOGIN without a password if it does not exist.
+//     This is committed on its own so the per-database sessions can see it.
+//  2. Schema-level grants run in one transaction per target database. Each
+//     is committed and its connection released before the next database.
+//  3. Database-level grants and the password run in one transaction on the
+//     instance connection, which enables LOGIN with the new password last.
+//
+// The call never holds more than one connection, so the number of access
+// databases is not bounded by --max-conns-per-server.
+//
+// A role managed by another owner is a Conflict, and so is an existing role
+// without the marker unless params.Adopt is set; adopting marks it for
+// params.Owner in the instance transaction.
+//
+// If anything fails, the open transaction is rolled back and a role created
+// in step 1 is dropped again. Commits cannot be made atomic across
+// databases; a failure after some of them leaves grants on a NOLOGIN role
+// that the next (idempotent) reconcile completes.
+func (p *PostgresAdapter) EnsureUser(ctx context.Context, params EnsureUserParams) (result EnsureUserResult, err error) {
+	// Registered first so it runs last and also classifies compensation paths.
+	defer func() { err = classify(err) }()
 
-	conn, err := pgx.Connect(ctx, dsn)
+	instance := targetOf(params.ConnectionParams, "postgres")
+
+	// 1) Ensure the role exists
+	conn, err := p.connect(ctx, params.ConnectionParams, "postgres")
+	if err != nil {
+		return EnsureUserResult{}, fmt.Errorf("postgres connect error: %w", err)
+	}
+	created, m, err := p.ensureRole(ctx, conn, instance, params.Username)
+	conn.Release()
 	if err != nil {
-		return fmt.Errorf("postgres connect error: %w", err)
+		return EnsureUserResult{}, fmt.Errorf("postgres ensure role error: %w", err)
+	}
+	var ours bool
+	if !created {
+		if ours, err = m.claim("role", params.Username, params.Owner, params.Adopt); err != nil {
+			return EnsureUserResult{}, err
+		}
 	}
-	defer conn.Close(ctx)
+	adopting := !created && !m.managed
 
-	// 1) Ensure role exists with given password
-	// Use DO block for idempotent create/alter.
-	roleSQL := fmt.Sprintf(`
-DO $$
-BEGIN
-   IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = %q) THEN
-      CREATE ROLE "%s" LOGIN PASSWORD %q;
-   ELSE
-      ALTER ROLE "%s" WITH LOGIN PASSWORD %q;
-   END IF;
-END
-$$;
-`, params.Username, params.Username, params.GeneratedPassword, params.Username, params.GeneratedPassword)
+	var touched []string
+	defer func() {
+		if err != nil && created && planFrom(ctx) == nil {
+			// Compensate: a role we just created must not outlive a failed reconcile.
+			p.dropCreatedRole(context.WithoutCancel(ctx), params, touched)
+		}
+	}()
 
-	if _, err := conn.Exec(ctx, roleSQL); err != nil {
-		return fmt.Errorf("postgres ensure role error: %w", err)
+	var instanceStmts []string
+	var dbNames []string
+	dbStmts := map[string][]string{}
+	for _, a := range params.Access {
+		inst, database, err := accessStatements(params.Username, a)
+		if err != nil {
+			return EnsureUserResult{}, err
+		}
+		instanceStmts = append(instanceStmts, inst...)
+		if len(database) == 0 {
+			continue
+		}
+		if _, ok := dbStmts[a.DBName]; !ok {
+			dbNames = append(dbNames, a.DBName)
+		}
+		dbStmts[a.DBName] = append(dbStmts[a.DBName], database...)
 	}
 
-	// 2) Apply access rules
-	for _, a := range params.Access {
-		role := strings.ToLower(a.Role)
-		if role == "" {
-			role = "readonly"
+	// 2) Schema-level grants, one database at a time
+	for _, dbName := range dbNames {
+		touched = append(touched, dbName)
+		if err := p.grantInDatabase(ctx, params.ConnectionParams, dbName, dbStmts[dbName]); err != nil {
+			return EnsureUserResult{}, err
 		}
-		scope := strings.ToLower(a.Scope)
-		if scope == "" {
-			scope = "database"
+	}
+
+	// 3) Database-level grants, marker and password
+	conn, err = p.connect(ctx, params.ConnectionParams, "postgres")
+	if err != nil {
+		return EnsureUserResult{}, fmt.Errorf("postgres connect error: %w", err)
+	}
+	defer conn.Release()
+
+	instanceTx, err := conn.Begin(ctx)
+	if err != nil {
+		return EnsureUserResult{}, fmt.Errorf("postgres begin error: %w", err)
+	}
+	defer func() { _ = instanceTx.Rollback(ctx) }()
+
+	for _, stmt := range instanceStmts {
+		if err := p.exec(ctx, instanceTx, instance, stmt); err != nil {
+			return EnsureUserResult{}, fmt.Errorf("postgres grant error: %w", err)
 		}
+	}
 
-		switch scope {
-		case "database":
-			if a.DBName == "" {
-				// skip invalid rule
-				continue
-			}
+	if !ours {
+		commentSQL := fmt.Sprintf(`COMMENT ON ROLE %s IS %s`,
+			quoteIdent(params.Username), quoteLiteral(managedMarker(params.Owner)))
+		if err := p.exec(ctx, instanceTx, instance, commentSQL); err != nil {
+			return EnsureUserResult{}, fmt.Errorf("postgres mark role managed error: %w", err)
+		}
+	}
 
-			// Database-level grants require connecting to that database.
-			dbDsn := p.buildAdminConnString(params.Host, params.Port, params.AdminUser, params.Password, params.SSLMode, a.DBName)
-			dbConn, err := pgx.Connect(ctx, dbDsn)
-			if err != nil {
-				return fmt.Errorf("postgres connect to db %s error: %w", a.DBName, err)
-			}
+	// Password and LOGIN go last so the role only becomes usable once
+	// everything else succeeded. Only the hashed verifier is sent, so the
+	// plaintext never shows up in server logs. An adopted role keeps its password.
+	passwordSQL := fmt.Sprintf(`ALTER ROLE %s WITH LOGIN`, quoteIdent(params.Username))
+	redactedSQL := passwordSQL
+	if !adopting || !params.KeepPassword {
+		verifier, err := passwordVerifier(params.PasswordEncryption, params.Username, params.GeneratedPassword)
+		if err != nil {
+			return EnsureUserResult{}, err
+		}
+		passwordSQL = fmt.Sprintf(`ALTER ROLE %s WITH LOGIN PASSWORD %s`,
+			quoteIdent(params.Username), quoteLiteral(verifier))
+		redactedSQL = fmt.Sprintf(`ALTER ROLE %s WITH LOGIN PASSWORD %s`,
+			quoteIdent(params.Username), redactedPassword)
 
-			// Basic privileges
-			switch role {
-			case "owner":
-				// Grant all privileges on database
-				// Note: ALTER DATABASE OWNER TO is more correct for true ownership;
-				// here we grant typical privileges.
-				_, err = conn.Exec(ctx, fmt.Sprintf(`GRANT ALL PRIVILEGES ON DATABASE "%s" TO "%s"`, a.DBName, params.Username))
-				if err != nil {
-					dbConn.Close(ctx)
-					return fmt.Errorf("grant all on database %s error: %w", a.DBName, err)
-				}
-				fallthrough
-			case "readwrite":
-				// Connect + usage/select/modify on all tables in public schema
-				_, err = conn.Exec(ctx, fmt.Sprintf(`GRANT CONNECT ON DATABASE "%s" TO "%s"`, a.DBName, params.Username))
-				if err != nil {
-					dbConn.Close(ctx)
-					return fmt.Errorf("grant connect on %s error: %w", a.DBName, err)
-				}
-				_, err = dbConn.Exec(ctx, fmt.Sprintf(`GRANT USAGE, SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO "%s"`, params.Username))
-				if err != nil {
-					dbConn.Close(ctx)
-					return fmt.Errorf("grant readwrite on %s.public error: %w", a.DBName, err)
-				}
-			case "readonly":
-				_, err = conn.Exec(ctx, fmt.Sprintf(`GRANT CONNECT ON DATABASE "%s" TO "%s"`, a.DBName, params.Username))
-				if err != nil {
-					dbConn.Close(ctx)
-					return fmt.Errorf("grant connect on %s error: %w", a.DBName, err)
-				}
-				_, err = dbConn.Exec(ctx, fmt.Sprintf(`GRANT USAGE, SELECT ON ALL TABLES IN SCHEMA public TO "%s"`, params.Username))
-				if err != nil {
-					dbConn.Close(ctx)
-					return fmt.Errorf("grant readonly on %s.public error: %w", a.DBName, err)
-				}
-			default:
-				dbConn.Close(ctx)
-				return fmt.Errorf("unsupported role: %s", a.Role)
-			}
+		result.PasswordEncryption = params.PasswordEncryption
+		if result.PasswordEncryption == "" {
+			result.PasswordEncryption = PasswordEncryptionSCRAM
+		}
+	}
+	if err := p.execRedacted(ctx, instanceTx, instance, passwordSQL, redactedSQL); err != nil {
+		return EnsureUserResult{}, fmt.Errorf("postgres set password error: %w", err)
+	}
 
-			dbConn.Close(ctx)
+	if err := p.commit(ctx, instanceTx, instance); err != nil {
+		return EnsureUserResult{}, fmt.Errorf("postgres commit error: %w", err)
+	}
 
-		case "instance":
-			// Instance-level access (simple example):
-			// allow CONNECT on all existing databases by granting on each dbName if provided,
-			// or just skip if dbName is empty.
-			if a.DBName == "" {
-				// nothing concrete to grant at instance level without listing DBs
-				continue
-			}
-			_, err = conn.Exec(ctx, fmt.Sprintf(`GRANT CONNECT ON DATABASE "%s" TO "%s"`, a.DBName, params.Username))
-			if err != nil {
-				return fmt.Errorf("grant instance-scope connect on %s error: %w", a.DBName, err)
-			}
+	return result, nil
+}
 
+// grantInDatabase runs stmts in one transaction in dbName and commits it.
+func (p *PostgresAdapter) grantInDatabase(ctx context.Context, params ConnectionParams, dbName string, stmts []string) error {
+	dbConn, err := p.connect(ctx, params, dbName)
+	if err != nil {
+		return fmt.Errorf("postgres connect to db %s error: %w", dbName, err)
+	}
+	defer dbConn.Release()
+
+	tx, err := dbConn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("postgres begin on db %s error: %w", dbName, err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	t := targetOf(params, dbName)
+	for _, stmt := range stmts {
+		if err := p.exec(ctx, tx, t, stmt); err != nil {
+			return fmt.Errorf("grant on %s.public error: %w", dbName, err)
+		}
+	}
+	if err := p.commit(ctx, tx, t); err != nil {
+		return fmt.Errorf("postgres commit on db %s error: %w", dbName, err)
+	}
+	return nil
+}
+
+// ensureRole creates the role NOLOGIN if it does not exist. It reports
+// whether the role was created by this call and the managed marker of an
+// existing role.
+func (p *PostgresAdapter) ensureRole(ctx context.Context, conn *pooledConn, t target, username string) (bool, marker, error) {
+	exists, m, err := lookupManaged(ctx, conn,
+		`SELECT shobj_description(oid, 'pg_authid') FROM pg_roles WHERE rolname = $1`, username)
+	if err != nil || exists {
+		return false, m, err
+	}
+
+	if err := p.exec(ctx, conn, t, fmt.Sprintf(`CREATE ROLE %s NOLOGIN`, quoteIdent(username))); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "42710" {
+			// duplicate_object: created concurrently, not by us
+			return false, marker{}, nil
+		}
+		return false, marker{}, err
+	}
+	return true, marker{}, nil
+}
+
+// dropCreatedRole removes a role created during a failed EnsureUser call.
+// Privileges granted in committed transactions are removed with DROP OWNED
+// in every database that was touched. Errors are ignored: this is best effort.
+func (p *PostgresAdapter) dropCreatedRole(ctx context.Context, params EnsureUserParams, touched []string) {
+	role := quoteIdent(params.Username)
+
+	for _, dbName := range touched {
+		dbConn, err := p.connect(ctx, params.ConnectionParams, dbName)
+		if err != nil {
+			continue
+		}
+		_ = p.exec(ctx, dbConn, targetOf(params.ConnectionParams, dbName), `DROP OWNED BY `+role)
+		dbConn.Release()
+	}
+
+	conn, err := p.connect(ctx, params.ConnectionParams, "postgres")
+	if err != nil {
+		return
+	}
+	defer conn.Release()
+
+	instance := targetOf(params.ConnectionParams, "postgres")
+	_ = p.exec(ctx, conn, instance, `DROP OWNED BY `+role)
+	_ = p.exec(ctx, conn, instance, `DROP ROLE IF EXISTS `+role)
+}
+
+// accessStatements returns the statements for one access rule: those run on
+// the instance connection and those run inside the target database.
+func accessStatements(username string, a UserAccess) (instance []string, database []string, err error) {
+	role := strings.ToLower(a.Role)
+	if role == "" {
+		role = "readonly"
+	}
+	scope := strings.ToLower(a.Scope)
+	if scope == "" {
+		scope = "database"
+	}
+
+	user := quoteIdent(username)
+	dbName := quoteIdent(a.DBName)
+
+	switch scope {
+	case "database":
+		if a.DBName == "" {
+			// skip invalid rule
+			return nil, nil, nil
+		}
+
+		// Basic privileges
+		switch role {
+		case "owner":
+			// Note: ALTER DATABASE OWNER TO is more correct for true ownership;
+			// here we grant typical privileges.
+			instance = append(instance, fmt.Sprintf(`GRANT ALL PRIVILEGES ON DATABASE %s TO %s`, dbName, user))
+			fallthrough
+		case "readwrite":
+			// Connect + usage/select/modify on all tables in public schema
+			instance = append(instance, fmt.Sprintf(`GRANT CONNECT ON DATABASE %s TO %s`, dbName, user))
+			database = append(database,
+				fmt.Sprintf(`GRANT USAGE ON SCHEMA public TO %s`, user),
+				fmt.Sprintf(`GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO %s`, user),
+				fmt.Sprintf(`ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO %s`, user),
+			)
+		case "readonly":
+			instance = append(instance, fmt.Sprintf(`GRANT CONNECT ON DATABASE %s TO %s`, dbName, user))
+			database = append(database,
+				fmt.Sprintf(`GRANT USAGE ON SCHEMA public TO %s`, user),
+				fmt.Sprintf(`GRANT SELECT ON ALL TABLES IN SCHEMA public TO %s`, user),
+				fmt.Sprintf(`ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT ON TABLES TO %s`, user),
+			)
 		default:
-			// unknown scope: ignore or fail. Here we fail.
-			return fmt.Errorf("unsupported scope: %s", a.Scope)
+			return nil, nil, newError(CategoryInvalidSpec, "unsupported role: %s", a.Role)
 		}
+
+	case "instance":
+		// Instance-level access (simple example):
+		// allow CONNECT on the given database, or skip if dbName is empty
+		// (nothing concrete to grant at instance level without listing DBs).
+		if a.DBName == "" {
+			return nil, nil, nil
+		}
+		instance = append(instance, fmt.Sprintf(`GRANT CONNECT ON DATABASE %s TO %s`, dbName, user))
+
+	default:
+		// unknown scope: fail.
+		return nil, nil, newError(CategoryInvalidSpec, "unsupported scope: %s", a.Scope)
 	}
 
-	return nil
+	return instance, database, nil
 }
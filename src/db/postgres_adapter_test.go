@@ -0,0 +1,140 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMarkerClaim(t *testing.T) {
+	const owner = "User/app/alice"
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name     string
+		comment  *string
+		adopt    bool
+		wantOurs bool
+		wantErr  bool
+	}{
+		{name: "ours", comment: str(managedMarker(owner)), wantOurs: true},
+		{name: "legacy marker", comment: str(managedComment)},
+		{name: "other owner", comment: str(managedMarker("User/app/bob")), wantErr: true},
+		{name: "other owner with adoption", comment: str(managedMarker("User/app/bob")), adopt: true, wantErr: true},
+		{name: "unmarked", comment: nil, wantErr: true},
+		{name: "foreign comment", comment: str("payroll role"), wantErr: true},
+		{name: "unmarked with adoption", comment: nil, adopt: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ours, err := parseMarker(tt.comment).claim("role", "alice", owner, tt.adopt)
+			if tt.wantErr {
+				if CategoryOf(err) != CategoryConflict {
+					t.Fatalf("claim() error = %v, want a Conflict", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ours != tt.wantOurs {
+				t.Errorf("claim() = %v, want %v", ours, tt.wantOurs)
+			}
+		})
+	}
+}
+
+func TestMarkerRelease(t *testing.T) {
+	const owner = "Database/app/orders"
+	str := func(s string) *string { return &s }
+
+	tests := []struct {
+		name    string
+		comment *string
+		wantErr bool
+	}{
+		{name: "ours", comment: str(managedMarker(owner))},
+		{name: "legacy marker", comment: str(managedComment)},
+		{name: "other owner", comment: str(managedMarker("Database/app/billing")), wantErr: true},
+		{name: "unmarked", comment: nil, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := parseMarker(tt.comment).release("database", "orders", owner)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("release() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAccessStatements(t *testing.T) {
+	tests := []struct {
+		name     string
+		access   UserAccess
+		instance []string
+		database []string
+		wantErr  bool
+	}{
+		{
+			name:     "readonly",
+			access:   UserAccess{DBName: "app-db", Role: "readonly"},
+			instance: []string{`GRANT CONNECT ON DATABASE "app-db" TO "alice"`},
+			database: []string{
+				`GRANT USAGE ON SCHEMA public TO "alice"`,
+				`GRANT SELECT ON ALL TABLES IN SCHEMA public TO "alice"`,
+				`ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT ON TABLES TO "alice"`,
+			},
+		},
+		{
+			name:     "readwrite",
+			access:   UserAccess{DBName: "app-db", Role: "readwrite"},
+			instance: []string{`GRANT CONNECT ON DATABASE "app-db" TO "alice"`},
+			database: []string{
+				`GRANT USAGE ON SCHEMA public TO "alice"`,
+				`GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO "alice"`,
+				`ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO "alice"`,
+			},
+		},
+		{
+			name:   "owner",
+			access: UserAccess{DBName: "app-db", Role: "owner"},
+			instance: []string{
+				`GRANT ALL PRIVILEGES ON DATABASE "app-db" TO "alice"`,
+				`GRANT CONNECT ON DATABASE "app-db" TO "alice"`,
+			},
+			database: []string{
+				`GRANT USAGE ON SCHEMA public TO "alice"`,
+				`GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO "alice"`,
+				`ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO "alice"`,
+			},
+		},
+		{
+			name:     "instance scope",
+			access:   UserAccess{DBName: "app-db", Scope: "instance"},
+			instance: []string{`GRANT CONNECT ON DATABASE "app-db" TO "alice"`},
+		},
+		{name: "no database", access: UserAccess{Role: "readonly"}},
+		{name: "unknown role", access: UserAccess{DBName: "app-db", Role: "admin"}, wantErr: true},
+		{name: "unknown scope", access: UserAccess{DBName: "app-db", Scope: "cluster"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance, database, err := accessStatements("alice", tt.access)
+			if tt.wantErr {
+				if CategoryOf(err) != CategoryInvalidSpec {
+					t.Fatalf("accessStatements() error = %v, want an InvalidSpec error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(instance, tt.instance) {
+				t.Errorf("instance statements = %q, want %q", instance, tt.instance)
+			}
+			if !reflect.DeepEqual(database, tt.database) {
+				t.Errorf("database statements = %q, want %q", database, tt.database)
+			}
+		})
+	}
+}
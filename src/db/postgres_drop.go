@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// DropDatabase terminates the sessions connected to the database and drops
+// it. Only databases marked for params.Owner are dropped (see release).
+func (p *PostgresAdapter) DropDatabase(ctx context.Context, params CreateDatabaseParams) (err error) {
+	defer func() { err = classify(err) }()
+
+	conn, err := p.connect(ctx, params.ConnectionParams, "postgres")
+	if err != nil {
+		return fmt.Errorf("postgres connect error: %w", err)
+	}
+	defer conn.Release()
+
+	exists, m, err := lookupManaged(ctx, conn,
+		`SELECT shobj_description(oid, 'pg_database') FROM pg_database WHERE datname = $1`, params.Name)
+	if err != nil {
+		return fmt.Errorf("postgres lookup database error: %w", err)
+	}
+	if !exists {
+		return nil
+	}
+	if err := m.release("database", params.Name, params.Owner); err != nil {
+		return err
+	}
+
+	if err := p.terminateSessions(ctx, conn, params.ConnectionParams, params.Name); err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`DROP DATABASE IF EXISTS %s`, quoteIdent(params.Name))
+	if err := p.exec(ctx, conn, targetOf(params.ConnectionParams, "postgres"), query); err != nil {
+		return fmt.Errorf("postgres drop database error: %w", err)
+	}
+	return nil
+}
+
+// DropUser drops a role marked for params.Owner. Objects it owns are
+// reassigned to the admin user and its remaining privileges revoked in every
+// database of params.Access that still exists, then on the instance; DROP
+// ROLE fails while any database still references the role.
+func (p *PostgresAdapter) DropUser(ctx context.Context, params EnsureUserParams) (err error) {
+	defer func() { err = classify(err) }()
+
+	conn, err := p.connect(ctx, params.ConnectionParams, "postgres")
+	if err != nil {
+		return fmt.Errorf("postgres connect error: %w", err)
+	}
+	defer conn.Release()
+
+	exists, m, err := lookupManaged(ctx, conn,
+		`SELECT shobj_description(oid, 'pg_authid') FROM pg_roles WHERE rolname = $1`, params.Username)
+	if err != nil {
+		return fmt.Errorf("postgres lookup role error: %w", err)
+	}
+	if !exists {
+		return nil
+	}
+	if err := m.release("role", params.Username, params.Owner); err != nil {
+		return err
+	}
+
+	role := quoteIdent(params.Username)
+	handOver := []string{
+		`REASSIGN OWNED BY ` + role + ` TO CURRENT_USER`,
+		`DROP OWNED BY ` + role,
+	}
+
+	seen := map[string]bool{"postgres": true}
+	for _, a := range params.Access {
+		if a.DBName == "" || seen[a.DBName] {
+			continue
+		}
+		seen[a.DBName] = true
+
+		var dbExists bool
+		if err := conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)`, a.DBName).Scan(&dbExists); err != nil {
+			return fmt.Errorf("postgres lookup database error: %w", err)
+		}
+		if !dbExists {
+			continue
+		}
+
+		dbConn, err := p.connect(ctx, params.ConnectionParams, a.DBName)
+		if err != nil {
+			return fmt.Errorf("postgres connect to db %s error: %w", a.DBName, err)
+		}
+		for _, stmt := range handOver {
+			if err := p.exec(ctx, dbConn, targetOf(params.ConnectionParams, a.DBName), stmt); err != nil {
+				dbConn.Release()
+				return fmt.Errorf("postgres release objects in %s error: %w", a.DBName, err)
+			}
+		}
+		dbConn.Release()
+	}
+
+	instance := targetOf(params.ConnectionParams, "postgres")
+	for _, stmt := range handOver {
+		if err := p.exec(ctx, conn, instance, stmt); err != nil {
+			return fmt.Errorf("postgres release objects error: %w", err)
+		}
+	}
+	if err := p.exec(ctx, conn, instance, `DROP ROLE IF EXISTS `+role); err != nil {
+		return fmt.Errorf("postgres drop role error: %w", err)
+	}
+	return nil
+}
+
+// terminateSessions ends every session connected to dbName except conn's,
+// including pooled ones of the operator. Databases with sessions can be
+// neither dropped nor used as a template.
+func (p *PostgresAdapter) terminateSessions(ctx context.Context, conn *pooledConn, params ConnectionParams, dbName string) error {
+	p.pools.closeDatabase(params.Host, params.Port, dbName)
+
+	terminate := fmt.Sprintf(
+		`SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = %s AND pid <> pg_backend_pid()`,
+		quoteLiteral(dbName))
+	if err := p.exec(ctx, conn, targetOf(params, "postgres"), terminate); err != nil {
+		return fmt.Errorf("postgres terminate sessions error: %w", err)
+	}
+	return nil
+}
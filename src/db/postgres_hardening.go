@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// hardeningFix is a deviation from the hardening profile and the statement
+// removing it.
+type hardeningFix struct {
+	violation string
+	stmt      string
+}
+
+// publicACL is the owner of a database or schema and the privileges PUBLIC
+// holds on it, with NULL ACLs expanded to the built-in defaults.
+type publicACL struct {
+	owner      string
+	privileges []string
+}
+
+// observeDatabaseACL reads the owner of the database name and the
+// privileges of PUBLIC on it; conn is connected to "postgres".
+func observeDatabaseACL(ctx context.Context, conn *pooledConn, name string) (publicACL, error) {
+	var acl publicACL
+	err := conn.QueryRow(ctx, `
+SELECT pg_get_userbyid(d.datdba)::text,
+       ARRAY(SELECT a.privilege_type FROM aclexplode(coalesce(d.datacl, acldefault('d', d.datdba))) a
+              WHERE a.grantee = 0)
+  FROM pg_database d
+ WHERE d.datname = $1`, name).Scan(&acl.owner, &acl.privileges)
+	if err != nil {
+		return publicACL{}, fmt.Errorf("postgres observe database privileges error: %w", err)
+	}
+	return acl, nil
+}
+
+// observeSchemaACL reads the owner of schema public in the database dbConn
+// is connected to and the privileges of PUBLIC on it. It returns nil if the
+// schema was dropped.
+func observeSchemaACL(ctx context.Context, dbConn *pooledConn) (*publicACL, error) {
+	acl := &publicACL{}
+	err := dbConn.QueryRow(ctx, `
+SELECT pg_get_userbyid(n.nspowner)::text,
+       ARRAY(SELECT a.privilege_type FROM aclexplode(coalesce(n.nspacl, acldefault('n', n.nspowner))) a
+              WHERE a.grantee = 0)
+  FROM pg_namespace n
+ WHERE n.nspname = 'public'`).Scan(&acl.owner, &acl.privileges)
+	if isNoRows(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("postgres observe schema privileges error: %w", err)
+	}
+	return acl, nil
+}
+
+// databaseHardeningFixes compares the database params.Name with
+// params.Hardening; revokes come before the ownership change.
+func databaseHardeningFixes(params CreateDatabaseParams, acl publicACL) []hardeningFix {
+	var fixes []hardeningFix
+	owner := params.Hardening.Owner
+	dbName := quoteIdent(params.Name)
+	for _, priv := range []string{"CONNECT", "TEMPORARY"} {
+		if slices.Contains(acl.privileges, priv) {
+			fixes = append(fixes, hardeningFix{
+				violation: fmt.Sprintf("PUBLIC has %s on database %s", priv, params.Name),
+				stmt:      fmt.Sprintf(`REVOKE %s ON DATABASE %s FROM PUBLIC`, priv, dbName),
+			})
+		}
+	}
+	if acl.owner != owner {
+		fixes = append(fixes, hardeningFix{
+			violation: fmt.Sprintf("database %s is owned by %s instead of %s", params.Name, acl.owner, owner),
+			stmt:      fmt.Sprintf(`ALTER DATABASE %s OWNER TO %s`, dbName, quoteIdent(owner)),
+		})
+	}
+	return fixes
+}
+
+// schemaHardeningFixes compares schema public of the database params.Name
+// with params.Hardening. A dropped schema (nil acl) needs no fixes.
+func schemaHardeningFixes(params CreateDatabaseParams, acl *publicACL) []hardeningFix {
+	if acl == nil {
+		return nil
+	}
+	var fixes []hardeningFix
+	owner := params.Hardening.Owner
+	if slices.Contains(acl.privileges, "CREATE") {
+		fixes = append(fixes, hardeningFix{
+			violation: fmt.Sprintf("PUBLIC has CREATE on schema %s.public", params.Name),
+			stmt:      `REVOKE CREATE ON SCHEMA public FROM PUBLIC`,
+		})
+	}
+	if acl.owner != owner {
+		fixes = append(fixes, hardeningFix{
+			violation: fmt.Sprintf("schema %s.public is owned by %s instead of %s", params.Name, acl.owner, owner),
+			stmt:      fmt.Sprintf(`ALTER SCHEMA public OWNER TO %s`, quoteIdent(owner)),
+		})
+	}
+	return fixes
+}
+
+// ensureHardening applies params.Hardening to the database, first on the
+// "postgres" connection and then, after releasing it, inside the database.
+// The owner role must exist and the admin user must be able to hand the
+// database over to it. A dry run cannot connect to a database it has only
+// planned to create, which is assumed to have the PostgreSQL defaults.
+func (p *PostgresAdapter) ensureHardening(ctx context.Context, params CreateDatabaseParams, exists bool) error {
+	if params.Hardening == nil {
+		return nil
+	}
+	known := exists || planFrom(ctx) == nil
+
+	if err := p.hardenDatabase(ctx, params, known); err != nil {
+		return err
+	}
+
+	schema := &publicACL{privileges: []string{"CREATE"}}
+	var q execer
+	if known {
+		dbConn, err := p.connect(ctx, params.ConnectionParams, params.Name)
+		if err != nil {
+			return fmt.Errorf("postgres connect to db %s error: %w", params.Name, err)
+		}
+		defer dbConn.Release()
+
+		if schema, err = observeSchemaACL(ctx, dbConn); err != nil {
+			return err
+		}
+		q = dbConn
+	}
+	for _, fix := range schemaHardeningFixes(params, schema) {
+		if err := p.exec(ctx, q, targetOf(params.ConnectionParams, params.Name), fix.stmt); err != nil {
+			return fmt.Errorf("postgres harden schema public error: %w", err)
+		}
+	}
+	return nil
+}
+
+// hardenDatabase checks the owner role and applies the database-level part
+// of params.Hardening.
+func (p *PostgresAdapter) hardenDatabase(ctx context.Context, params CreateDatabaseParams, known bool) error {
+	conn, err := p.connect(ctx, params.ConnectionParams, "postgres")
+	if err != nil {
+		return fmt.Errorf("postgres connect error: %w", err)
+	}
+	defer conn.Release()
+
+	owner := params.Hardening.Owner
+	var ownerExists bool
+	if err := conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)`, owner).Scan(&ownerExists); err != nil {
+		return fmt.Errorf("postgres lookup role error: %w", err)
+	}
+	if !ownerExists {
+		// Its User may still be reconciling: retried as Transient.
+		return fmt.Errorf("owner role %s does not exist", owner)
+	}
+
+	database := publicACL{owner: params.AdminUser, privileges: []string{"CONNECT", "TEMPORARY"}}
+	if known {
+		if database, err = observeDatabaseACL(ctx, conn, params.Name); err != nil {
+			return err
+		}
+	}
+	for _, fix := range databaseHardeningFixes(params, database) {
+		if err := p.exec(ctx, conn, targetOf(params.ConnectionParams, "postgres"), fix.stmt); err != nil {
+			return fmt.Errorf("postgres harden database error: %w", err)
+		}
+	}
+	return nil
+}
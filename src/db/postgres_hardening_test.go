@@ -0,0 +1,111 @@
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+// fixStatements returns the statements of fixes.
+func fixStatements(fixes []hardeningFix) []string {
+	var stmts []string
+	for _, fix := range fixes {
+		stmts = append(stmts, fix.stmt)
+	}
+	return stmts
+}
+
+func TestDatabaseHardeningFixes(t *testing.T) {
+	params := CreateDatabaseParams{Name: "app-db", Hardening: &Hardening{Owner: "app_owner"}}
+
+	tests := []struct {
+		name string
+		acl  publicACL
+		want []string
+	}{
+		{
+			name: "defaults",
+			acl:  publicACL{owner: "postgres", privileges: []string{"CONNECT", "TEMPORARY"}},
+			want: []string{
+				`REVOKE CONNECT ON DATABASE "app-db" FROM PUBLIC`,
+				`REVOKE TEMPORARY ON DATABASE "app-db" FROM PUBLIC`,
+				`ALTER DATABASE "app-db" OWNER TO "app_owner"`,
+			},
+		},
+		{
+			name: "only temporary left",
+			acl:  publicACL{owner: "app_owner", privileges: []string{"TEMPORARY"}},
+			want: []string{`REVOKE TEMPORARY ON DATABASE "app-db" FROM PUBLIC`},
+		},
+		{
+			name: "other owner",
+			acl:  publicACL{owner: "someone"},
+			want: []string{`ALTER DATABASE "app-db" OWNER TO "app_owner"`},
+		},
+		{
+			name: "hardened",
+			acl:  publicACL{owner: "app_owner"},
+		},
+		{
+			name: "create is not a database privilege of the profile",
+			acl:  publicACL{owner: "app_owner", privileges: []string{"CREATE"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixes := databaseHardeningFixes(params, tt.acl)
+			if got := fixStatements(fixes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("statements = %q, want %q", got, tt.want)
+			}
+			for _, fix := range fixes {
+				if fix.violation == "" {
+					t.Errorf("fix %q has no violation", fix.stmt)
+				}
+			}
+		})
+	}
+}
+
+func TestSchemaHardeningFixes(t *testing.T) {
+	params := CreateDatabaseParams{Name: "app", Hardening: &Hardening{Owner: "app_owner"}}
+
+	tests := []struct {
+		name string
+		acl  *publicACL
+		want []string
+	}{
+		{
+			name: "defaults",
+			acl:  &publicACL{owner: "pg_database_owner", privileges: []string{"USAGE", "CREATE"}},
+			want: []string{
+				`REVOKE CREATE ON SCHEMA public FROM PUBLIC`,
+				`ALTER SCHEMA public OWNER TO "app_owner"`,
+			},
+		},
+		{
+			name: "usage is kept",
+			acl:  &publicACL{owner: "app_owner", privileges: []string{"USAGE"}},
+		},
+		{
+			name: "other owner",
+			acl:  &publicACL{owner: "postgres", privileges: []string{"USAGE"}},
+			want: []string{`ALTER SCHEMA public OWNER TO "app_owner"`},
+		},
+		{
+			name: "dropped schema",
+			acl:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fixes := schemaHardeningFixes(params, tt.acl)
+			if got := fixStatements(fixes); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("statements = %q, want %q", got, tt.want)
+			}
+			for _, fix := range fixes {
+				if fix.violation == "" {
+					t.Errorf("fix %q has no violation", fix.stmt)
+				}
+			}
+		})
+	}
+}
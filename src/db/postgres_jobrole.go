@@ -0,0 +1,230 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// jobRoleComment marks the short-lived roles of Jobs. The database the role
+// has privileges in follows it.
+const jobRoleComment = "managed-by=orchestrdb job database="
+
+// EnsureJobRole creates (or renews) the role a Job connects as instead of
+// the admin user. It can log in once at a time until params.ValidUntil and
+// only reaches the database params.DBName: a reading role gets USAGE on
+// its schemas and SELECT on their tables and sequences, a writing role
+// CREATE on the database and its schemas. Expired job roles left behind on
+// the server are dropped first.
+func (p *PostgresAdapter) EnsureJobRole(ctx context.Context, params JobRoleParams) (err error) {
+	defer func() { err = classify(err) }()
+
+	p.dropExpiredJobRoles(ctx, params.ConnectionParams)
+
+	if err := p.createJobRole(ctx, params); err != nil {
+		return err
+	}
+
+	dbConn, err := p.connect(ctx, params.ConnectionParams, params.DBName)
+	if err != nil {
+		return fmt.Errorf("postgres connect to db %s error: %w", params.DBName, err)
+	}
+	defer dbConn.Release()
+
+	rows, err := dbConn.Query(ctx,
+		`SELECT nspname FROM pg_namespace WHERE nspname NOT LIKE 'pg\_%' AND nspname <> 'information_schema'`)
+	if err != nil {
+		return fmt.Errorf("postgres list schemas error: %w", err)
+	}
+	schemas, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("postgres list schemas error: %w", err)
+	}
+
+	tx, err := dbConn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("postgres begin error: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	role := quoteIdent(params.Role)
+	t := targetOf(params.ConnectionParams, params.DBName)
+	for _, schema := range schemas {
+		stmts := []string{
+			fmt.Sprintf(`GRANT USAGE ON SCHEMA %s TO %s`, quoteIdent(schema), role),
+			fmt.Sprintf(`GRANT SELECT ON ALL TABLES IN SCHEMA %s TO %s`, quoteIdent(schema), role),
+			fmt.Sprintf(`GRANT SELECT ON ALL SEQUENCES IN SCHEMA %s TO %s`, quoteIdent(schema), role),
+		}
+		if params.Write {
+			stmts = []string{fmt.Sprintf(`GRANT USAGE, CREATE ON SCHEMA %s TO %s`, quoteIdent(schema), role)}
+		}
+		for _, stmt := range stmts {
+			if err := p.exec(ctx, tx, t, stmt); err != nil {
+				return fmt.Errorf("postgres grant on schema %s error: %w", schema, err)
+			}
+		}
+	}
+	if err := p.commit(ctx, tx, t); err != nil {
+		return fmt.Errorf("postgres commit error: %w", err)
+	}
+	return nil
+}
+
+// createJobRole creates or renews the role of params with its
+// database-level privileges, in one transaction.
+func (p *PostgresAdapter) createJobRole(ctx context.Context, params JobRoleParams) error {
+	conn, err := p.connect(ctx, params.ConnectionParams, "postgres")
+	if err != nil {
+		return fmt.Errorf("postgres connect error: %w", err)
+	}
+	defer conn.Release()
+
+	var exists bool
+	if err := conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)`, params.Role).Scan(&exists); err != nil {
+		return fmt.Errorf("postgres lookup role error: %w", err)
+	}
+
+	verifier, err := passwordVerifier(PasswordEncryptionSCRAM, params.Role, params.Password)
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("postgres begin error: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	role := quoteIdent(params.Role)
+	dbName := quoteIdent(params.DBName)
+	verb := "CREATE"
+	if exists {
+		verb = "ALTER"
+	}
+	roleSQL := fmt.Sprintf(`%s ROLE %s WITH LOGIN CONNECTION LIMIT 1 VALID UNTIL %s PASSWORD `,
+		verb, role, quoteLiteral(params.ValidUntil.UTC().Format(time.RFC3339)))
+
+	t := targetOf(params.ConnectionParams, "postgres")
+	if err := p.execRedacted(ctx, tx, t, roleSQL+quoteLiteral(verifier), roleSQL+redactedPassword); err != nil {
+		return fmt.Errorf("postgres create job role error: %w", err)
+	}
+
+	privileges := "CONNECT"
+	if params.Write {
+		privileges = "CONNECT, CREATE, TEMPORARY"
+	}
+	stmts := []string{
+		fmt.Sprintf(`COMMENT ON ROLE %s IS %s`, role, quoteLiteral(jobRoleComment+params.DBName)),
+		fmt.Sprintf(`GRANT %s ON DATABASE %s TO %s`, privileges, dbName, role),
+		// Lets the admin user reassign and drop what the role owns.
+		fmt.Sprintf(`GRANT %s TO CURRENT_USER`, role),
+	}
+	for _, member := range params.MemberOf {
+		if member != params.AdminUser {
+			stmts = append(stmts, fmt.Sprintf(`GRANT %s TO %s`, quoteIdent(member), role))
+		}
+	}
+	for _, stmt := range stmts {
+		if err := p.exec(ctx, tx, t, stmt); err != nil {
+			return fmt.Errorf("postgres grant to job role error: %w", err)
+		}
+	}
+	if err := p.commit(ctx, tx, t); err != nil {
+		return fmt.Errorf("postgres commit error: %w", err)
+	}
+	return nil
+}
+
+// DropJobRole drops the role of a finished Job. Objects it created in the
+// database are handed to the admin user first. A missing role or database
+// is not an error.
+func (p *PostgresAdapter) DropJobRole(ctx context.Context, params JobRoleParams) (err error) {
+	defer func() { err = classify(err) }()
+
+	conn, err := p.connect(ctx, params.ConnectionParams, "postgres")
+	if err != nil {
+		return fmt.Errorf("postgres connect error: %w", err)
+	}
+	var exists bool
+	err = conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)`, params.Role).Scan(&exists)
+	conn.Release()
+	if err != nil {
+		return fmt.Errorf("postgres lookup role error: %w", err)
+	}
+	if !exists {
+		return nil
+	}
+
+	role := quoteIdent(params.Role)
+	dbConn, err := p.connect(ctx, params.ConnectionParams, params.DBName)
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &pgErr) && pgErr.Code == "3D000":
+		// invalid_catalog_name: the database is gone, and its objects with it.
+	case err != nil:
+		return fmt.Errorf("postgres connect to db %s error: %w", params.DBName, err)
+	default:
+		t := targetOf(params.ConnectionParams, params.DBName)
+		err := p.exec(ctx, dbConn, t, `REASSIGN OWNED BY `+role+` TO CURRENT_USER`)
+		if err == nil {
+			err = p.exec(ctx, dbConn, t, `DROP OWNED BY `+role)
+		}
+		dbConn.Release()
+		if err != nil {
+			return fmt.Errorf("postgres drop objects of job role error: %w", err)
+		}
+	}
+
+	conn, err = p.connect(ctx, params.ConnectionParams, "postgres")
+	if err != nil {
+		return fmt.Errorf("postgres connect error: %w", err)
+	}
+	defer conn.Release()
+
+	t := targetOf(params.ConnectionParams, "postgres")
+	if err := p.exec(ctx, conn, t, `DROP OWNED BY `+role); err != nil {
+		return fmt.Errorf("postgres drop privileges of job role error: %w", err)
+	}
+	if err := p.exec(ctx, conn, t, `DROP ROLE IF EXISTS `+role); err != nil {
+		return fmt.Errorf("postgres drop job role error: %w", err)
+	}
+	return nil
+}
+
+// dropExpiredJobRoles drops job roles that expired more than an hour ago,
+// e.g. of a resource deleted while its Job ran. Errors are ignored: this is
+// best effort.
+func (p *PostgresAdapter) dropExpiredJobRoles(ctx context.Context, params ConnectionParams) {
+	conn, err := p.connect(ctx, params, "postgres")
+	if err != nil {
+		return
+	}
+	rows, err := conn.Query(ctx, `
+SELECT r.rolname, d.description
+  FROM pg_roles r
+  JOIN pg_shdescription d ON d.objoid = r.oid AND d.classoid = 'pg_authid'::regclass
+ WHERE starts_with(d.description, $1)
+   AND r.rolvaliduntil < now() - interval '1 hour'`, jobRoleComment)
+	var expired []JobRoleParams
+	if err == nil {
+		expired, _ = pgx.CollectRows(rows, func(row pgx.CollectableRow) (JobRoleParams, error) {
+			var role, comment string
+			err := row.Scan(&role, &comment)
+			return JobRoleParams{
+				ConnectionParams: params,
+				DBName:           strings.TrimPrefix(comment, jobRoleComment),
+				Role:             role,
+			}, err
+		})
+	}
+	conn.Release()
+
+	for _, role := range expired {
+		_ = p.DropJobRole(ctx, role)
+	}
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// migrationLockKey is the advisory lock serializing migrations that share
+// the tracking table table.
+func migrationLockKey(table string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("orchestrdb/migrations/" + table))
+	return int64(h.Sum64())
+}
+
+// quoteTable quotes a table name that may be schema-qualified.
+func quoteTable(table string) string {
+	return pgx.Identifier(strings.Split(table, ".")).Sanitize()
+}
+
+// ApplyMigrations applies the pending migrations of params as params.Role.
+// A migration recorded with a different checksum, or missing below the
+// applied version, fails the run before anything is applied.
+func (p *PostgresAdapter) ApplyMigrations(ctx context.Context, params MigrateParams) (result MigrateResult, err error) {
+	defer func() { err = classify(err) }()
+
+	conn, err := p.connect(ctx, params.ConnectionParams, params.Name)
+	if err != nil {
+		return result, fmt.Errorf("postgres connect error: %w", err)
+	}
+	defer conn.Release()
+
+	var exists bool
+	if err := conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)`, params.Role).Scan(&exists); err != nil {
+		return result, fmt.Errorf("postgres lookup role error: %w", err)
+	}
+	if !exists {
+		// Its User may still be reconciling: retried as Transient.
+		return result, fmt.Errorf("migrator role %s does not exist", params.Role)
+	}
+
+	// The lock is held by the session, so it must be released before the
+	// connection returns to the pool.
+	key := migrationLockKey(params.Table)
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, key).Scan(&locked); err != nil {
+		return result, fmt.Errorf("postgres advisory lock error: %w", err)
+	}
+	if !locked {
+		return result, newError(CategoryTransient, "migrations of %s are being applied by another session", params.Table)
+	}
+	defer func() { _, _ = conn.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, key) }()
+
+	t := targetOf(params.ConnectionParams, params.Name)
+	table := quoteTable(params.Table)
+	role := "SET LOCAL ROLE " + quoteIdent(params.Role)
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return result, fmt.Errorf("postgres begin error: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+	stmts := []string{
+		role,
+		"CREATE TABLE IF NOT EXISTS " + table + ` (
+  version bigint PRIMARY KEY,
+  name text NOT NULL,
+  checksum text NOT NULL,
+  applied_at timestamptz NOT NULL DEFAULT now()
+)`,
+	}
+	for _, stmt := range stmts {
+		if err := p.exec(ctx, tx, t, stmt); err != nil {
+			return result, fmt.Errorf("postgres create tracking table error: %w", err)
+		}
+	}
+	if err := p.commit(ctx, tx, t); err != nil {
+		return result, fmt.Errorf("postgres commit error: %w", err)
+	}
+
+	rows, err := conn.Query(ctx, "SELECT version, checksum FROM "+table)
+	if err != nil {
+		return result, fmt.Errorf("postgres read tracking table error: %w", err)
+	}
+	applied := map[int64]string{}
+	var version int64
+	var checksum string
+	if _, err := pgx.ForEachRow(rows, []any{&version, &checksum}, func() error {
+		applied[version] = checksum
+		result.Version = max(result.Version, version)
+		return nil
+	}); err != nil {
+		return result, fmt.Errorf("postgres read tracking table error: %w", err)
+	}
+
+	var pending []Migration
+	for _, m := range params.Migrations {
+		recorded, ok := applied[m.Version]
+		switch {
+		case ok && recorded != m.Checksum:
+			return result, newError(CategoryInvalidSpec, "migration %s was changed after it was applied", m.Name)
+		case ok:
+		case m.Version < result.Version:
+			return result, newError(CategoryInvalidSpec,
+				"migration %s is older than the applied version %d", m.Name, result.Version)
+		default:
+			pending = append(pending, m)
+		}
+	}
+
+	for _, m := range pending {
+		if err := p.applyMigration(ctx, conn, t, role, table, m); err != nil {
+			return result, fmt.Errorf("postgres migration %s error: %w", m.Name, err)
+		}
+		result.Version = m.Version
+		result.Applied++
+	}
+	return result, nil
+}
+
+// applyMigration runs m and records it in the tracking table in one
+// transaction. The audit log records the migration instead of its SQL.
+func (p *PostgresAdapter) applyMigration(ctx context.Context, conn *pooledConn, t target, role, table string, m Migration) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if err := p.exec(ctx, tx, t, role); err != nil {
+		return err
+	}
+	if err := p.execRedacted(ctx, tx, t, m.SQL, fmt.Sprintf("-- migration %s (%s)", m.Name, m.Checksum)); err != nil {
+		return err
+	}
+	record := fmt.Sprintf("INSERT INTO %s (version, name, checksum) VALUES (%d, %s, %s)",
+		table, m.Version, quoteLiteral(m.Name), quoteLiteral(m.Checksum))
+	if err := p.exec(ctx, tx, t, record); err != nil {
+		return err
+	}
+	return p.commit(ctx, tx, t)
+}
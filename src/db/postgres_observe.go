@@ -0,0 +1,228 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ObserveDatabase reports whether the database exists, which of the
+// requested extensions it is missing and how it deviates from params.Hardening.
+// The "postgres" connection is released before connecting to the database.
+func (p *PostgresAdapter) ObserveDatabase(ctx context.Context, params CreateDatabaseParams) (_ *DatabaseState, err error) {
+	defer func() { err = classify(err) }()
+
+	state, err := p.observeDatabaseEntry(ctx, params)
+	if err != nil || !state.Exists || (len(params.Extensions) == 0 && params.Hardening == nil) {
+		return state, err
+	}
+
+	dbConn, err := p.connect(ctx, params.ConnectionParams, params.Name)
+	if err != nil {
+		return nil, fmt.Errorf("postgres connect to db %s error: %w", params.Name, err)
+	}
+	defer dbConn.Release()
+
+	if len(params.Extensions) > 0 {
+		if state.MissingExtensions, err = missingExtensions(ctx, dbConn, params.Extensions); err != nil {
+			return nil, err
+		}
+	}
+	if params.Hardening != nil {
+		schema, err := observeSchemaACL(ctx, dbConn)
+		if err != nil {
+			return nil, err
+		}
+		for _, fix := range schemaHardeningFixes(params, schema) {
+			state.HardeningViolations = append(state.HardeningViolations, fix.violation)
+		}
+	}
+	return state, nil
+}
+
+// observeDatabaseEntry reports whether the database exists and, with
+// params.Hardening, the violations of its database-level part.
+func (p *PostgresAdapter) observeDatabaseEntry(ctx context.Context, params CreateDatabaseParams) (*DatabaseState, error) {
+	conn, err := p.connect(ctx, params.ConnectionParams, "postgres")
+	if err != nil {
+		return nil, fmt.Errorf("postgres connect error: %w", err)
+	}
+	defer conn.Release()
+
+	state := &DatabaseState{}
+	if err := conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)`, params.Name).Scan(&state.Exists); err != nil {
+		return nil, fmt.Errorf("postgres observe database error: %w", err)
+	}
+	if !state.Exists || params.Hardening == nil {
+		return state, nil
+	}
+
+	database, err := observeDatabaseACL(ctx, conn, params.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, fix := range databaseHardeningFixes(params, database) {
+		state.HardeningViolations = append(state.HardeningViolations, fix.violation)
+	}
+	return state, nil
+}
+
+// ObserveServer reports the number and total size of the databases on the
+// server and whether params.Name is one of them.
+func (p *PostgresAdapter) ObserveServer(ctx context.Context, params CreateDatabaseParams) (_ *ServerState, err error) {
+	defer func() { err = classify(err) }()
+
+	conn, err := p.connect(ctx, params.ConnectionParams, "postgres")
+	if err != nil {
+		return nil, fmt.Errorf("postgres connect error: %w", err)
+	}
+	defer conn.Release()
+
+	state := &ServerState{}
+	err = conn.QueryRow(ctx, `
+		SELECT count(*),
+		       coalesce(sum(CASE WHEN has_database_privilege(oid, 'CONNECT') THEN pg_database_size(oid) END), 0),
+		       coalesce(bool_or(datname = $1), false)
+		FROM pg_database
+		WHERE NOT datistemplate AND datname <> 'postgres'`, params.Name,
+	).Scan(&state.Databases, &state.SizeBytes, &state.HasDatabase)
+	if err != nil {
+		return nil, fmt.Errorf("postgres observe server error: %w", err)
+	}
+	return state, nil
+}
+
+// ObserveUser reports whether the role exists, can log in and holds the
+// privileges granted by EnsureUser for params.Access.
+func (p *PostgresAdapter) ObserveUser(ctx context.Context, params EnsureUserParams) (_ *UserState, err error) {
+	defer func() { err = classify(err) }()
+
+	conn, err := p.connect(ctx, params.ConnectionParams, "postgres")
+	if err != nil {
+		return nil, fmt.Errorf("postgres connect error: %w", err)
+	}
+	defer conn.Release()
+
+	state := &UserState{}
+	err = conn.QueryRow(ctx,
+		`SELECT true, rolcanlogin FROM pg_roles WHERE rolname = $1`, params.Username,
+	).Scan(&state.Exists, &state.CanLogin)
+	if err != nil && !isNoRows(err) {
+		return nil, fmt.Errorf("postgres observe role error: %w", err)
+	}
+	if !state.Exists {
+		return state, nil
+	}
+
+	for _, a := range params.Access {
+		role := strings.ToLower(a.Role)
+		if role == "" {
+			role = "readonly"
+		}
+		scope := strings.ToLower(a.Scope)
+		if scope == "" {
+			scope = "database"
+		}
+		if a.DBName == "" {
+			continue
+		}
+
+		// Database-level privileges
+		dbPrivs := []string{"CONNECT"}
+		if scope == "database" && role == "owner" {
+			dbPrivs = append(dbPrivs, "CREATE", "TEMPORARY")
+		}
+		for _, priv := range dbPrivs {
+			var has bool
+			if err := conn.QueryRow(ctx,
+				`SELECT has_database_privilege($1, $2, $3)`, params.Username, a.DBName, priv,
+			).Scan(&has); err != nil {
+				return nil, fmt.Errorf("postgres observe privileges on %s error: %w", a.DBName, err)
+			}
+			if !has {
+				state.MissingPrivileges = append(state.MissingPrivileges,
+					fmt.Sprintf("%s on database %s", priv, a.DBName))
+			}
+		}
+
+		if scope != "database" {
+			continue
+		}
+
+		// Schema-level privileges live in the target database.
+		missing, err := p.observeSchemaPrivileges(ctx, params, a.DBName, role)
+		if err != nil {
+			return nil, err
+		}
+		state.MissingPrivileges = append(state.MissingPrivileges, missing...)
+	}
+
+	return state, nil
+}
+
+// observeSchemaPrivileges checks USAGE on schema public, the default
+// privileges of role on tables the admin user creates there, and its
+// privileges on the existing tables. Tables the admin user cannot grant
+// privileges on are skipped: re-applying the spec cannot change them.
+func (p *PostgresAdapter) observeSchemaPrivileges(ctx context.Context, params EnsureUserParams, dbName, role string) ([]string, error) {
+	dbConn, err := p.connect(ctx, params.ConnectionParams, dbName)
+	if err != nil {
+		return nil, fmt.Errorf("postgres connect to db %s error: %w", dbName, err)
+	}
+	defer dbConn.Release()
+
+	var missing []string
+
+	var usage bool
+	if err := dbConn.QueryRow(ctx,
+		`SELECT has_schema_privilege($1, 'public', 'USAGE')`, params.Username,
+	).Scan(&usage); err != nil {
+		return nil, fmt.Errorf("postgres observe schema privileges on %s error: %w", dbName, err)
+	}
+	if !usage {
+		missing = append(missing, fmt.Sprintf("USAGE on schema %s.public", dbName))
+	}
+
+	tablePrivs := []string{"SELECT"}
+	if role == "readwrite" || role == "owner" {
+		tablePrivs = append(tablePrivs, "INSERT", "UPDATE", "DELETE")
+	}
+	for _, priv := range tablePrivs {
+		var hasDefault bool
+		if err := dbConn.QueryRow(ctx, `
+SELECT EXISTS (
+  SELECT 1
+  FROM pg_default_acl d
+  JOIN pg_namespace n ON n.oid = d.defaclnamespace
+  CROSS JOIN LATERAL aclexplode(d.defaclacl) a
+  WHERE d.defaclrole = (SELECT oid FROM pg_roles WHERE rolname = current_user)
+    AND n.nspname = 'public'
+    AND d.defaclobjtype = 'r'
+    AND a.grantee = (SELECT oid FROM pg_roles WHERE rolname = $1)
+    AND a.privilege_type = $2)`, params.Username, priv,
+		).Scan(&hasDefault); err != nil {
+			return nil, fmt.Errorf("postgres observe default privileges on %s error: %w", dbName, err)
+		}
+		if !hasDefault {
+			missing = append(missing, fmt.Sprintf("default %s on new tables in %s.public", priv, dbName))
+		}
+
+		var count int
+		if err := dbConn.QueryRow(ctx, `
+SELECT count(*)
+FROM pg_class c
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname = 'public'
+  AND c.relkind IN ('r', 'p', 'v', 'm', 'f')
+  AND has_table_privilege(current_user, c.oid, $3)
+  AND NOT has_table_privilege($1, c.oid, $2)`, params.Username, priv, priv+" WITH GRANT OPTION",
+		).Scan(&count); err != nil {
+			return nil, fmt.Errorf("postgres observe table privileges on %s error: %w", dbName, err)
+		}
+		if count > 0 {
+			missing = append(missing, fmt.Sprintf("%s on %d table(s) in %s.public", priv, count, dbName))
+		}
+	}
+
+	return missing, nil
+}
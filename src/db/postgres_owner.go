@@ -0,0 +1,98 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ownedObjectsQuery returns an ALTER ... OWNER TO $1 statement for every
+// schema, relation, routine and type in the current database owned by the
+// current user. System schemas and members of extensions are skipped, and
+// sequences and types that belong to a table follow it.
+const ownedObjectsQuery = `
+WITH me AS (SELECT oid FROM pg_roles WHERE rolname = current_user),
+ext AS (SELECT classid, objid FROM pg_depend WHERE deptype = 'e'),
+sys AS (SELECT oid FROM pg_namespace WHERE nspname LIKE 'pg\_%' OR nspname = 'information_schema')
+SELECT format('ALTER SCHEMA %I OWNER TO %I', n.nspname, $1::text)
+  FROM pg_namespace n
+ WHERE n.nspowner = (SELECT oid FROM me)
+   AND n.oid NOT IN (SELECT oid FROM sys)
+   AND NOT EXISTS (SELECT 1 FROM ext WHERE classid = 'pg_namespace'::regclass AND objid = n.oid)
+UNION ALL
+SELECT format('ALTER %s %s OWNER TO %I',
+         CASE c.relkind WHEN 'v' THEN 'VIEW' WHEN 'm' THEN 'MATERIALIZED VIEW'
+                        WHEN 'S' THEN 'SEQUENCE' WHEN 'f' THEN 'FOREIGN TABLE' ELSE 'TABLE' END,
+         c.oid::regclass, $1::text)
+  FROM pg_class c
+ WHERE c.relowner = (SELECT oid FROM me)
+   AND c.relkind IN ('r', 'p', 'v', 'm', 'S', 'f')
+   AND c.relnamespace NOT IN (SELECT oid FROM sys)
+   AND NOT EXISTS (SELECT 1 FROM ext WHERE classid = 'pg_class'::regclass AND objid = c.oid)
+   AND NOT EXISTS (SELECT 1 FROM pg_depend d
+                    WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype IN ('a', 'i'))
+UNION ALL
+SELECT format('ALTER ROUTINE %s OWNER TO %I', p.oid::regprocedure, $1::text)
+  FROM pg_proc p
+ WHERE p.proowner = (SELECT oid FROM me)
+   AND p.pronamespace NOT IN (SELECT oid FROM sys)
+   AND NOT EXISTS (SELECT 1 FROM ext WHERE classid = 'pg_proc'::regclass AND objid = p.oid)
+UNION ALL
+SELECT format('ALTER %s %s OWNER TO %I', CASE t.typtype WHEN 'd' THEN 'DOMAIN' ELSE 'TYPE' END, t.oid::regtype, $1::text)
+  FROM pg_type t
+ WHERE t.typowner = (SELECT oid FROM me)
+   AND t.typtype IN ('d', 'e', 'r')
+   AND t.typnamespace NOT IN (SELECT oid FROM sys)
+   AND NOT EXISTS (SELECT 1 FROM ext WHERE classid = 'pg_type'::regclass AND objid = t.oid)`
+
+// TransferOwnership hands the objects the admin user owns in the database
+// params.Name over to the role owner, in one transaction. Unlike REASSIGN
+// OWNED it leaves the database itself and objects in other databases alone.
+func (p *PostgresAdapter) TransferOwnership(ctx context.Context, params CreateDatabaseParams, owner string) (err error) {
+	defer func() { err = classify(err) }()
+
+	conn, err := p.connect(ctx, params.ConnectionParams, params.Name)
+	if err != nil {
+		return fmt.Errorf("postgres connect error: %w", err)
+	}
+	defer conn.Release()
+
+	var exists bool
+	if err := conn.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)`, owner).Scan(&exists); err != nil {
+		return fmt.Errorf("postgres lookup role error: %w", err)
+	}
+	if !exists {
+		// Its User may still be reconciling: retried as Transient.
+		return fmt.Errorf("owner role %s does not exist", owner)
+	}
+
+	rows, err := conn.Query(ctx, ownedObjectsQuery, owner)
+	if err != nil {
+		return fmt.Errorf("postgres list owned objects error: %w", err)
+	}
+	stmts, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("postgres list owned objects error: %w", err)
+	}
+	if len(stmts) == 0 {
+		return nil
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("postgres begin error: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	t := targetOf(params.ConnectionParams, params.Name)
+	for _, stmt := range stmts {
+		if err := p.exec(ctx, tx, t, stmt); err != nil {
+			return fmt.Errorf("postgres transfer ownership error: %w", err)
+		}
+	}
+	if err := p.commit(ctx, tx, t); err != nil {
+		return fmt.Errorf("postgres commit error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// RunScripts runs scripts in the database params.Name in one transaction.
+// The audit log records the name of each script instead of its SQL.
+func (p *PostgresAdapter) RunScripts(ctx context.Context, params CreateDatabaseParams, scripts []SQLScript) (err error) {
+	defer func() { err = classify(err) }()
+
+	conn, err := p.connect(ctx, params.ConnectionParams, params.Name)
+	if err != nil {
+		return fmt.Errorf("postgres connect error: %w", err)
+	}
+	defer conn.Release()
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("postgres begin error: %w", err)
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	t := targetOf(params.ConnectionParams, params.Name)
+	for _, script := range scripts {
+		if err := p.execRedacted(ctx, tx, t, script.SQL, "-- script "+script.Name); err != nil {
+			return fmt.Errorf("postgres script %s error: %w", script.Name, err)
+		}
+	}
+	if err := p.commit(ctx, tx, t); err != nil {
+		return fmt.Errorf("postgres commit error: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package db
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// quoteIdent quotes a Postgres identifier (role, database, schema name).
+func quoteIdent(name string) string {
+	return pgx.Identifier{name}.Sanitize()
+}
+
+// quoteLiteral quotes a Postgres string literal. It assumes
+// standard_conforming_strings=on (the default since Postgres 9.1).
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// isNoRows reports whether err is pgx.ErrNoRows.
+func isNoRows(err error) bool {
+	return errors.Is(err, pgx.ErrNoRows)
+}
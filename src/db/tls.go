@@ -0,0 +1,102 @@
+package db
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+// buildTLSConfig materialises the TLS settings of conn into a tls.Config,
+// following libpq semantics for the sslmode values:
+//
+//   - require:     encrypt, verify nothing (verify-ca if a root cert is given)
+//   - verify-ca:   verify the certificate chain, not the hostname
+//   - verify-full: verify the chain and that the hostname matches
+//
+// It returns nil for modes that do not require TLS and have no TLS material.
+func buildTLSConfig(conn ConnectionParams) (*tls.Config, error) {
+	sslMode := conn.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+
+	hasMaterial := len(conn.SSLRootCert) > 0 || len(conn.SSLClientCert) > 0
+	switch sslMode {
+	case "disable":
+		return nil, nil
+	case "allow", "prefer":
+		if !hasMaterial {
+			return nil, nil
+		}
+		sslMode = "require"
+	case "require", "verify-ca", "verify-full":
+	default:
+		return nil, newError(CategoryInvalidSpec, "unsupported sslmode: %s", conn.SSLMode)
+	}
+
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	var pool *x509.CertPool
+	if len(conn.SSLRootCert) > 0 {
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(conn.SSLRootCert) {
+			return nil, newError(CategoryInvalidSpec, "no valid certificates found in sslRootCert")
+		}
+		// libpq: a root certificate turns "require" into "verify-ca".
+		if sslMode == "require" {
+			sslMode = "verify-ca"
+		}
+	}
+
+	if len(conn.SSLClientCert) > 0 || len(conn.SSLClientKey) > 0 {
+		cert, err := tls.X509KeyPair(conn.SSLClientCert, conn.SSLClientKey)
+		if err != nil {
+			return nil, newError(CategoryInvalidSpec, "invalid client certificate/key: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	switch sslMode {
+	case "require":
+		cfg.InsecureSkipVerify = true
+	case "verify-ca":
+		// Go cannot verify the chain without the hostname, so do it by hand.
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			return verifyChain(rawCerts, pool)
+		}
+	case "verify-full":
+		cfg.RootCAs = pool
+		cfg.ServerName = conn.Host
+	}
+
+	return cfg, nil
+}
+
+// verifyChain verifies the peer certificate chain against roots (system roots if nil).
+func verifyChain(rawCerts [][]byte, roots *x509.CertPool) error {
+	if len(rawCerts) == 0 {
+		return errors.New("server presented no certificate")
+	}
+
+	certs := make([]*x509.Certificate, 0, len(rawCerts))
+	for _, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("failed to parse server certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err := certs[0].Verify(opts)
+	return err
+}
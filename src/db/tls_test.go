@@ -0,0 +1,184 @@
+package db
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate and its key, DER and PEM encoded.
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	der     []byte
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert creates a certificate for cn signed by parent, or a
+// self-signed CA when parent is nil.
+func newTestCert(t *testing.T, cn string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{cn},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		der:     der,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func TestBuildTLSConfig(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	client := newTestCert(t, "app", ca)
+	other := newTestCert(t, "other", nil)
+
+	tests := []struct {
+		name    string
+		conn    ConnectionParams
+		wantNil bool
+		// verify is the effective libpq mode: require, verify-ca or verify-full.
+		verify     string
+		clientCert bool
+		wantErr    bool
+	}{
+		{name: "empty mode disables", conn: ConnectionParams{}, wantNil: true},
+		{name: "disable", conn: ConnectionParams{SSLMode: "disable", SSLRootCert: ca.certPEM}, wantNil: true},
+		{name: "prefer without material", conn: ConnectionParams{SSLMode: "prefer"}, wantNil: true},
+		{name: "allow without material", conn: ConnectionParams{SSLMode: "allow"}, wantNil: true},
+		{name: "prefer with root cert", conn: ConnectionParams{SSLMode: "prefer", SSLRootCert: ca.certPEM}, verify: "verify-ca"},
+		{name: "require", conn: ConnectionParams{SSLMode: "require"}, verify: "require"},
+		{name: "require with root cert", conn: ConnectionParams{SSLMode: "require", SSLRootCert: ca.certPEM}, verify: "verify-ca"},
+		{name: "verify-ca", conn: ConnectionParams{SSLMode: "verify-ca", SSLRootCert: ca.certPEM}, verify: "verify-ca"},
+		{name: "verify-full", conn: ConnectionParams{SSLMode: "verify-full", Host: "db.example", SSLRootCert: ca.certPEM}, verify: "verify-full"},
+		{name: "client cert", conn: ConnectionParams{SSLMode: "require", SSLClientCert: client.certPEM, SSLClientKey: client.keyPEM}, verify: "require", clientCert: true},
+		{name: "client cert with prefer", conn: ConnectionParams{SSLMode: "prefer", SSLClientCert: client.certPEM, SSLClientKey: client.keyPEM}, verify: "require", clientCert: true},
+		{name: "unknown mode", conn: ConnectionParams{SSLMode: "strict"}, wantErr: true},
+		{name: "invalid root cert", conn: ConnectionParams{SSLMode: "verify-ca", SSLRootCert: []byte("not a certificate")}, wantErr: true},
+		{name: "client cert without key", conn: ConnectionParams{SSLMode: "require", SSLClientCert: client.certPEM}, wantErr: true},
+		{name: "mismatched client key", conn: ConnectionParams{SSLMode: "require", SSLClientCert: client.certPEM, SSLClientKey: other.keyPEM}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := buildTLSConfig(tt.conn)
+			if tt.wantErr {
+				if CategoryOf(err) != CategoryInvalidSpec {
+					t.Fatalf("err = %v, want an InvalidSpec error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantNil {
+				if cfg != nil {
+					t.Fatalf("config = %+v, want nil", cfg)
+				}
+				return
+			}
+			if cfg == nil {
+				t.Fatal("config is nil")
+			}
+			if cfg.MinVersion != tls.VersionTLS12 {
+				t.Errorf("MinVersion = %x, want TLS 1.2", cfg.MinVersion)
+			}
+
+			switch tt.verify {
+			case "require":
+				if !cfg.InsecureSkipVerify || cfg.VerifyPeerCertificate != nil {
+					t.Errorf("require: InsecureSkipVerify = %v, VerifyPeerCertificate set = %v", cfg.InsecureSkipVerify, cfg.VerifyPeerCertificate != nil)
+				}
+			case "verify-ca":
+				if !cfg.InsecureSkipVerify || cfg.VerifyPeerCertificate == nil {
+					t.Fatalf("verify-ca: InsecureSkipVerify = %v, VerifyPeerCertificate set = %v", cfg.InsecureSkipVerify, cfg.VerifyPeerCertificate != nil)
+				}
+				// Any host name passes, a certificate of another CA does not.
+				server := newTestCert(t, "elsewhere", ca)
+				if err := cfg.VerifyPeerCertificate([][]byte{server.der}, nil); err != nil {
+					t.Errorf("certificate signed by the root rejected: %v", err)
+				}
+				if err := cfg.VerifyPeerCertificate([][]byte{other.der}, nil); err == nil {
+					t.Error("certificate of another CA accepted")
+				}
+			case "verify-full":
+				if cfg.InsecureSkipVerify || cfg.RootCAs == nil || cfg.ServerName != tt.conn.Host {
+					t.Errorf("verify-full: InsecureSkipVerify = %v, RootCAs set = %v, ServerName = %q",
+						cfg.InsecureSkipVerify, cfg.RootCAs != nil, cfg.ServerName)
+				}
+			}
+
+			if got := len(cfg.Certificates) == 1; got != tt.clientCert {
+				t.Errorf("client certificates = %d, want client cert %v", len(cfg.Certificates), tt.clientCert)
+			}
+		})
+	}
+}
+
+func TestVerifyChain(t *testing.T) {
+	ca := newTestCert(t, "ca", nil)
+	server := newTestCert(t, "db.example", ca)
+	other := newTestCert(t, "other", nil)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	tests := []struct {
+		name    string
+		chain   [][]byte
+		wantErr bool
+	}{
+		{name: "signed by root", chain: [][]byte{server.der}},
+		{name: "signed by root with extra certificates", chain: [][]byte{server.der, ca.der}},
+		{name: "other root", chain: [][]byte{other.der}, wantErr: true},
+		{name: "no certificate", chain: nil, wantErr: true},
+		{name: "garbage", chain: [][]byte{[]byte("garbage")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyChain(tt.chain, roots)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyChain() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+// Package discovery builds Database and User manifests in adoption mode from
+// the databases, roles and grants found on an existing server.
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/db"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// Default exclude filters for system databases and roles of PostgreSQL and
+// the common managed services (RDS, Azure, Cloud SQL).
+const (
+	DefaultExcludeDatabases = `^(postgres|rdsadmin|azure_maintenance|azure_sys|cloudsqladmin)$`
+	DefaultExcludeRoles     = `^(pg_.*|postgres|rds.*|azure.*|cloudsql.*)$`
+)
+
+// Filter selects databases and roles by name. A nil include pattern matches
+// everything; exclude patterns win over include patterns.
+type Filter struct {
+	IncludeDatabases *regexp.Regexp
+	ExcludeDatabases *regexp.Regexp
+	IncludeRoles     *regexp.Regexp
+	ExcludeRoles     *regexp.Regexp
+}
+
+// Database reports whether the database name passes the filter.
+func (f Filter) Database(name string) bool {
+	return matches(name, f.IncludeDatabases, f.ExcludeDatabases)
+}
+
+// Role reports whether the role name passes the filter.
+func (f Filter) Role(name string) bool {
+	return matches(name, f.IncludeRoles, f.ExcludeRoles)
+}
+
+func matches(name string, include, exclude *regexp.Regexp) bool {
+	if include != nil && !include.MatchString(name) {
+		return false
+	}
+	return exclude == nil || !exclude.MatchString(name)
+}
+
+// Options describe the server and how the generated manifests reference it.
+type Options struct {
+	Host    string
+	Port    int32
+	SSLMode string
+
+	// Namespace of the generated resources.
+	Namespace string
+
+	// AdminSecretName, if set, is used as adminSecretRef (keys username and
+	// password) in every generated resource.
+	AdminSecretName string
+
+	Filter Filter
+}
+
+// Discover lists the server and returns one Database per included database
+// and one User per included login role that has access to any of them.
+// Superusers are never included. Every manifest has adoption enabled; Users
+// expect the role's current password in the Secret "<name>-password".
+func Discover(ctx context.Context, disc db.Discoverer, conn db.ConnectionParams, opts Options) ([]client.Object, error) {
+	inv, err := disc.DiscoverServer(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Explicit database privileges per (database, role)
+	dbPrivs := map[[2]string]map[string]bool{}
+	for _, g := range inv.DatabaseGrants {
+		key := [2]string{g.Database, g.Role}
+		if dbPrivs[key] == nil {
+			dbPrivs[key] = map[string]bool{}
+		}
+		dbPrivs[key][g.Privilege] = true
+	}
+
+	var objs []client.Object
+	var databases []db.DiscoveredDatabase
+	schemaGrants := map[string]*db.SchemaGrants{}
+
+	for _, d := range inv.Databases {
+		if !opts.Filter.Database(d.Name) {
+			continue
+		}
+		sg, err := disc.DiscoverSchemaGrants(ctx, conn, d.Name)
+		if err != nil {
+			return nil, fmt.Errorf("database %s: %w", d.Name, err)
+		}
+		schemaGrants[d.Name] = sg
+		databases = append(databases, d)
+		objs = append(objs, databaseManifest(d, opts))
+	}
+
+	for _, role := range inv.Roles {
+		if !role.CanLogin || role.Superuser || !opts.Filter.Role(role.Name) {
+			continue
+		}
+
+		var access []v1alpha1.UserAccessRule
+		for _, d := range databases {
+			rule, ok := accessFor(role.Name, d, dbPrivs[[2]string{d.Name, role.Name}], schemaGrants[d.Name])
+			if ok {
+				access = append(access, rule)
+			}
+		}
+		if len(access) == 0 {
+			continue
+		}
+		objs = append(objs, userManifest(role, access, opts))
+	}
+
+	return objs, nil
+}
+
+// accessFor maps the grants role holds on database d to an access rule:
+// the database owner is "owner", full DML on all public tables is
+// "readwrite", SELECT (or schema USAGE only) is "readonly" and a bare
+// CONNECT grant becomes an instance-scoped rule.
+func accessFor(role string, d db.DiscoveredDatabase, dbPrivs map[string]bool, sg *db.SchemaGrants) (v1alpha1.UserAccessRule, bool) {
+	rule := v1alpha1.UserAccessRule{DBName: d.Name, Scope: "database"}
+
+	if d.Owner == role {
+		rule.Role = "owner"
+		return rule, true
+	}
+
+	onAllTables := map[string]bool{}
+	for _, t := range sg.Tables {
+		if t.Role == role && t.AllTables {
+			onAllTables[t.Privilege] = true
+		}
+	}
+	usage := false
+	for _, r := range sg.UsageRoles {
+		if r == role {
+			usage = true
+			break
+		}
+	}
+
+	switch {
+	case onAllTables["SELECT"] && onAllTables["INSERT"] && onAllTables["UPDATE"] && onAllTables["DELETE"]:
+		rule.Role = "readwrite"
+	case onAllTables["SELECT"] || usage:
+		rule.Role = "readonly"
+	case dbPrivs["CONNECT"]:
+		rule.Role = "readonly"
+		rule.Scope = "instance"
+	default:
+		return rule, false
+	}
+	return rule, true
+}
+
+func databaseManifest(d db.DiscoveredDatabase, opts Options) *v1alpha1.Database {
+	res := &v1alpha1.Database{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			Kind:       "Database",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ResourceName(d.Name),
+			Namespace: opts.Namespace,
+		},
+		Spec: v1alpha1.DatabaseSpec{
+			Host:     opts.Host,
+			Port:     opts.Port,
+			Name:     d.Name,
+			SSLMode:  opts.SSLMode,
+			Adoption: &v1alpha1.Adoption{Enabled: true},
+		},
+	}
+	if opts.AdminSecretName != "" {
+		res.Spec.AdminSecretRef = &v1alpha1.SecretRef{
+			Name:        opts.AdminSecretName,
+			UserKey:     "username",
+			PasswordKey: "password",
+		}
+	}
+	return res
+}
+
+func userManifest(role db.DiscoveredRole, access []v1alpha1.UserAccessRule, opts Options) *v1alpha1.User {
+	name := ResourceName(role.Name)
+	user := &v1alpha1.User{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: v1alpha1.SchemeGroupVersion.String(),
+			Kind:       "User",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: opts.Namespace,
+		},
+		Spec: v1alpha1.UserSpec{
+			Host:            opts.Host,
+			Port:            opts.Port,
+			SSLMode:         opts.SSLMode,
+			Username:        role.Name,
+			GeneratedSecret: v1alpha1.GeneratedSecret{Name: name + "-credentials"},
+			Access:          access,
+			Adoption: &v1alpha1.UserAdoption{
+				Enabled:           true,
+				PasswordSecretRef: &v1alpha1.AdoptionPasswordSecretRef{Name: name + "-password"},
+			},
+		},
+	}
+	if opts.AdminSecretName != "" {
+		user.Spec.AdminSecretRef = &v1alpha1.AdminSecretRef{
+			Name:        opts.AdminSecretName,
+			UserKey:     "username",
+			PasswordKey: "password",
+		}
+	}
+	if len(role.MemberOf) > 0 {
+		user.Annotations = map[string]string{
+			v1alpha1.AnnotationDiscoveredMemberOf: strings.Join(role.MemberOf, ","),
+		}
+	}
+	return user
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// ResourceName turns a database or role name into a valid Kubernetes object name.
+func ResourceName(name string) string {
+	out := invalidNameChars.ReplaceAllString(strings.ToLower(name), "-")
+	out = strings.Trim(out, "-.")
+	if len(out) > 253 {
+		out = strings.TrimRight(out[:253], "-.")
+	}
+	if out == "" {
+		out = "unnamed"
+	}
+	return out
+}
+
+// Render returns the objects as a multi-document YAML stream without status
+// and other server-populated fields.
+func Render(objs []client.Object) ([]byte, error) {
+	var buf bytes.Buffer
+	for i, obj := range objs {
+		raw, err := json.Marshal(obj)
+		if err != nil {
+			return nil, err
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return nil, err
+		}
+		delete(m, "status")
+		if meta, ok := m["metadata"].(map[string]interface{}); ok {
+			delete(meta, "creationTimestamp")
+		}
+
+		out, err := yaml.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.Write(out)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,351 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// dumpMountPath is where backup and restore Jobs mount their Secret
+	// (CA certificate).
+	dumpMountPath = "/etc/orchestrdb/dump"
+
+	// backupDataPath is where backup Jobs mount the PVC or the scratch
+	// volume the dump is written to before it is uploaded.
+	backupDataPath = "/backup"
+
+	// BackupContainer is the container of a backup Job whose termination
+	// message carries the BackupResult.
+	BackupContainer = "backup"
+)
+
+// backupDumpScript runs pg_dump into $BACKUP_TARGET and writes the size and
+// checksum of the dump as a BackupResult to $BACKUP_RESULT.
+const backupDumpScript = `mkdir -p "$(dirname "$BACKUP_TARGET")"
+pg_dump --format="$BACKUP_FORMAT" ${BACKUP_COMPRESSION:+--compress="$BACKUP_COMPRESSION"} --file="$BACKUP_TARGET" --dbname="$DSN"
+size=$(find "$BACKUP_TARGET" -type f -printf '%s\n' | awk '{ s += $1 } END { print s + 0 }')
+if [ -d "$BACKUP_TARGET" ]; then
+  sum=$(cd "$BACKUP_TARGET" && find . -type f | LC_ALL=C sort | xargs -r sha256sum | sha256sum | cut -d' ' -f1)
+else
+  sum=$(sha256sum "$BACKUP_TARGET" | cut -d' ' -f1)
+fi
+printf '{"sizeBytes":%s,"checksum":"sha256:%s"}' "$size" "$sum" > "$BACKUP_RESULT"
+`
+
+// BackupResult is reported by a backup Job in its termination message.
+type BackupResult struct {
+	SizeBytes int64  `json:"sizeBytes"`
+	Checksum  string `json:"checksum"`
+}
+
+// ParseBackupResult decodes the termination message of a backup Job.
+func ParseBackupResult(message string) (*BackupResult, error) {
+	var result BackupResult
+	if err := json.Unmarshal([]byte(strings.TrimSpace(message)), &result); err != nil {
+		return nil, fmt.Errorf("invalid backup result %q: %w", message, err)
+	}
+	return &result, nil
+}
+
+// ValidateBackupSpec checks the parts of a Backup spec the CRD schema does
+// not enforce.
+func ValidateBackupSpec(spec *v1alpha1.BackupSpec) error {
+	switch spec.Format {
+	case "", v1alpha1.BackupFormatCustom, v1alpha1.BackupFormatPlain, v1alpha1.BackupFormatDirectory:
+	default:
+		return invalidSpec("unknown backup format %s", spec.Format)
+	}
+	if c := spec.Compression; c != nil && (*c < 0 || *c > 9) {
+		return invalidSpec("compression must be between 0 and 9")
+	}
+
+	dest := spec.Destination
+	switch {
+	case dest.PVC != nil && dest.S3 != nil:
+		return invalidSpec("destination must set only one of pvc and s3")
+	case dest.PVC != nil:
+		if dest.PVC.ClaimName == "" {
+			return invalidSpec("destination.pvc.claimName is required")
+		}
+		if p := dest.PVC.Path; path.IsAbs(p) || slices.Contains(strings.Split(p, "/"), "..") {
+			return invalidSpec("destination.pvc.path must be relative to the volume and must not contain ..")
+		}
+	case dest.S3 != nil:
+		if dest.S3.Bucket == "" || dest.S3.CredentialsSecretRef.Name == "" {
+			return invalidSpec("destination.s3 requires bucket and credentialsSecretRef")
+		}
+	default:
+		return invalidSpec("destination must set pvc or s3")
+	}
+	return nil
+}
+
+// BackupLocation returns where the dump of backup is stored:
+// pvc://<claim>/<path> or s3://<bucket>/<key>.
+func BackupLocation(backup *v1alpha1.Backup) string {
+	file := backupFile(backup)
+	if pvc := backup.Spec.Destination.PVC; pvc != nil {
+		return "pvc://" + pvc.ClaimName + path.Join("/", pvc.Path, file)
+	}
+	s3 := backup.Spec.Destination.S3
+	return "s3://" + s3.Bucket + "/" + s3Key(s3, file)
+}
+
+// backupFile returns the file (or directory) name of the dump.
+func backupFile(backup *v1alpha1.Backup) string {
+	switch backup.Spec.Format {
+	case v1alpha1.BackupFormatDirectory:
+		return backup.Name
+	case v1alpha1.BackupFormatPlain:
+		// pg_dump gzips a plain script when compression is requested.
+		if c := backup.Spec.Compression; c != nil && *c > 0 {
+			return backup.Name + ".sql.gz"
+		}
+		return backup.Name + ".sql"
+	default:
+		return backup.Name + ".dump"
+	}
+}
+
+func s3Key(s3 *v1alpha1.S3Destination, file string) string {
+	prefix := strings.Trim(s3.Prefix, "/")
+	if prefix == "" {
+		return file
+	}
+	return prefix + "/" + file
+}
+
+// DumpSecretData creates the job role of a backup or restore Job of dbRes
+// and returns the data of the Job's Secret: the libpq connection string
+// (DSN) of the role and the CA certificate it refers to.
+func (s *DatabaseService) DumpSecretData(
+	ctx context.Context,
+	dbRes *v1alpha1.Database,
+	adminUser string,
+	adminPassword string,
+	role JobRole,
+) (map[string][]byte, error) {
+	params, err := s.ensureJobRole(ctx, dbRes, adminUser, adminPassword, role)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string][]byte{}
+	data["DSN"] = []byte(jobDSN(params, dumpMountPath, "database", data))
+	return data, nil
+}
+
+// BackupJob returns the Job dumping the database of backup, reading its
+// connection string from the Secret of the same name. With a PVC the dump
+// is written to the volume directly; with S3 it is written to a scratch
+// volume by an init container and uploaded by the backup container. The
+// Job is stopped after deadline, when its role expires.
+func BackupJob(backup *v1alpha1.Backup, name, pgToolsImage, s3ToolsImage string, deadline time.Duration) *batchv1.Job {
+	format := backup.Spec.Format
+	if format == "" {
+		format = v1alpha1.BackupFormatCustom
+	}
+	file := backupFile(backup)
+
+	env := []corev1.EnvVar{
+		{Name: "DSN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: name},
+			Key:                  "DSN",
+		}}},
+		{Name: "BACKUP_FORMAT", Value: string(format)},
+	}
+	if c := backup.Spec.Compression; c != nil {
+		env = append(env, corev1.EnvVar{Name: "BACKUP_COMPRESSION", Value: fmt.Sprint(*c)})
+	}
+
+	dump := corev1.Container{
+		Name:    BackupContainer,
+		Image:   pgToolsImage,
+		Command: []string{"bash", "-euo", "pipefail", "-c", backupDumpScript},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "secret", MountPath: dumpMountPath, ReadOnly: true},
+			{Name: "data", MountPath: backupDataPath},
+		},
+	}
+	job := backupJob(backup, name)
+	activeDeadline := int64(deadline.Seconds())
+	job.Spec.ActiveDeadlineSeconds = &activeDeadline
+	spec := &job.Spec.Template.Spec
+	spec.Volumes = append(spec.Volumes, secretVolume(name))
+
+	if pvc := backup.Spec.Destination.PVC; pvc != nil {
+		dump.Env = append(env,
+			corev1.EnvVar{Name: "BACKUP_TARGET", Value: path.Join(backupDataPath, pvc.Path, file)},
+			corev1.EnvVar{Name: "BACKUP_RESULT", Value: corev1.TerminationMessagePathDefault})
+		spec.Containers = []corev1.Container{dump}
+		return job
+	}
+
+	s3 := backup.Spec.Destination.S3
+	target := path.Join(backupDataPath, file)
+	result := path.Join(backupDataPath, "result.json")
+	dump.Name = "dump"
+	dump.Env = append(env,
+		corev1.EnvVar{Name: "BACKUP_TARGET", Value: target},
+		corev1.EnvVar{Name: "BACKUP_RESULT", Value: result})
+	spec.InitContainers = []corev1.Container{dump}
+
+	cp := "aws s3 cp"
+	if format == v1alpha1.BackupFormatDirectory {
+		cp += " --recursive"
+	}
+	upload := s3Container(s3, BackupContainer, s3ToolsImage,
+		cp+` "$BACKUP_TARGET" "$S3_URL"`+"\n"+`cp "$BACKUP_RESULT" `+corev1.TerminationMessagePathDefault)
+	upload.Env = append(upload.Env,
+		corev1.EnvVar{Name: "BACKUP_TARGET", Value: target},
+		corev1.EnvVar{Name: "BACKUP_RESULT", Value: result},
+		corev1.EnvVar{Name: "S3_URL", Value: BackupLocation(backup)})
+	upload.VolumeMounts = []corev1.VolumeMount{{Name: "data", MountPath: backupDataPath, ReadOnly: true}}
+	spec.Containers = []corev1.Container{upload}
+	spec.Volumes = append(spec.Volumes, corev1.Volume{
+		Name:         "data",
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+	return job
+}
+
+// BackupCleanupJob returns the Job removing the dump of backup from its
+// destination.
+func BackupCleanupJob(backup *v1alpha1.Backup, name, pgToolsImage, s3ToolsImage string) *batchv1.Job {
+	job := backupJob(backup, name)
+	spec := &job.Spec.Template.Spec
+
+	if pvc := backup.Spec.Destination.PVC; pvc != nil {
+		spec.Containers = []corev1.Container{{
+			Name:    "cleanup",
+			Image:   pgToolsImage,
+			Command: []string{"bash", "-euo", "pipefail", "-c", `rm -rf -- "$BACKUP_TARGET"`},
+			Env: []corev1.EnvVar{
+				{Name: "BACKUP_TARGET", Value: path.Join(backupDataPath, pvc.Path, backupFile(backup))},
+			},
+			VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: backupDataPath}},
+		}}
+		return job
+	}
+
+	rm := "aws s3 rm"
+	if backup.Spec.Format == v1alpha1.BackupFormatDirectory {
+		rm += " --recursive"
+	}
+	cleanup := s3Container(backup.Spec.Destination.S3, "cleanup", s3ToolsImage, rm+` "$S3_URL"`)
+	cleanup.Env = append(cleanup.Env, corev1.EnvVar{Name: "S3_URL", Value: BackupLocation(backup)})
+	spec.Containers = []corev1.Container{cleanup}
+	return job
+}
+
+// dumpJob returns a Job without containers for the custom resource owner
+// of the given kind. A PVC named claimName, if any, is mounted as volume
+// "data". A failed Job is not retried.
+func dumpJob(kind string, owner metav1.Object, name, claimName string) *batchv1.Job {
+	backoffLimit := int32(0)
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: owner.GetNamespace(),
+			Labels: map[string]string{
+				v1alpha1.LabelManagedBy: v1alpha1.ManagedByValue,
+				v1alpha1.LabelOwnerKind: kind,
+				v1alpha1.LabelOwnerName: owner.GetName(),
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{RestartPolicy: corev1.RestartPolicyNever},
+			},
+		},
+	}
+	if claimName != "" {
+		job.Spec.Template.Spec.Volumes = []corev1.Volume{{
+			Name: "data",
+			VolumeSource: corev1.VolumeSource{PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: claimName,
+			}},
+		}}
+	}
+	return job
+}
+
+// backupJob returns a Job of backup without containers.
+func backupJob(backup *v1alpha1.Backup, name string) *batchv1.Job {
+	var claimName string
+	if pvc := backup.Spec.Destination.PVC; pvc != nil {
+		claimName = pvc.ClaimName
+	}
+	return dumpJob("Backup", backup, name, claimName)
+}
+
+// s3Container returns a container running script with the AWS CLI against
+// the bucket of s3, with the access keys from its credentials Secret.
+func s3Container(s3 *v1alpha1.S3Destination, name, image, script string) corev1.Container {
+	ref := s3.CredentialsSecretRef
+	idKey, secretKey := ref.AccessKeyIDKey, ref.SecretAccessKeyKey
+	if idKey == "" {
+		idKey = "AWS_ACCESS_KEY_ID"
+	}
+	if secretKey == "" {
+		secretKey = "AWS_SECRET_ACCESS_KEY"
+	}
+	region := s3.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	key := func(env, key string) corev1.EnvVar {
+		return corev1.EnvVar{
+			Name: env,
+			ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: ref.Name},
+				Key:                  key,
+			}},
+		}
+	}
+	env := []corev1.EnvVar{
+		key("AWS_ACCESS_KEY_ID", idKey),
+		key("AWS_SECRET_ACCESS_KEY", secretKey),
+		{Name: "AWS_DEFAULT_REGION", Value: region},
+	}
+	if s3.Endpoint != "" {
+		env = append(env, corev1.EnvVar{Name: "AWS_ENDPOINT_URL", Value: s3.Endpoint})
+	}
+	if s3.ForcePathStyle {
+		script = "aws configure set default.s3.addressing_style path\n" + script
+	}
+
+	return corev1.Container{
+		Name:    name,
+		Image:   image,
+		Command: []string{"bash", "-euo", "pipefail", "-c", script},
+		Env:     env,
+	}
+}
+
+// secretVolume returns the volume "secret" with the Secret name, readable
+// by its owner only.
+func secretVolume(name string) corev1.Volume {
+	defaultMode := int32(0o400)
+	return corev1.Volume{
+		Name: "secret",
+		VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+			SecretName:  name,
+			DefaultMode: &defaultMode,
+		}},
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"text/template"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+)
+
+// maxIdentifierLength is the longest PostgreSQL identifier (NAMEDATALEN - 1).
+const maxIdentifierLength = 63
+
+// ownerSuffix is appended to the database name to name the owner role.
+const ownerSuffix = "_owner"
+
+// claimHashLength is the number of hex digits of the hash suffix of claimed
+// database names with hyphens.
+const claimHashLength = 8
+
+// ClaimDatabaseName renders the database name of claim from the class's
+// nameTemplate. Hyphens become underscores so the name needs no quoting;
+// the rendered name then gets a short hash of itself as suffix, so that
+// e.g. team-a/x and team/a-x do not both become team_a_x. A template that
+// fails or renders an unusable name is an InvalidSpec error.
+func ClaimDatabaseName(class *v1alpha1.DatabaseClass, claim *v1alpha1.DatabaseClaim) (string, error) {
+	text := class.Spec.NameTemplate
+	if text == "" {
+		text = v1alpha1.DefaultClaimNameTemplate
+	}
+
+	tmpl, err := template.New(class.Name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", invalidSpec("invalid nameTemplate of DatabaseClass %s: %v", class.Name, err)
+	}
+
+	var b strings.Builder
+	err = tmpl.Execute(&b, struct {
+		Namespace string
+		Name      string
+		ClassName string
+	}{claim.Namespace, claim.Name, class.Name})
+	if err != nil {
+		return "", invalidSpec("nameTemplate of DatabaseClass %s failed: %v", class.Name, err)
+	}
+
+	rendered := strings.TrimSpace(b.String())
+	if rendered == "" {
+		return "", invalidSpec("nameTemplate of DatabaseClass %s rendered an empty name", class.Name)
+	}
+	name := rendered
+	if strings.Contains(rendered, "-") {
+		sum := sha256.Sum256([]byte(rendered))
+		name = strings.ReplaceAll(rendered, "-", "_") + "_" + hex.EncodeToString(sum[:])[:claimHashLength]
+	}
+	if len(name)+len(ownerSuffix) > maxIdentifierLength {
+		return "", invalidSpec("database name %s is too long: the owner role %s%s exceeds %d characters",
+			name, name, ownerSuffix, maxIdentifierLength)
+	}
+	return name, nil
+}
+
+// ClaimUsername returns the owner role of a claimed database.
+func ClaimUsername(databaseName string) string {
+	return databaseName + ownerSuffix
+}
+
+// ClaimSecretName returns the name of the claim's credentials Secret.
+func ClaimSecretName(claim *v1alpha1.DatabaseClaim) string {
+	if claim.Spec.SecretName != "" {
+		return claim.Spec.SecretName
+	}
+	return claim.Name + "-credentials"
+}
+
+// ClaimDatabaseSpec returns the spec of the Database created for claim. The
+// names are taken from the claim status, where they are fixed once rendered.
+func ClaimDatabaseSpec(class *v1alpha1.DatabaseClass, claim *v1alpha1.DatabaseClaim) v1alpha1.DatabaseSpec {
+	spec := v1alpha1.DatabaseSpec{
+		Host:           class.Spec.Host,
+		Port:           class.Spec.Port,
+		Placement:      class.Spec.Placement.DeepCopy(),
+		Name:           claim.Status.DatabaseName,
+		SSLMode:        class.Spec.SSLMode,
+		DriftPolicy:    class.Spec.DriftPolicy,
+		DeletionPolicy: class.Spec.DeletionPolicy,
+	}
+	if class.Spec.AdminSecretRef != nil {
+		ref := *class.Spec.AdminSecretRef
+		spec.AdminSecretRef = &ref
+	}
+	if class.Spec.AdminVaultRef != nil {
+		ref := *class.Spec.AdminVaultRef
+		spec.AdminVaultRef = &ref
+	}
+	if class.Spec.Extensions != nil {
+		spec.Extensions = append([]string(nil), class.Spec.Extensions...)
+	}
+	return spec
+}
+
+// ClaimUserSpec returns the spec of the User created for claim: the owner
+// of the claimed database on the server hosting it, with credentials and
+// connection details written to the claim's Secret.
+func ClaimUserSpec(class *v1alpha1.DatabaseClass, claim *v1alpha1.DatabaseClaim, dbRes *v1alpha1.Database) v1alpha1.UserSpec {
+	host, port := dbRes.Server()
+	spec := v1alpha1.UserSpec{
+		Host:     host,
+		Port:     port,
+		SSLMode:  class.Spec.SSLMode,
+		Username: claim.Status.Username,
+		GeneratedSecret: v1alpha1.GeneratedSecret{
+			Name:     claim.Status.SecretName,
+			Database: claim.Status.DatabaseName,
+		},
+		Access: []v1alpha1.UserAccessRule{{
+			DBName: claim.Status.DatabaseName,
+			Role:   "owner",
+			Scope:  "database",
+		}},
+		DriftPolicy:        class.Spec.DriftPolicy,
+		PasswordPolicy:     class.Spec.PasswordPolicy.DeepCopy(),
+		PasswordEncryption: class.Spec.PasswordEncryption,
+		DeletionPolicy:     class.Spec.DeletionPolicy,
+	}
+	if ref := class.Spec.AdminSecretRef; ref != nil {
+		spec.AdminSecretRef = &v1alpha1.AdminSecretRef{
+			Name:        ref.Name,
+			Namespace:   ref.Namespace,
+			UserKey:     ref.UserKey,
+			PasswordKey: ref.PasswordKey,
+		}
+	}
+	if class.Spec.AdminVaultRef != nil {
+		ref := *class.Spec.AdminVaultRef
+		spec.AdminVaultRef = &ref
+	}
+	return spec
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/db"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testClass(nameTemplate string) *v1alpha1.DatabaseClass {
+	return &v1alpha1.DatabaseClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "standard"},
+		Spec:       v1alpha1.DatabaseClassSpec{NameTemplate: nameTemplate},
+	}
+}
+
+func testClaim(namespace, name string) *v1alpha1.DatabaseClaim {
+	return &v1alpha1.DatabaseClaim{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+}
+
+func TestClaimDatabaseName(t *testing.T) {
+	hashed := regexp.MustCompile(`^[a-z0-9_]+_[0-9a-f]{8}$`)
+
+	tests := []struct {
+		name         string
+		nameTemplate string
+		namespace    string
+		claim        string
+		want         string // exact name; empty to only match the hashed form
+		wantErr      bool
+	}{
+		{name: "default template", namespace: "team", claim: "app", want: "team_app"},
+		{name: "custom template", nameTemplate: "{{ .ClassName }}_{{ .Name }}", namespace: "team", claim: "app", want: "standard_app"},
+		{name: "surrounding space is trimmed", nameTemplate: " {{ .Name }} ", namespace: "team", claim: "app", want: "app"},
+		{name: "hyphens are hashed", namespace: "team-a", claim: "app"},
+		{name: "empty render", nameTemplate: "{{ if false }}x{{ end }}", namespace: "team", claim: "app", wantErr: true},
+		{name: "invalid template", nameTemplate: "{{ .Name", namespace: "team", claim: "app", wantErr: true},
+		{name: "unknown field", nameTemplate: "{{ .Cluster }}", namespace: "team", claim: "app", wantErr: true},
+		{name: "owner role too long", namespace: "team", claim: strings.Repeat("a", 53), wantErr: true},
+		{name: "longest owner role", nameTemplate: "{{ .Name }}", namespace: "team", claim: strings.Repeat("a", 57), want: strings.Repeat("a", 57)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ClaimDatabaseName(testClass(tt.nameTemplate), testClaim(tt.namespace, tt.claim))
+			if tt.wantErr {
+				if db.CategoryOf(err) != db.CategoryInvalidSpec {
+					t.Fatalf("ClaimDatabaseName() = %q, %v; want an InvalidSpec error", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != "" && got != tt.want {
+				t.Errorf("ClaimDatabaseName() = %q, want %q", got, tt.want)
+			}
+			if tt.want == "" && !hashed.MatchString(got) {
+				t.Errorf("ClaimDatabaseName() = %q, want <name>_<hash>", got)
+			}
+			if strings.Contains(got, "-") {
+				t.Errorf("ClaimDatabaseName() = %q contains a hyphen", got)
+			}
+		})
+	}
+}
+
+// TestClaimDatabaseNameCollisions checks that claims whose names only
+// differ in where the hyphens are get distinct databases. Templates that
+// drop the separator entirely are caught by the claim controller instead.
+func TestClaimDatabaseNameCollisions(t *testing.T) {
+	tests := []struct {
+		nameTemplate string
+		a, b         [2]string // namespace, name
+	}{
+		{a: [2]string{"team-a", "x"}, b: [2]string{"team", "a-x"}},
+		{a: [2]string{"a-b", "c-d"}, b: [2]string{"a", "b-c-d"}},
+		{a: [2]string{"team-a", "x"}, b: [2]string{"team-a-x", "x"}},
+		{nameTemplate: "{{ .Namespace }}_{{ .ClassName }}_{{ .Name }}", a: [2]string{"a-b", "c"}, b: [2]string{"a", "b-c"}},
+	}
+	for _, tt := range tests {
+		class := testClass(tt.nameTemplate)
+		a, errA := ClaimDatabaseName(class, testClaim(tt.a[0], tt.a[1]))
+		b, errB := ClaimDatabaseName(class, testClaim(tt.b[0], tt.b[1]))
+		if errA != nil || errB != nil {
+			t.Errorf("%v / %v: %v, %v", tt.a, tt.b, errA, errB)
+			continue
+		}
+		if a == b {
+			t.Errorf("%s/%s and %s/%s both claim database %s", tt.a[0], tt.a[1], tt.b[0], tt.b[1], a)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/db"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ErrSourceNotReady is returned while the Database named in spec.source
+// does not exist, is not created yet or is still being copied itself.
+var ErrSourceNotReady = errors.New("source Database is not ready")
+
+// cloneMountPath is where the clone Job mounts its Secret (TLS material).
+const cloneMountPath = "/etc/orchestrdb/clone"
+
+// ResolveSource returns the Database named in spec.source of dbRes.
+func (s *DatabaseService) ResolveSource(ctx context.Context, dbRes *v1alpha1.Database) (*v1alpha1.Database, error) {
+	name := dbRes.Spec.Source.DatabaseRef.Name
+	if name == dbRes.Name {
+		return nil, invalidSpec("source.databaseRef cannot name the Database itself")
+	}
+
+	var source v1alpha1.Database
+	err := s.k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: dbRes.Namespace}, &source)
+	if apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("%w: Database %s not found", ErrSourceNotReady, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !source.Status.Created || source.Cloning() {
+		return nil, fmt.Errorf("%w: Database %s is not created yet", ErrSourceNotReady, name)
+	}
+	return &source, nil
+}
+
+// CloneMethodFor returns how dbRes is copied from source: from a template
+// when both live on the same server, with a dump otherwise.
+func CloneMethodFor(dbRes, source *v1alpha1.Database) v1alpha1.CloneMethod {
+	host, port := dbRes.Server()
+	sourceHost, sourcePort := source.Server()
+	if host == sourceHost && port == sourcePort {
+		return v1alpha1.CloneMethodTemplate
+	}
+	return v1alpha1.CloneMethodDump
+}
+
+// CloneSecretData returns the data of the Secret used by the clone Job:
+// libpq connection strings of the source and the target database
+// (SOURCE_DSN, TARGET_DSN) and the CA certificates they refer to. The Job
+// logs in as sourceRole, which can read the source, and targetRole, which
+// can write the target; both are created here.
+func (s *DatabaseService) CloneSecretData(
+	ctx context.Context,
+	dbRes *v1alpha1.Database,
+	adminUser string,
+	adminPassword string,
+	targetRole JobRole,
+	source *v1alpha1.Database,
+	sourceAdminUser string,
+	sourceAdminPassword string,
+	sourceRole JobRole,
+) (map[string][]byte, error) {
+	from, err := s.ensureJobRole(ctx, source, sourceAdminUser, sourceAdminPassword, sourceRole)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.ensureJobRole(ctx, dbRes, adminUser, adminPassword, targetRole)
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string][]byte{}
+	data["SOURCE_DSN"] = []byte(jobDSN(from, cloneMountPath, "source", data))
+	data["TARGET_DSN"] = []byte(jobDSN(target, cloneMountPath, "target", data))
+	return data, nil
+}
+
+// jobDSN returns a libpq keyword/value connection string for params. The
+// CA certificate is added to files under prefix and referenced by its path
+// in dir, where the Job mounts the Secret holding files.
+func jobDSN(params db.CreateDatabaseParams, dir, prefix string, files map[string][]byte) string {
+	kv := [][2]string{
+		{"host", params.Host},
+		{"port", fmt.Sprint(params.Port)},
+		{"dbname", params.Name},
+		{"user", params.AdminUser},
+		{"password", params.Password},
+		{"sslmode", params.SSLMode},
+	}
+	if len(params.SSLRootCert) > 0 {
+		files[prefix+"-ca.crt"] = params.SSLRootCert
+		kv = append(kv, [2]string{"sslrootcert", dir + "/" + prefix + "-ca.crt"})
+	}
+
+	parts := make([]string, 0, len(kv))
+	for _, p := range kv {
+		value := strings.ReplaceAll(p[1], `\`, `\\`)
+		value = strings.ReplaceAll(value, `'`, `\'`)
+		parts = append(parts, p[0]+"='"+value+"'")
+	}
+	return strings.Join(parts, " ")
+}
+
+// CloneJob returns the Job streaming pg_dump of the source into pg_restore
+// of dbRes, reading both connection strings from the Secret of the same
+// name. Objects are restored without their owners and privileges, owned by
+// the target's job role until it is dropped. A failed Job is not retried:
+// the target would no longer be empty. It is stopped after deadline, when
+// its roles expire.
+func CloneJob(dbRes *v1alpha1.Database, name, image string, deadline time.Duration) *batchv1.Job {
+	backoffLimit := int32(0)
+	activeDeadline := int64(deadline.Seconds())
+	defaultMode := int32(0o400)
+
+	dsn := func(key string) corev1.EnvVar {
+		return corev1.EnvVar{
+			Name: key,
+			ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: name},
+				Key:                  key,
+			}},
+		}
+	}
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: dbRes.Namespace,
+			Labels: map[string]string{
+				v1alpha1.LabelManagedBy: v1alpha1.ManagedByValue,
+				v1alpha1.LabelOwnerKind: "Database",
+				v1alpha1.LabelOwnerName: dbRes.Name,
+			},
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:          &backoffLimit,
+			ActiveDeadlineSeconds: &activeDeadline,
+			Template: corev1.PodTemplateSpec{
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{{
+						Name:  "clone",
+						Image: image,
+						Command: []string{"bash", "-o", "pipefail", "-c",
+							`pg_dump --format=custom --no-owner --no-privileges --dbname="$SOURCE_DSN" | ` +
+								`pg_restore --no-owner --no-privileges --exit-on-error --dbname="$TARGET_DSN"`},
+						Env: []corev1.EnvVar{dsn("SOURCE_DSN"), dsn("TARGET_DSN")},
+						VolumeMounts: []corev1.VolumeMount{{
+							Name:      "clone",
+							MountPath: cloneMountPath,
+							ReadOnly:  true,
+						}},
+					}},
+					Volumes: []corev1.Volume{{
+						Name: "clone",
+						VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+							SecretName:  name,
+							DefaultMode: &defaultMode,
+						}},
+					}},
+				},
+			},
+		},
+	}
+}
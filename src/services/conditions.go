@@ -0,0 +1,50 @@
+package services
+
+import (
+	"strings"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/db"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// setReadyCondition records the outcome of an adapter call in the Ready
+// condition. Failures use the adapter error category as reason.
+func setReadyCondition(conditions *[]metav1.Condition, generation int64, err error) {
+	cond := metav1.Condition{
+		Type:               v1alpha1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             v1alpha1.ReasonReconciled,
+		ObservedGeneration: generation,
+	}
+	if err != nil {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = string(db.CategoryOf(err))
+		cond.Message = err.Error()
+	}
+	meta.SetStatusCondition(conditions, cond)
+}
+
+// setHardenedCondition records the violations of the hardening profile found
+// in a database. Without a profile (hardening nil) the condition is removed.
+func setHardenedCondition(conditions *[]metav1.Condition, generation int64, hardening *db.Hardening, violations []string) {
+	if hardening == nil {
+		meta.RemoveStatusCondition(conditions, v1alpha1.ConditionHardened)
+		return
+	}
+	cond := metav1.Condition{
+		Type:               v1alpha1.ConditionHardened,
+		Status:             metav1.ConditionTrue,
+		Reason:             v1alpha1.ReasonHardened,
+		Message:            "PUBLIC is restricted and " + hardening.Owner + " owns the database",
+		ObservedGeneration: generation,
+	}
+	if len(violations) > 0 {
+		cond.Status = metav1.ConditionFalse
+		cond.Reason = v1alpha1.ReasonHardeningViolated
+		cond.Message = strings.Join(violations, "; ")
+	}
+	meta.SetStatusCondition(conditions, cond)
+}
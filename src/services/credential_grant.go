@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ErrReferenceNotPermitted is returned when a resource references a Secret in
+// another namespace without a matching CredentialGrant.
+var ErrReferenceNotPermitted = errors.New("cross-namespace secret reference not permitted")
+
+// CheckSecretReference verifies that from, a resource of the given kind, may
+// read the Secret secretNamespace/secretName. References within the same
+// namespace are always allowed; cross-namespace references require a
+// CredentialGrant in the Secret's namespace, unless from was created for a
+// DatabaseClaim whose class references that Secret.
+func CheckSecretReference(
+	ctx context.Context,
+	c client.Reader,
+	kind string,
+	from client.Object,
+	secretNamespace string,
+	secretName string,
+) error {
+	fromNamespace := from.GetNamespace()
+	if secretNamespace == fromNamespace {
+		return nil
+	}
+
+	permitted, err := claimPermits(ctx, c, kind, from, secretNamespace, secretName)
+	if err != nil {
+		return err
+	}
+	if permitted {
+		return nil
+	}
+
+	var grants v1alpha1.CredentialGrantList
+	if err := c.List(ctx, &grants, client.InNamespace(secretNamespace)); err != nil {
+		return fmt.Errorf("failed to list CredentialGrants in %s: %w", secretNamespace, err)
+	}
+
+	for i := range grants.Items {
+		if grants.Items[i].Permits(kind, fromNamespace, secretName) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: no CredentialGrant in namespace %s allows %s from namespace %s to reference Secret %s",
+		ErrReferenceNotPermitted, secretNamespace, kind, fromNamespace, secretName)
+}
+
+// claimPermits reports whether from is the Database or User created for a
+// DatabaseClaim whose class references the Secret.
+func claimPermits(
+	ctx context.Context,
+	c client.Reader,
+	kind string,
+	from client.Object,
+	secretNamespace string,
+	secretName string,
+) (bool, error) {
+	class, claim, err := claimClassOf(ctx, c, kind, from)
+	if err != nil || class == nil || class.Spec.AdminSecretRef == nil {
+		return false, err
+	}
+
+	ref := class.Spec.AdminSecretRef
+	refNamespace := ref.Namespace
+	if refNamespace == "" {
+		refNamespace = claim.Namespace
+	}
+	return ref.Name == secretName && refNamespace == secretNamespace, nil
+}
+
+// claimClassOf returns the class and claim from was created for, or nil if
+// from is not the Database or User of a DatabaseClaim. The claim status
+// records the UID of the objects the operator created, so objects merely
+// claiming to be controlled by a claim are not trusted. Classes that do not
+// allow the claim's namespace are not returned either.
+func claimClassOf(
+	ctx context.Context,
+	c client.Reader,
+	kind string,
+	from client.Object,
+) (*v1alpha1.DatabaseClass, *v1alpha1.DatabaseClaim, error) {
+	owner := metav1.GetControllerOf(from)
+	if owner == nil || owner.Kind != "DatabaseClaim" || owner.APIVersion != v1alpha1.SchemeGroupVersion.String() {
+		return nil, nil, nil
+	}
+
+	var claim v1alpha1.DatabaseClaim
+	if err := c.Get(ctx, types.NamespacedName{Name: owner.Name, Namespace: from.GetNamespace()}, &claim); err != nil {
+		return nil, nil, client.IgnoreNotFound(err)
+	}
+	if claim.UID != owner.UID {
+		return nil, nil, nil
+	}
+
+	claimed := claim.Status.Database
+	if kind == "User" {
+		claimed = claim.Status.User
+	}
+	if claimed == nil || claimed.Name != from.GetName() || claimed.UID != from.GetUID() {
+		return nil, nil, nil
+	}
+
+	var class v1alpha1.DatabaseClass
+	if err := c.Get(ctx, types.NamespacedName{Name: claim.Status.ClassName}, &class); err != nil {
+		return nil, nil, client.IgnoreNotFound(err)
+	}
+	if !class.AllowsNamespace(claim.Namespace) {
+		return nil, nil, nil
+	}
+	return &class, &claim, nil
+}
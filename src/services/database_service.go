@@ -2,55 +2,224 @@ package services
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
 	"github.com/mertsaygi/orchestrdb/src/db"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // DatabaseService wraps the DB adapter and contains business logic for
 // reconciling Database resources.
 type DatabaseService struct {
-	adapter db.Adapter
+	k8sClient client.Client
+	adapter   db.Adapter
+	hardening v1alpha1.HardeningProfile
 }
 
 // NewDatabaseService creates a new DatabaseService with the given adapter.
-func NewDatabaseService(adapter db.Adapter) *DatabaseService {
+// hardening is the operator-wide profile used when spec.hardening does not
+// set one.
+func NewDatabaseService(k8sClient client.Client, adapter db.Adapter, hardening v1alpha1.HardeningProfile) *DatabaseService {
 	return &DatabaseService{
-		adapter: adapter,
+		k8sClient: k8sClient,
+		adapter:   adapter,
+		hardening: hardening,
 	}
 }
 
 // EnsureDatabase ensures that the database described by dbRes exists on the
-// target server. adminUser/adminPassword are resolved before calling this
-// method (from inline spec or from a Secret).
+// target server and that its spec.initSQL scripts ran. adminUser/adminPassword
+// are resolved before calling this method (from inline spec or from a Secret).
+// The returned error carries the adapter error category (see db.CategoryOf).
 func (s *DatabaseService) EnsureDatabase(
 	ctx context.Context,
 	dbRes *v1alpha1.Database,
 	adminUser string,
 	adminPassword string,
-) (bool, string) {
-	// For now we hardcode SSLMode to "require". If needed, this can be
-	// made configurable via the CRD spec (e.g., dbRes.Spec.SSLMode).
-	params := db.CreateDatabaseParams{
-		Host:      dbRes.Spec.Host,
-		Port:      dbRes.Spec.Port,
-		AdminUser: adminUser,
-		Password:  adminPassword,
-		Name:      dbRes.Spec.Name,
-		SSLMode:   "require",
+) (bool, error) {
+	params, err := s.databaseParams(ctx, dbRes, adminUser, adminPassword)
+	if err == nil {
+		err = s.adapter.CreateDatabase(ctx, params)
 	}
-
-	err := s.adapter.CreateDatabase(ctx, params)
 	if err != nil {
+		if params.Template != "" {
+			// The next attempt copies the template again.
+			dbRes.Status.Source.Phase = v1alpha1.ClonePending
+			dbRes.Status.Source.Message = err.Error()
+		}
 		dbRes.Status.Created = false
 		dbRes.Status.LastError = err.Error()
 		dbRes.Status.UpdatedAt = time.Now().Format(time.RFC3339)
-		return false, err.Error()
+		setReadyCondition(&dbRes.Status.Conditions, dbRes.Generation, err)
+		return false, err
+	}
+
+	if params.Template != "" {
+		source := dbRes.Status.Source
+		now := metav1.Now()
+		source.Phase = v1alpha1.CloneCompleted
+		source.SnapshotTime = source.StartedAt.DeepCopy()
+		source.CompletedAt = &now
+		source.Message = "copied from template " + source.Database
 	}
 
 	dbRes.Status.Created = true
-	dbRes.Status.LastError = ""
 	dbRes.Status.UpdatedAt = time.Now().Format(time.RFC3339)
-	return true, ""
+
+	// The database exists even if its init scripts fail; they are retried
+	// on the next reconcile.
+	if err := s.ensureInitSQL(ctx, dbRes, params); err != nil {
+		dbRes.Status.LastError = err.Error()
+		setReadyCondition(&dbRes.Status.Conditions, dbRes.Generation, err)
+		return true, err
+	}
+
+	dbRes.Status.LastError = ""
+	setReadyCondition(&dbRes.Status.Conditions, dbRes.Generation, nil)
+	setHardenedCondition(&dbRes.Status.Conditions, dbRes.Generation, params.Hardening, nil)
+	return true, nil
+}
+
+// PlanDatabase returns the statements EnsureDatabase would execute, without
+// executing them or touching the status.
+func (s *DatabaseService) PlanDatabase(
+	ctx context.Context,
+	dbRes *v1alpha1.Database,
+	adminUser string,
+	adminPassword string,
+) ([]string, error) {
+	params, err := s.databaseParams(ctx, dbRes, adminUser, adminPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &db.Plan{}
+	if err := s.adapter.CreateDatabase(db.WithPlan(ctx, plan), params); err != nil {
+		return nil, err
+	}
+	return plan.Statements, nil
+}
+
+// DropDatabase drops the database of dbRes on deletion with deletionPolicy
+// Delete. A database the operator does not manage is a Conflict.
+func (s *DatabaseService) DropDatabase(
+	ctx context.Context,
+	dbRes *v1alpha1.Database,
+	adminUser string,
+	adminPassword string,
+) error {
+	params, err := s.databaseParams(ctx, dbRes, adminUser, adminPassword)
+	if err != nil {
+		return err
+	}
+	return s.adapter.DropDatabase(ctx, params)
+}
+
+// PlanDropDatabase returns the statements DropDatabase would execute.
+func (s *DatabaseService) PlanDropDatabase(
+	ctx context.Context,
+	dbRes *v1alpha1.Database,
+	adminUser string,
+	adminPassword string,
+) ([]string, error) {
+	plan := &db.Plan{}
+	if err := s.DropDatabase(db.WithPlan(ctx, plan), dbRes, adminUser, adminPassword); err != nil {
+		return nil, err
+	}
+	return plan.Statements, nil
+}
+
+// DetectDrift compares the server with dbRes and returns a description of
+// every difference found. An empty result means the server is in sync.
+func (s *DatabaseService) DetectDrift(
+	ctx context.Context,
+	dbRes *v1alpha1.Database,
+	adminUser string,
+	adminPassword string,
+) ([]string, error) {
+	params, err := s.databaseParams(ctx, dbRes, adminUser, adminPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := s.adapter.ObserveDatabase(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	if !state.Exists {
+		return []string{fmt.Sprintf("database %s does not exist", dbRes.Spec.Name)}, nil
+	}
+
+	var drift []string
+	for _, ext := range state.MissingExtensions {
+		drift = append(drift, fmt.Sprintf("extension %s is not installed", ext))
+	}
+	setHardenedCondition(&dbRes.Status.Conditions, dbRes.Generation, params.Hardening, state.HardeningViolations)
+	drift = append(drift, state.HardeningViolations...)
+	return drift, nil
+}
+
+// databaseParams builds the adapter parameters for dbRes, including TLS material.
+func (s *DatabaseService) databaseParams(
+	ctx context.Context,
+	dbRes *v1alpha1.Database,
+	adminUser string,
+	adminPassword string,
+) (db.CreateDatabaseParams, error) {
+	sslMode := dbRes.Spec.SSLMode
+	if sslMode == "" {
+		sslMode = "require"
+	}
+
+	host, port := dbRes.Server()
+	params := db.CreateDatabaseParams{
+		ConnectionParams: db.ConnectionParams{
+			Host:      host,
+			Port:      port,
+			AdminUser: adminUser,
+			Password:  adminPassword,
+			SSLMode:   sslMode,
+		},
+		Name:       dbRes.Spec.Name,
+		Owner:      "Database/" + dbRes.Namespace + "/" + dbRes.Name,
+		Adopt:      dbRes.Spec.Adoption != nil && dbRes.Spec.Adoption.Enabled,
+		Extensions: dbRes.Spec.Extensions,
+	}
+
+	if source := dbRes.Status.Source; source != nil && dbRes.Cloning() {
+		switch source.Method {
+		case v1alpha1.CloneMethodTemplate:
+			params.Template = source.Database
+		case v1alpha1.CloneMethodDump:
+			// The restore brings the extensions of the source; missing
+			// ones are created once the copy completed.
+			params.Extensions = nil
+		}
+	}
+
+	profile := s.hardening
+	owner := adminUser
+	if hardening := dbRes.Spec.Hardening; hardening != nil {
+		if hardening.Profile != "" {
+			profile = hardening.Profile
+		}
+		if hardening.Owner != "" {
+			owner = hardening.Owner
+		}
+	}
+	switch profile {
+	case "", v1alpha1.HardeningNone:
+	case v1alpha1.HardeningRestricted:
+		params.Hardening = &db.Hardening{Owner: owner}
+	default:
+		return params, invalidSpec("unknown hardening profile %q", profile)
+	}
+
+	err := LoadTLSMaterial(ctx, s.k8sClient, dbRes.Namespace,
+		dbRes.Spec.SSLRootCertSecretRef, dbRes.Spec.SSLClientCertSecretRef, &params.ConnectionParams)
+	return params, err
 }
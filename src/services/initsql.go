@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/db"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// loadInitSQL reads the scripts of spec.initSQL and returns them with their
+// checksum. A missing ConfigMap, Secret or key is InvalidSpec; the watches
+// on them requeue the Database.
+func (s *DatabaseService) loadInitSQL(ctx context.Context, dbRes *v1alpha1.Database) ([]db.SQLScript, string, error) {
+	h := sha256.New()
+	var scripts []db.SQLScript
+	for i, script := range dbRes.Spec.InitSQL.Scripts {
+		var name, sql string
+		switch {
+		case script.ConfigMapKeyRef != nil && script.SecretKeyRef == nil:
+			ref := script.ConfigMapKeyRef
+			var cm corev1.ConfigMap
+			err := s.k8sClient.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: dbRes.Namespace}, &cm)
+			if apierrors.IsNotFound(err) {
+				return nil, "", invalidSpec("initSQL ConfigMap %s not found", ref.Name)
+			}
+			if err != nil {
+				return nil, "", err
+			}
+			value, ok := cm.Data[ref.Key]
+			if !ok {
+				return nil, "", invalidSpec("initSQL ConfigMap %s has no key %s", ref.Name, ref.Key)
+			}
+			name, sql = fmt.Sprintf("ConfigMap %s/%s", ref.Name, ref.Key), value
+		case script.SecretKeyRef != nil && script.ConfigMapKeyRef == nil:
+			ref := script.SecretKeyRef
+			var secret corev1.Secret
+			err := s.k8sClient.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: dbRes.Namespace}, &secret)
+			if apierrors.IsNotFound(err) {
+				return nil, "", invalidSpec("initSQL Secret %s not found", ref.Name)
+			}
+			if err != nil {
+				return nil, "", err
+			}
+			value, ok := secret.Data[ref.Key]
+			if !ok {
+				return nil, "", invalidSpec("initSQL Secret %s has no key %s", ref.Name, ref.Key)
+			}
+			name, sql = fmt.Sprintf("Secret %s/%s", ref.Name, ref.Key), string(value)
+		default:
+			return nil, "", invalidSpec("initSQL script %d needs exactly one of configMapKeyRef and secretKeyRef", i)
+		}
+
+		fmt.Fprintf(h, "%s\x00%s\x00", name, sql)
+		scripts = append(scripts, db.SQLScript{Name: name, SQL: sql})
+	}
+	return scripts, "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// InitSQLPending reports whether the scripts of spec.initSQL have to run:
+// they never ran, or changed and rerunOnChange is set. Scripts that cannot
+// be read are pending, so that the next EnsureDatabase reports why.
+func (s *DatabaseService) InitSQLPending(ctx context.Context, dbRes *v1alpha1.Database) bool {
+	spec := dbRes.Spec.InitSQL
+	if spec == nil {
+		return false
+	}
+	if dbRes.Status.InitSQL == nil {
+		return true
+	}
+	if !spec.RerunOnChange {
+		return false
+	}
+	_, checksum, err := s.loadInitSQL(ctx, dbRes)
+	return err != nil || checksum != dbRes.Status.InitSQL.Checksum
+}
+
+// ensureInitSQL runs the scripts of spec.initSQL if they are pending and
+// records their checksum.
+func (s *DatabaseService) ensureInitSQL(ctx context.Context, dbRes *v1alpha1.Database, params db.CreateDatabaseParams) error {
+	spec := dbRes.Spec.InitSQL
+	if spec == nil {
+		return nil
+	}
+	applied := dbRes.Status.InitSQL
+	if applied != nil && !spec.RerunOnChange {
+		return nil
+	}
+
+	scripts, checksum, err := s.loadInitSQL(ctx, dbRes)
+	if err != nil {
+		return err
+	}
+	if applied != nil && applied.Checksum == checksum {
+		return nil
+	}
+	if err := s.adapter.RunScripts(ctx, params, scripts); err != nil {
+		return err
+	}
+
+	now := metav1.Now()
+	dbRes.Status.InitSQL = &v1alpha1.InitSQLStatus{Checksum: checksum, AppliedAt: &now}
+	return nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/db"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// JobRole is the short-lived role a clone, backup or restore Job connects
+// as, so that the admin credentials never leave the operator.
+type JobRole struct {
+	Name       string
+	Password   string
+	ValidUntil time.Time
+
+	// Write lets the role create objects; otherwise it can only read.
+	Write bool
+
+	// MemberOf are roles granted to the role.
+	MemberOf []string
+}
+
+// JobRoleName returns the name of the job role of owner, unique per owner
+// and suffix.
+func JobRoleName(owner metav1.Object, suffix string) string {
+	return "orchestrdb_job_" + strings.ReplaceAll(string(owner.GetUID()), "-", "") + suffix
+}
+
+// NewJobRole returns the role name with a fresh password, valid until
+// validUntil.
+func (s *DatabaseService) NewJobRole(name string, validUntil time.Time, write bool) (JobRole, error) {
+	password, err := generatePassword(v1alpha1.PasswordPolicy{}, s.adapter.PasswordRules())
+	if err != nil {
+		return JobRole{}, err
+	}
+	return JobRole{Name: name, Password: password, ValidUntil: validUntil, Write: write}, nil
+}
+
+// ensureJobRole creates role on the server of dbRes with access to its
+// database and returns the connection parameters of the Job logging in as
+// it.
+func (s *DatabaseService) ensureJobRole(
+	ctx context.Context,
+	dbRes *v1alpha1.Database,
+	adminUser string,
+	adminPassword string,
+	role JobRole,
+) (db.CreateDatabaseParams, error) {
+	params, err := s.databaseParams(ctx, dbRes, adminUser, adminPassword)
+	if err != nil {
+		return db.CreateDatabaseParams{}, err
+	}
+	err = s.adapter.EnsureJobRole(ctx, db.JobRoleParams{
+		ConnectionParams: params.ConnectionParams,
+		DBName:           params.Name,
+		Role:             role.Name,
+		Password:         role.Password,
+		ValidUntil:       role.ValidUntil,
+		Write:            role.Write,
+		MemberOf:         role.MemberOf,
+	})
+	if err != nil {
+		return db.CreateDatabaseParams{}, err
+	}
+
+	params.AdminUser = role.Name
+	params.Password = role.Password
+	// The Job authenticates with the role's password only.
+	params.SSLClientCert = nil
+	params.SSLClientKey = nil
+	return params, nil
+}
+
+// DropJobRole drops the job role name from the server of dbRes once its
+// Job finished. Objects it created are handed to the admin user.
+func (s *DatabaseService) DropJobRole(
+	ctx context.Context,
+	dbRes *v1alpha1.Database,
+	adminUser string,
+	adminPassword string,
+	name string,
+) error {
+	params, err := s.databaseParams(ctx, dbRes, adminUser, adminPassword)
+	if err != nil {
+		return err
+	}
+	return s.adapter.DropJobRole(ctx, db.JobRoleParams{
+		ConnectionParams: params.ConnectionParams,
+		DBName:           params.Name,
+		Role:             name,
+	})
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/db"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// ErrMigrationNotReady is returned while the source ConfigMap or Secret of
+// a Migration does not exist.
+var ErrMigrationNotReady = errors.New("migration source is not ready")
+
+// MigrationFetchContainer prints the files of an image source as a
+// base64-encoded tar.gz archive on its output.
+const MigrationFetchContainer = "fetch"
+
+// DefaultMigrationImagePath is the directory of an image source used when
+// its path is empty.
+const DefaultMigrationImagePath = "/migrations"
+
+// migrationFilePattern matches migration file names: <version>_<name>.sql.
+var migrationFilePattern = regexp.MustCompile(`^([0-9]+)_.*\.sql$`)
+
+// trackingTablePattern matches an optionally schema-qualified table name.
+var trackingTablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// ValidateMigrationSpec checks the parts of spec that are not validated by
+// the CRD schema.
+func ValidateMigrationSpec(spec *v1alpha1.MigrationSpec) error {
+	source := spec.Source
+	var set int
+	for _, ok := range []bool{source.ConfigMap != nil, source.Secret != nil, source.Archive != nil, source.Image != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return invalidSpec("exactly one of source.configMap, source.secret, source.archive and source.image is required")
+	}
+	if spec.TrackingTable != "" && !trackingTablePattern.MatchString(spec.TrackingTable) {
+		return invalidSpec("invalid trackingTable %q: expected <table> or <schema>.<table>", spec.TrackingTable)
+	}
+	return nil
+}
+
+// LoadMigrationFiles reads the files of a ConfigMap, Secret or archive
+// source, by file name. Image sources are read by MigrationFetchJob.
+func (s *DatabaseService) LoadMigrationFiles(ctx context.Context, m *v1alpha1.Migration) (map[string][]byte, error) {
+	source := m.Spec.Source
+	switch {
+	case source.ConfigMap != nil || source.Archive != nil:
+		name := ""
+		if source.ConfigMap != nil {
+			name = source.ConfigMap.Name
+		} else {
+			name = source.Archive.Name
+		}
+		var cm corev1.ConfigMap
+		err := s.k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: m.Namespace}, &cm)
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: ConfigMap %s not found", ErrMigrationNotReady, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if source.Archive != nil {
+			data, ok := cm.BinaryData[source.Archive.Key]
+			if !ok {
+				text, ok := cm.Data[source.Archive.Key]
+				if !ok {
+					return nil, invalidSpec("ConfigMap %s has no key %s", name, source.Archive.Key)
+				}
+				data = []byte(text)
+			}
+			return ReadMigrationArchive(data)
+		}
+		files := make(map[string][]byte, len(cm.Data)+len(cm.BinaryData))
+		for key, value := range cm.Data {
+			files[key] = []byte(value)
+		}
+		for key, value := range cm.BinaryData {
+			files[key] = value
+		}
+		return files, nil
+	case source.Secret != nil:
+		name := source.Secret.Name
+		var secret corev1.Secret
+		err := s.k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: m.Namespace}, &secret)
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: Secret %s not found", ErrMigrationNotReady, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return secret.Data, nil
+	}
+	return nil, invalidSpec("source has no files to load")
+}
+
+// ReadMigrationArchive returns the regular files of a tar archive,
+// optionally gzipped, by base name.
+func ReadMigrationArchive(data []byte) (map[string][]byte, error) {
+	br := bufio.NewReader(bytes.NewReader(data))
+	var r io.Reader = br
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, invalidSpec("invalid migration archive: %v", err)
+		}
+		r = gz
+	}
+
+	files := map[string][]byte{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, invalidSpec("invalid migration archive: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := path.Base(hdr.Name)
+		if _, ok := files[name]; ok {
+			return nil, invalidSpec("migration archive contains %s twice", name)
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, invalidSpec("invalid migration archive: %v", err)
+		}
+		files[name] = content
+	}
+}
+
+// DecodeMigrationFetchOutput returns the files printed by the fetch
+// container of MigrationFetchJob.
+func DecodeMigrationFetchOutput(output []byte) (map[string][]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(output)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid output of the fetch Job: %w", err)
+	}
+	return ReadMigrationArchive(data)
+}
+
+// ParseMigrations returns the migrations among files, ordered by version.
+// Files not ending in .sql are ignored.
+func ParseMigrations(files map[string][]byte) ([]db.Migration, error) {
+	var migrations []db.Migration
+	seen := map[int64]string{}
+	for name, content := range files {
+		if !strings.HasSuffix(name, ".sql") {
+			continue
+		}
+		match := migrationFilePattern.FindStringSubmatch(name)
+		if match == nil {
+			return nil, invalidSpec("invalid migration file name %s: expected <version>_<name>.sql", name)
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version == 0 {
+			return nil, invalidSpec("invalid version of migration %s", name)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, invalidSpec("migrations %s and %s have the same version", other, name)
+		}
+		seen[version] = name
+
+		sum := sha256.Sum256(content)
+		migrations = append(migrations, db.Migration{
+			Version:  version,
+			Name:     name,
+			SQL:      string(content),
+			Checksum: "sha256:" + hex.EncodeToString(sum[:]),
+		})
+	}
+	if len(migrations) == 0 {
+		return nil, invalidSpec("source contains no migration files")
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// MigrationsChecksum identifies a set of migrations.
+func MigrationsChecksum(migrations []db.Migration) string {
+	h := sha256.New()
+	for _, m := range migrations {
+		fmt.Fprintf(h, "%d %s %s\n", m.Version, m.Name, m.Checksum)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// ApplyMigrations applies migrations to the database of dbRes as role.
+func (s *DatabaseService) ApplyMigrations(
+	ctx context.Context,
+	dbRes *v1alpha1.Database,
+	adminUser string,
+	adminPassword string,
+	role string,
+	table string,
+	migrations []db.Migration,
+) (db.MigrateResult, error) {
+	params, err := s.databaseParams(ctx, dbRes, adminUser, adminPassword)
+	if err != nil {
+		return db.MigrateResult{}, err
+	}
+	return s.adapter.ApplyMigrations(ctx, db.MigrateParams{
+		CreateDatabaseParams: params,
+		Role:                 role,
+		Table:                table,
+		Migrations:           migrations,
+	})
+}
+
+// MigrationFetchJob returns the Job copying the files of the image source
+// of m. An init container of the source image copies its directory to a
+// scratch volume, and the fetch container prints it as a base64-encoded
+// tar.gz archive, read back from its log.
+func MigrationFetchJob(m *v1alpha1.Migration, name, pgToolsImage string) *batchv1.Job {
+	source := m.Spec.Source.Image
+	dir := source.Path
+	if dir == "" {
+		dir = DefaultMigrationImagePath
+	}
+
+	job := dumpJob("Migration", m, name, "")
+	spec := &job.Spec.Template.Spec
+	spec.InitContainers = []corev1.Container{{
+		Name:                     "copy",
+		Image:                    source.Image,
+		Command:                  []string{"sh", "-c", `cp -R "$MIGRATIONS_PATH"/. /migrations/`},
+		Env:                      []corev1.EnvVar{{Name: "MIGRATIONS_PATH", Value: dir}},
+		VolumeMounts:             []corev1.VolumeMount{{Name: "data", MountPath: "/migrations"}},
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+	}}
+	spec.Containers = []corev1.Container{{
+		Name:                     MigrationFetchContainer,
+		Image:                    pgToolsImage,
+		Command:                  []string{"bash", "-euo", "pipefail", "-c", "tar -czf - -C /migrations . | base64 -w0"},
+		VolumeMounts:             []corev1.VolumeMount{{Name: "data", MountPath: "/migrations", ReadOnly: true}},
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+	}}
+	spec.Volumes = []corev1.Volume{{
+		Name:         "data",
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	}}
+	return job
+}
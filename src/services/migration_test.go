@@ -0,0 +1,206 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/mertsaygi/orchestrdb/src/db"
+)
+
+func TestParseMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    []int64 // versions in order
+		wantErr bool
+	}{
+		{
+			name: "ordered by version, not by name",
+			files: map[string]string{
+				"10_add_index.sql":    "CREATE INDEX ...",
+				"2_add_table.sql":     "CREATE TABLE ...",
+				"001_init.sql":        "CREATE SCHEMA app",
+				"README.md":           "ignored",
+				"20_data.sql.bak":     "ignored",
+				"checksums.txt":       "ignored",
+				"0003_backfill_.sql":  "UPDATE ...",
+				"4_with spaces.sql":   "SELECT 1",
+				"0000000005_long.sql": "SELECT 1",
+			},
+			want: []int64{1, 2, 3, 4, 5, 10},
+		},
+		{name: "no migrations", files: map[string]string{"README.md": "x"}, wantErr: true},
+		{name: "empty source", files: map[string]string{}, wantErr: true},
+		{name: "missing version", files: map[string]string{"init.sql": "x"}, wantErr: true},
+		{name: "missing underscore", files: map[string]string{"1init.sql": "x"}, wantErr: true},
+		{name: "version zero", files: map[string]string{"0_init.sql": "x"}, wantErr: true},
+		{name: "version overflows", files: map[string]string{"99999999999999999999_init.sql": "x"}, wantErr: true},
+		{name: "duplicate version", files: map[string]string{"1_a.sql": "x", "01_b.sql": "y"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string][]byte{}
+			for name, content := range tt.files {
+				files[name] = []byte(content)
+			}
+			migrations, err := ParseMigrations(files)
+			if tt.wantErr {
+				if db.CategoryOf(err) != db.CategoryInvalidSpec {
+					t.Fatalf("ParseMigrations() error = %v, want an InvalidSpec error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var versions []int64
+			for _, m := range migrations {
+				versions = append(versions, m.Version)
+				if m.SQL != tt.files[m.Name] {
+					t.Errorf("migration %s has SQL %q, want %q", m.Name, m.SQL, tt.files[m.Name])
+				}
+			}
+			if !reflect.DeepEqual(versions, tt.want) {
+				t.Errorf("versions = %v, want %v", versions, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMigrationsChecksum(t *testing.T) {
+	parse := func(sql string) db.Migration {
+		t.Helper()
+		migrations, err := ParseMigrations(map[string][]byte{"1_init.sql": []byte(sql)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return migrations[0]
+	}
+
+	// sha256 of the empty string.
+	if got, want := parse("").Checksum, "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"; got != want {
+		t.Errorf("checksum = %s, want %s", got, want)
+	}
+	if parse("SELECT 1").Checksum == parse("SELECT 2").Checksum {
+		t.Error("different SQL has the same checksum")
+	}
+
+	a := []db.Migration{parse("SELECT 1")}
+	b := []db.Migration{parse("SELECT 2")}
+	if MigrationsChecksum(a) == MigrationsChecksum(b) {
+		t.Error("different migrations have the same set checksum")
+	}
+}
+
+// tarEntry is a file or directory of a test archive.
+type tarEntry struct {
+	name    string
+	content string
+	dir     bool
+}
+
+func buildArchive(t *testing.T, entries []tarEntry, gzipped bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var gz *gzip.Writer
+	if gzipped {
+		gz = gzip.NewWriter(&buf)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.content)), Typeflag: tar.TypeReg}
+		if e.dir {
+			hdr = &tar.Header{Name: e.name, Mode: 0o755, Typeflag: tar.TypeDir}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestReadMigrationArchive(t *testing.T) {
+	entries := []tarEntry{
+		{name: "./", dir: true},
+		{name: "./migrations/", dir: true},
+		{name: "./migrations/1_init.sql", content: "CREATE SCHEMA app"},
+		{name: "2_table.sql", content: "CREATE TABLE app.t ()"},
+	}
+	want := map[string][]byte{
+		"1_init.sql":  []byte("CREATE SCHEMA app"),
+		"2_table.sql": []byte("CREATE TABLE app.t ()"),
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    map[string][]byte
+		wantErr bool
+	}{
+		{name: "tar", data: buildArchive(t, entries, false), want: want},
+		{name: "tar.gz", data: buildArchive(t, entries, true), want: want},
+		{name: "empty tar", data: buildArchive(t, nil, false), want: map[string][]byte{}},
+		{
+			name: "same base name twice",
+			data: buildArchive(t, []tarEntry{
+				{name: "a/1_init.sql", content: "x"},
+				{name: "b/1_init.sql", content: "y"},
+			}, false),
+			wantErr: true,
+		},
+		{name: "corrupt gzip", data: []byte{0x1f, 0x8b, 0x00, 0x01}, wantErr: true},
+		{name: "not an archive", data: bytes.Repeat([]byte("x"), 1024), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadMigrationArchive(tt.data)
+			if tt.wantErr {
+				if db.CategoryOf(err) != db.CategoryInvalidSpec {
+					t.Fatalf("ReadMigrationArchive() error = %v, want an InvalidSpec error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadMigrationArchive() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeMigrationFetchOutput(t *testing.T) {
+	archive := buildArchive(t, []tarEntry{{name: "1_init.sql", content: "SELECT 1"}}, true)
+	output := []byte(base64.StdEncoding.EncodeToString(archive) + "\n")
+
+	files, err := DecodeMigrationFetchOutput(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(files["1_init.sql"]) != "SELECT 1" {
+		t.Errorf("files = %q", files)
+	}
+
+	if _, err := DecodeMigrationFetchOutput([]byte("not base64!")); err == nil {
+		t.Error("invalid output accepted")
+	}
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/db"
+)
+
+const (
+	defaultPasswordLength  = 32
+	defaultPasswordSymbols = "!@#$%^&*()-_=+"
+	urlSafePasswordSymbols = "-._~"
+)
+
+var passwordClassAlphabets = map[string]string{
+	v1alpha1.PasswordClassLowercase: "abcdefghijklmnopqrstuvwxyz",
+	v1alpha1.PasswordClassUppercase: "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	v1alpha1.PasswordClassDigits:    "0123456789",
+}
+
+// MergePasswordPolicy returns base with the fields set in override applied.
+func MergePasswordPolicy(base v1alpha1.PasswordPolicy, override *v1alpha1.PasswordPolicy) v1alpha1.PasswordPolicy {
+	merged := *base.DeepCopy()
+	if override == nil {
+		return merged
+	}
+	if override.Length != 0 {
+		merged.Length = override.Length
+	}
+	if len(override.CharacterClasses) > 0 {
+		merged.CharacterClasses = append([]string(nil), override.CharacterClasses...)
+	}
+	if override.Symbols != "" {
+		merged.Symbols = override.Symbols
+	}
+	if override.ExcludeCharacters != "" {
+		merged.ExcludeCharacters = override.ExcludeCharacters
+	}
+	if override.URLSafe != nil {
+		urlSafe := *override.URLSafe
+		merged.URLSafe = &urlSafe
+	}
+	return merged
+}
+
+// passwordAlphabets resolves the defaults of policy and returns its length
+// and the alphabet of every selected class, with excluded and forbidden
+// characters removed. It fails if policy cannot satisfy rules.
+func passwordAlphabets(policy v1alpha1.PasswordPolicy, rules db.PasswordRules) (int, []string, error) {
+	length := policy.Length
+	if length == 0 {
+		length = defaultPasswordLength
+		if rules.MaxLength > 0 && length > rules.MaxLength {
+			length = rules.MaxLength
+		}
+	}
+	if rules.MinLength > 0 && length < rules.MinLength {
+		return 0, nil, invalidSpec("password length %d is below the server minimum of %d", length, rules.MinLength)
+	}
+	if rules.MaxLength > 0 && length > rules.MaxLength {
+		return 0, nil, invalidSpec("password length %d exceeds the server maximum of %d", length, rules.MaxLength)
+	}
+
+	classes := policy.CharacterClasses
+	if len(classes) == 0 {
+		classes = []string{
+			v1alpha1.PasswordClassLowercase,
+			v1alpha1.PasswordClassUppercase,
+			v1alpha1.PasswordClassDigits,
+			v1alpha1.PasswordClassSymbols,
+		}
+	}
+
+	symbols := policy.Symbols
+	urlSafe := policy.URLSafe != nil && *policy.URLSafe
+	switch {
+	case symbols == "" && urlSafe:
+		symbols = urlSafePasswordSymbols
+	case symbols == "":
+		symbols = defaultPasswordSymbols
+	case urlSafe:
+		symbols = keepCharacters(symbols, urlSafePasswordSymbols)
+	}
+	for _, r := range symbols {
+		if r < '!' || r > '~' {
+			return 0, nil, invalidSpec("password symbols must be printable ASCII, got %q", r)
+		}
+	}
+
+	exclude := policy.ExcludeCharacters + rules.Forbidden
+	seen := map[string]bool{}
+	alphabets := make([]string, 0, len(classes))
+	for _, class := range classes {
+		if seen[class] {
+			continue
+		}
+		seen[class] = true
+
+		alphabet, ok := passwordClassAlphabets[class]
+		if class == v1alpha1.PasswordClassSymbols {
+			alphabet, ok = symbols, true
+		}
+		if !ok {
+			return 0, nil, invalidSpec("unknown password character class %q", class)
+		}
+
+		alphabet = removeCharacters(alphabet, exclude)
+		if alphabet == "" {
+			return 0, nil, invalidSpec("password character class %q is empty after exclusions", class)
+		}
+		alphabets = append(alphabets, alphabet)
+	}
+
+	if len(alphabets) < rules.MinClasses {
+		return 0, nil, invalidSpec("password policy uses %d character classes, the server requires %d", len(alphabets), rules.MinClasses)
+	}
+	if length < len(alphabets) {
+		return 0, nil, invalidSpec("password length %d is too short for %d character classes", length, len(alphabets))
+	}
+
+	return length, alphabets, nil
+}
+
+// invalidSpec returns an InvalidSpec error, so the reconcile waits for a
+// spec change instead of retrying.
+func invalidSpec(format string, args ...interface{}) error {
+	return &db.Error{Category: db.CategoryInvalidSpec, Err: fmt.Errorf(format, args...)}
+}
+
+// ValidatePasswordPolicy reports whether policy can generate passwords the
+// server accepts.
+func ValidatePasswordPolicy(policy v1alpha1.PasswordPolicy, rules db.PasswordRules) error {
+	_, _, err := passwordAlphabets(policy, rules)
+	return err
+}
+
+// generatePassword draws a password from policy: one character of every
+// class, the rest from all classes, then shuffled. Every draw is uniform
+// (no modulo bias).
+func generatePassword(policy v1alpha1.PasswordPolicy, rules db.PasswordRules) (string, error) {
+	length, alphabets, err := passwordAlphabets(policy, rules)
+	if err != nil {
+		return "", err
+	}
+	all := strings.Join(alphabets, "")
+
+	out := make([]byte, 0, length)
+	for _, alphabet := range alphabets {
+		c, err := randomCharacter(alphabet)
+		if err != nil {
+			return "", err
+		}
+		out = append(out, c)
+	}
+	for len(out) < length {
+		c, err := randomCharacter(all)
+		if err != nil {
+			return "", err
+		}
+		out = append(out, c)
+	}
+
+	// Fisher-Yates so the guaranteed characters are not always in front
+	for i := len(out) - 1; i > 0; i-- {
+		j, err := randomIndex(i + 1)
+		if err != nil {
+			return "", err
+		}
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out), nil
+}
+
+func randomCharacter(alphabet string) (byte, error) {
+	i, err := randomIndex(len(alphabet))
+	if err != nil {
+		return 0, err
+	}
+	return alphabet[i], nil
+}
+
+// randomIndex returns a uniform random integer in [0, n).
+func randomIndex(n int) (int, error) {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, err
+	}
+	return int(i.Int64()), nil
+}
+
+func removeCharacters(s, chars string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(chars, r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func keepCharacters(s, chars string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(chars, r) {
+			return r
+		}
+		return -1
+	}, s)
+}
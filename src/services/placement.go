@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/db"
+)
+
+// candidate is a pool server together with its observed load.
+type candidate struct {
+	server v1alpha1.PoolServer
+	state  *db.ServerState
+}
+
+// PlaceDatabase picks the server of dbRes from spec.placement. A server of
+// the pool that already hosts the database is always chosen, so a lost
+// status never leads to a second copy. Unreachable servers are skipped; it
+// fails only if no server could be observed. On failure the status is
+// updated like EnsureDatabase does.
+func (s *DatabaseService) PlaceDatabase(
+	ctx context.Context,
+	dbRes *v1alpha1.Database,
+	adminUser string,
+	adminPassword string,
+) (*v1alpha1.ServerRef, error) {
+	server, err := s.placeDatabase(ctx, dbRes, adminUser, adminPassword)
+	if err != nil {
+		dbRes.Status.Created = false
+		dbRes.Status.LastError = err.Error()
+		dbRes.Status.UpdatedAt = time.Now().Format(time.RFC3339)
+		setReadyCondition(&dbRes.Status.Conditions, dbRes.Generation, err)
+		return nil, err
+	}
+	return server, nil
+}
+
+func (s *DatabaseService) placeDatabase(
+	ctx context.Context,
+	dbRes *v1alpha1.Database,
+	adminUser string,
+	adminPassword string,
+) (*v1alpha1.ServerRef, error) {
+	placement := dbRes.Spec.Placement
+	strategy := placement.Strategy
+	if strategy == "" {
+		strategy = v1alpha1.PlacementLeastDatabases
+	}
+	if strategy == v1alpha1.PlacementLabelAffinity && len(placement.ServerSelector) == 0 {
+		return nil, invalidSpec("placement strategy %s requires serverSelector", strategy)
+	}
+
+	var servers []v1alpha1.PoolServer
+	for _, server := range placement.Servers {
+		if server.Matches(placement.ServerSelector) {
+			servers = append(servers, server)
+		}
+	}
+	if len(servers) == 0 {
+		return nil, invalidSpec("no server of the placement pool matches serverSelector")
+	}
+
+	params, err := s.databaseParams(ctx, dbRes, adminUser, adminPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []candidate
+	var errs []error
+	for _, server := range servers {
+		params.Host, params.Port = server.Host, server.Port
+		state, err := s.adapter.ObserveServer(ctx, params)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s:%d: %w", server.Host, server.Port, err))
+			continue
+		}
+		if state.HasDatabase {
+			return serverRef(server), nil
+		}
+		candidates = append(candidates, candidate{server: server, state: state})
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no server of the placement pool is reachable: %w", errors.Join(errs...))
+	}
+
+	switch strategy {
+	case v1alpha1.PlacementLeastDatabases:
+		return serverRef(leastBy(candidates, func(c candidate) int64 { return int64(c.state.Databases) })), nil
+	case v1alpha1.PlacementLeastSize:
+		return serverRef(leastBy(candidates, func(c candidate) int64 { return c.state.SizeBytes })), nil
+	case v1alpha1.PlacementLabelAffinity:
+		return serverRef(candidates[0].server), nil
+	case v1alpha1.PlacementRoundRobin:
+		placed, err := s.countPlaced(ctx, servers)
+		if err != nil {
+			return nil, err
+		}
+		return serverRef(candidates[placed%len(candidates)].server), nil
+	default:
+		return nil, invalidSpec("unknown placement strategy %s", strategy)
+	}
+}
+
+// countPlaced returns how many Databases are pinned to one of servers; it
+// is the round-robin position, so no counter has to be stored.
+func (s *DatabaseService) countPlaced(ctx context.Context, servers []v1alpha1.PoolServer) (int, error) {
+	var list v1alpha1.DatabaseList
+	if err := s.k8sClient.List(ctx, &list); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, item := range list.Items {
+		pinned := item.Status.Server
+		if pinned == nil {
+			continue
+		}
+		for _, server := range servers {
+			if server.Host == pinned.Host && server.Port == pinned.Port {
+				n++
+				break
+			}
+		}
+	}
+	return n, nil
+}
+
+// leastBy returns the first candidate with the smallest key.
+func leastBy(candidates []candidate, key func(candidate) int64) v1alpha1.PoolServer {
+	best := candidates[0]
+	for _, c := range candidates[1:] {
+		if key(c) < key(best) {
+			best = c
+		}
+	}
+	return best.server
+}
+
+func serverRef(server v1alpha1.PoolServer) *v1alpha1.ServerRef {
+	return &v1alpha1.ServerRef{Host: server.Host, Port: server.Port}
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ErrRestoreNotReady is returned while the Backup or the owner User of a
+// Restore does not exist or the Backup has not completed yet.
+var ErrRestoreNotReady = errors.New("restore is not ready")
+
+// restoreScript runs pg_restore of $BACKUP_TARGET into $DSN in a single
+// transaction, so a failure leaves the database as it was.
+const restoreScript = `schemas=()
+while IFS= read -r schema; do
+  if [ -n "$schema" ]; then schemas+=(--schema="$schema"); fi
+done <<< "$RESTORE_SCHEMAS"
+pg_restore --exit-on-error --single-transaction $RESTORE_FLAGS "${schemas[@]}" --dbname="$DSN" "$BACKUP_TARGET"
+`
+
+// RestoreDump is the dump a Restore reads.
+type RestoreDump struct {
+	// Location is pvc://<claim>/<path> or s3://<bucket>/<key>.
+	Location string
+
+	Format v1alpha1.BackupFormat
+
+	// S3 holds the endpoint and credentials of s3:// locations.
+	S3 *v1alpha1.S3Destination
+}
+
+// ResolveRestoreDump returns the dump named by spec.backupRef or spec.source
+// of restore.
+func (s *DatabaseService) ResolveRestoreDump(ctx context.Context, restore *v1alpha1.Restore) (*RestoreDump, error) {
+	spec := restore.Spec
+
+	var dump RestoreDump
+	switch {
+	case spec.BackupRef != nil && spec.Source != nil:
+		return nil, invalidSpec("only one of backupRef and source may be set")
+	case spec.BackupRef != nil:
+		name := spec.BackupRef.Name
+		var backup v1alpha1.Backup
+		err := s.k8sClient.Get(ctx, types.NamespacedName{Name: name, Namespace: restore.Namespace}, &backup)
+		if apierrors.IsNotFound(err) {
+			return nil, fmt.Errorf("%w: Backup %s not found", ErrRestoreNotReady, name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch backup.Status.Phase {
+		case v1alpha1.BackupCompleted:
+		case v1alpha1.BackupFailed:
+			return nil, invalidSpec("Backup %s failed", name)
+		default:
+			return nil, fmt.Errorf("%w: Backup %s has not completed yet", ErrRestoreNotReady, name)
+		}
+		dump = RestoreDump{
+			Location: backup.Status.Location,
+			Format:   backup.Spec.Format,
+			S3:       backup.Spec.Destination.S3,
+		}
+	case spec.Source != nil:
+		source := spec.Source
+		dump = RestoreDump{Location: source.URL, Format: source.Format}
+		if strings.HasPrefix(source.URL, "s3://") {
+			if source.CredentialsSecretRef == nil {
+				return nil, invalidSpec("source.credentialsSecretRef is required for s3:// URLs")
+			}
+			dump.S3 = &v1alpha1.S3Destination{
+				Endpoint:             source.Endpoint,
+				Region:               source.Region,
+				ForcePathStyle:       source.ForcePathStyle,
+				CredentialsSecretRef: *source.CredentialsSecretRef,
+			}
+		}
+	default:
+		return nil, invalidSpec("one of backupRef and source is required")
+	}
+
+	switch dump.Format {
+	case "":
+		dump.Format = v1alpha1.BackupFormatCustom
+	case v1alpha1.BackupFormatCustom, v1alpha1.BackupFormatDirectory:
+	case v1alpha1.BackupFormatPlain:
+		return nil, invalidSpec("plain dumps cannot be restored with pg_restore; run them with psql")
+	default:
+		return nil, invalidSpec("unknown dump format %s", dump.Format)
+	}
+	if _, err := parseDumpURL(dump.Location); err != nil {
+		return nil, err
+	}
+	return &dump, nil
+}
+
+// parseDumpURL parses a pvc:// or s3:// location. The claim or bucket is
+// the host of the URL.
+func parseDumpURL(location string) (*url.URL, error) {
+	u, err := url.Parse(location)
+	if err != nil || (u.Scheme != "pvc" && u.Scheme != "s3") || u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return nil, invalidSpec("invalid dump location %q: expected pvc://<claim>/<path> or s3://<bucket>/<key>", location)
+	}
+	return u, nil
+}
+
+// ResolveRestoreOwner returns the role receiving the restored objects: the
+// role of spec.ownerRef, or else of the only User with owner access to the
+// target database. It is empty when there is no such User.
+func (s *DatabaseService) ResolveRestoreOwner(ctx context.Context, restore *v1alpha1.Restore, dbRes *v1alpha1.Database) (string, error) {
+	if ref := restore.Spec.OwnerRef; ref != nil {
+		var user v1alpha1.User
+		err := s.k8sClient.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: restore.Namespace}, &user)
+		if apierrors.IsNotFound(err) {
+			return "", fmt.Errorf("%w: User %s not found", ErrRestoreNotReady, ref.Name)
+		}
+		if err != nil {
+			return "", err
+		}
+		return user.Spec.Username, nil
+	}
+
+	var users v1alpha1.UserList
+	if err := s.k8sClient.List(ctx, &users, client.InNamespace(restore.Namespace)); err != nil {
+		return "", err
+	}
+	var owners []string
+	for _, user := range users.Items {
+		for _, a := range user.Spec.Access {
+			if strings.EqualFold(a.Role, "owner") && a.DBName == dbRes.Spec.Name &&
+				(a.Scope == "" || strings.EqualFold(a.Scope, "database")) {
+				owners = append(owners, user.Spec.Username)
+				break
+			}
+		}
+	}
+	if len(owners) != 1 {
+		return "", nil
+	}
+	return owners[0], nil
+}
+
+// TransferOwnership hands the objects the admin user owns in the database
+// of dbRes over to owner.
+func (s *DatabaseService) TransferOwnership(
+	ctx context.Context,
+	dbRes *v1alpha1.Database,
+	adminUser string,
+	adminPassword string,
+	owner string,
+) error {
+	params, err := s.databaseParams(ctx, dbRes, adminUser, adminPassword)
+	if err != nil {
+		return err
+	}
+	return s.adapter.TransferOwnership(ctx, params, owner)
+}
+
+// RestoreJob returns the Job running pg_restore of dump, reading the
+// connection string of the target from the Secret of the same name. A dump
+// in S3 is downloaded to a scratch volume by an init container first. The
+// end of the pg_restore output becomes the termination message on failure.
+// The Job is stopped after deadline, when its role expires.
+func RestoreJob(restore *v1alpha1.Restore, dump *RestoreDump, name, pgToolsImage, s3ToolsImage string, deadline time.Duration) *batchv1.Job {
+	// Validated by ResolveRestoreDump.
+	u, _ := parseDumpURL(dump.Location)
+
+	opts := restore.Spec.Options
+	var flags []string
+	if opts.Clean {
+		flags = append(flags, "--clean", "--if-exists")
+	}
+	if opts.NoOwner == nil || *opts.NoOwner {
+		flags = append(flags, "--no-owner")
+	}
+	if opts.NoPrivileges == nil || *opts.NoPrivileges {
+		flags = append(flags, "--no-privileges")
+	}
+	if opts.SchemaOnly {
+		flags = append(flags, "--schema-only")
+	}
+
+	restoreContainer := corev1.Container{
+		Name:    "restore",
+		Image:   pgToolsImage,
+		Command: []string{"bash", "-euo", "pipefail", "-c", restoreScript},
+		Env: []corev1.EnvVar{
+			{Name: "DSN", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: name},
+				Key:                  "DSN",
+			}}},
+			{Name: "RESTORE_FLAGS", Value: strings.Join(flags, " ")},
+			{Name: "RESTORE_SCHEMAS", Value: strings.Join(opts.Schemas, "\n")},
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: "secret", MountPath: dumpMountPath, ReadOnly: true},
+			{Name: "data", MountPath: backupDataPath, ReadOnly: true},
+		},
+		TerminationMessagePolicy: corev1.TerminationMessageFallbackToLogsOnError,
+	}
+
+	activeDeadline := int64(deadline.Seconds())
+	if u.Scheme == "pvc" {
+		job := dumpJob("Restore", restore, name, u.Host)
+		job.Spec.ActiveDeadlineSeconds = &activeDeadline
+		spec := &job.Spec.Template.Spec
+		spec.Volumes = append(spec.Volumes, secretVolume(name))
+		restoreContainer.Env = append(restoreContainer.Env,
+			corev1.EnvVar{Name: "BACKUP_TARGET", Value: path.Join(backupDataPath, u.Path)})
+		spec.Containers = []corev1.Container{restoreContainer}
+		return job
+	}
+
+	job := dumpJob("Restore", restore, name, "")
+	job.Spec.ActiveDeadlineSeconds = &activeDeadline
+	spec := &job.Spec.Template.Spec
+	target := path.Join(backupDataPath, path.Base(u.Path))
+
+	cp := "aws s3 cp"
+	if dump.Format == v1alpha1.BackupFormatDirectory {
+		cp += " --recursive"
+	}
+	download := s3Container(dump.S3, "download", s3ToolsImage, cp+` "$S3_URL" "$BACKUP_TARGET"`)
+	download.Env = append(download.Env,
+		corev1.EnvVar{Name: "S3_URL", Value: dump.Location},
+		corev1.EnvVar{Name: "BACKUP_TARGET", Value: target})
+	download.VolumeMounts = []corev1.VolumeMount{{Name: "data", MountPath: backupDataPath}}
+	download.TerminationMessagePolicy = corev1.TerminationMessageFallbackToLogsOnError
+	spec.InitContainers = []corev1.Container{download}
+
+	restoreContainer.Env = append(restoreContainer.Env, corev1.EnvVar{Name: "BACKUP_TARGET", Value: target})
+	spec.Containers = []corev1.Container{restoreContainer}
+	spec.Volumes = append(spec.Volumes, secretVolume(name), corev1.Volume{
+		Name:         "data",
+		VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	})
+	return job
+}
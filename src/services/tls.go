@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/db"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// LoadTLSMaterial reads the CA bundle and client certificate referenced by a
+// Database or User spec from Secrets in namespace and stores them in conn.
+// The material is only kept in memory and handed to the adapter.
+func LoadTLSMaterial(
+	ctx context.Context,
+	c client.Reader,
+	namespace string,
+	rootRef *v1alpha1.SecretKeySelector,
+	clientRef *v1alpha1.ClientCertSecretRef,
+	conn *db.ConnectionParams,
+) error {
+	if rootRef != nil && rootRef.Name != "" {
+		key := rootRef.Key
+		if key == "" {
+			key = "ca.crt"
+		}
+		data, err := readSecretKeys(ctx, c, namespace, rootRef.Name, key)
+		if err != nil {
+			return fmt.Errorf("sslRootCertSecretRef: %w", err)
+		}
+		conn.SSLRootCert = data[key]
+	}
+
+	if clientRef != nil && clientRef.Name != "" {
+		certKey := clientRef.CertKey
+		if certKey == "" {
+			certKey = corev1.TLSCertKey
+		}
+		keyKey := clientRef.KeyKey
+		if keyKey == "" {
+			keyKey = corev1.TLSPrivateKeyKey
+		}
+		data, err := readSecretKeys(ctx, c, namespace, clientRef.Name, certKey, keyKey)
+		if err != nil {
+			return fmt.Errorf("sslClientCertSecretRef: %w", err)
+		}
+		conn.SSLClientCert = data[certKey]
+		conn.SSLClientKey = data[keyKey]
+	}
+
+	return nil
+}
+
+// readSecretKeys returns the requested keys of a Secret, failing if any is missing.
+func readSecretKeys(ctx context.Context, c client.Reader, namespace, name string, keys ...string) (map[string][]byte, error) {
+	var secret corev1.Secret
+	if err := c.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, &secret); err != nil {
+		return nil, err
+	}
+
+	out := make(map[string][]byte, len(keys))
+	for _, k := range keys {
+		v, ok := secret.Data[k]
+		if !ok {
+			return nil, fmt.Errorf("key %q not found in Secret %s/%s", k, namespace, name)
+		}
+		out[k] = v
+	}
+	return out, nil
+}
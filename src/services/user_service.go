@@ -2,79 +2,91 @@ package services
 
 import (
 	"context"
-	"crypto/rand"
+	"errors"
+	"fmt"
+	"strconv"
 	"time"
 
 	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+	"github.com/mertsaygi/orchestrdb/src/credentials"
 	"github.com/mertsaygi/orchestrdb/src/db"
 
-	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
+// Keys of the custom_metadata that marks a Vault secret as holding the
+// generated credentials of a User.
+const (
+	VaultMetadataOwner    = "orchestrdb-owner"
+	VaultMetadataOwnerUID = "orchestrdb-owner-uid"
+)
+
 type UserService struct {
-	k8sClient client.Client
-	adapter   db.Adapter
+	k8sClient      client.Client
+	adapter        db.Adapter
+	secrets        credentials.Provider
+	vault          credentials.Provider
+	vaultPaths     *VaultPathPolicy
+	passwordPolicy v1alpha1.PasswordPolicy
 }
 
-func NewUserService(k8sClient client.Client, adapter db.Adapter) *UserService {
+// NewUserService creates a new UserService. vault may be nil when no Vault
+// server is configured; vaultPaths restricts the paths Users may use.
+// passwordPolicy is the operator-wide policy that spec.passwordPolicy
+// refines per User.
+func NewUserService(
+	k8sClient client.Client,
+	adapter db.Adapter,
+	vault credentials.Provider,
+	vaultPaths *VaultPathPolicy,
+	passwordPolicy v1alpha1.PasswordPolicy,
+) *UserService {
 	return &UserService{
-		k8sClient: k8sClient,
-		adapter:   adapter,
+		k8sClient:      k8sClient,
+		adapter:        adapter,
+		secrets:        credentials.NewSecretProvider(k8sClient),
+		vault:          vault,
+		vaultPaths:     vaultPaths,
+		passwordPolicy: passwordPolicy,
 	}
 }
 
-// GeneratePassword creates a cryptographically random password.
-func (s *UserService) GeneratePassword(length int) (string, error) {
-	const letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!@#$%^&*()-_=+"
-	b := make([]byte, length)
-	if _, err := rand.Read(b); err != nil {
-		return "", err
-	}
-	for i := range b {
-		b[i] = letters[int(b[i])%len(letters)]
-	}
-	return string(b), nil
+// GeneratePassword creates a cryptographically random password following
+// the operator-wide policy refined by spec.passwordPolicy. A policy the
+// server's password rules reject is an InvalidSpec error.
+func (s *UserService) GeneratePassword(user *v1alpha1.User) (string, error) {
+	policy := MergePasswordPolicy(s.passwordPolicy, user.Spec.PasswordPolicy)
+	return generatePassword(policy, s.adapter.PasswordRules())
 }
 
 // ResolveAdminCredentials resolves admin user/password for a User resource.
+// Precedence: adminVaultRef, adminSecretRef, inline adminUser/adminPassword.
 func (s *UserService) ResolveAdminCredentials(ctx context.Context, user *v1alpha1.User) (string, string, error) {
-	// If AdminSecretRef is set, it takes precedence.
+	if user.Spec.AdminVaultRef != nil && user.Spec.AdminVaultRef.Path != "" {
+		if s.vault == nil {
+			return "", "", apierrors.NewBadRequest("adminVaultRef is set but no Vault server is configured")
+		}
+		ref := user.Spec.AdminVaultRef
+		if err := s.vaultPaths.CheckAdminPath(ctx, s.k8sClient, "User", user, ref.Path); err != nil {
+			return "", "", err
+		}
+		return ReadAdminCredentials(ctx, s.vault, ref.Path, ref.UserKey, ref.PasswordKey)
+	}
+
+	// If AdminSecretRef is set, it takes precedence over inline fields.
 	if user.Spec.AdminSecretRef != nil && user.Spec.AdminSecretRef.Name != "" {
 		secNs := user.Spec.AdminSecretRef.Namespace
 		if secNs == "" {
 			secNs = user.Namespace
 		}
 
-		var secret corev1.Secret
-		if err := s.k8sClient.Get(ctx, types.NamespacedName{
-			Name:      user.Spec.AdminSecretRef.Name,
-			Namespace: secNs,
-		}, &secret); err != nil {
+		if err := CheckSecretReference(ctx, s.k8sClient, "User", user, secNs, user.Spec.AdminSecretRef.Name); err != nil {
 			return "", "", err
 		}
 
-		userKey := user.Spec.AdminSecretRef.UserKey
-		if userKey == "" {
-			userKey = "username"
-		}
-		passKey := user.Spec.AdminSecretRef.PasswordKey
-		if passKey == "" {
-			passKey = "password"
-		}
-
-		uBytes, ok := secret.Data[userKey]
-		if !ok {
-			return "", "", apierrors.NewBadRequest("admin username key not found in adminSecretRef")
-		}
-		pBytes, ok := secret.Data[passKey]
-		if !ok {
-			return "", "", apierrors.NewBadRequest("admin password key not found in adminSecretRef")
-		}
-
-		return string(uBytes), string(pBytes), nil
+		ref := user.Spec.AdminSecretRef
+		return ReadAdminCredentials(ctx, s.secrets, credentials.SecretPath(secNs, ref.Name), ref.UserKey, ref.PasswordKey)
 	}
 
 	// Fallback to inline adminUser/adminPassword.
@@ -85,14 +97,249 @@ func (s *UserService) ResolveAdminCredentials(ctx context.Context, user *v1alpha
 	return user.Spec.AdminUser, user.Spec.AdminPassword, nil
 }
 
+// ReadAdminCredentials reads admin user/password from a credential provider.
+// Empty keys default to "username" and "password".
+func ReadAdminCredentials(ctx context.Context, provider credentials.Provider, path, userKey, passKey string) (string, string, error) {
+	if userKey == "" {
+		userKey = "username"
+	}
+	if passKey == "" {
+		passKey = "password"
+	}
+
+	data, err := provider.Read(ctx, path)
+	if err != nil {
+		return "", "", err
+	}
+
+	u, ok := data[userKey]
+	if !ok {
+		return "", "", apierrors.NewBadRequest("admin username key not found in " + path)
+	}
+	p, ok := data[passKey]
+	if !ok {
+		return "", "", apierrors.NewBadRequest("admin password key not found in " + path)
+	}
+
+	return u, p, nil
+}
+
+// ReadGeneratedVaultSecret reads the generated credentials stored at
+// spec.generatedSecret.vaultPath.
+func (s *UserService) ReadGeneratedVaultSecret(ctx context.Context, user *v1alpha1.User) (map[string]string, bool, error) {
+	if s.vault == nil {
+		return nil, false, apierrors.NewBadRequest("generatedSecret.vaultPath is set but no Vault server is configured")
+	}
+
+	if err := s.vaultPaths.CheckPath("User", user, user.Spec.GeneratedSecret.VaultPath); err != nil {
+		return nil, false, err
+	}
+	data, err := s.vault.Read(ctx, user.Spec.GeneratedSecret.VaultPath)
+	if errors.Is(err, credentials.ErrNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// GeneratedVaultSecretOwner returns the UID of the User recorded in the
+// custom_metadata of spec.generatedSecret.vaultPath, or "" if there is none.
+func (s *UserService) GeneratedVaultSecretOwner(ctx context.Context, user *v1alpha1.User) (string, error) {
+	vault, err := s.vaultMetadata()
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.vaultPaths.CheckPath("User", user, user.Spec.GeneratedSecret.VaultPath); err != nil {
+		return "", err
+	}
+	metadata, err := vault.ReadMetadata(ctx, user.Spec.GeneratedSecret.VaultPath)
+	if err != nil {
+		return "", err
+	}
+	return metadata[VaultMetadataOwnerUID], nil
+}
+
+// WriteGeneratedVaultSecret writes username/password to
+// spec.generatedSecret.vaultPath. The owner is recorded in its
+// custom_metadata first, so a secret is never left without one.
+func (s *UserService) WriteGeneratedVaultSecret(ctx context.Context, user *v1alpha1.User, password string) error {
+	vault, err := s.vaultMetadata()
+	if err != nil {
+		return err
+	}
+
+	if err := s.vaultPaths.CheckPath("User", user, user.Spec.GeneratedSecret.VaultPath); err != nil {
+		return err
+	}
+	metadata := map[string]string{
+		VaultMetadataOwner:    "User/" + user.Namespace + "/" + user.Name,
+		VaultMetadataOwnerUID: string(user.UID),
+	}
+	if err := vault.WriteMetadata(ctx, user.Spec.GeneratedSecret.VaultPath, metadata); err != nil {
+		return err
+	}
+	return vault.Write(ctx, user.Spec.GeneratedSecret.VaultPath, GeneratedCredentials(user, password))
+}
+
+// vaultMetadata returns the Vault provider for generated credentials, which
+// must be able to record their owner.
+func (s *UserService) vaultMetadata() (credentials.MetadataProvider, error) {
+	if s.vault == nil {
+		return nil, apierrors.NewBadRequest("generatedSecret.vaultPath is set but no Vault server is configured")
+	}
+	vault, ok := s.vault.(credentials.MetadataProvider)
+	if !ok {
+		return nil, fmt.Errorf("vault provider cannot record the owner of generated credentials")
+	}
+	return vault, nil
+}
+
+// GeneratedCredentials returns the data stored in the generated Secret or
+// Vault path: username and password, plus the connection details when
+// generatedSecret.database is set.
+func GeneratedCredentials(user *v1alpha1.User, password string) map[string]string {
+	data := map[string]string{
+		"username": user.Spec.Username,
+		"password": password,
+	}
+	if user.Spec.GeneratedSecret.Database != "" {
+		sslMode := user.Spec.SSLMode
+		if sslMode == "" {
+			sslMode = "require"
+		}
+		data["host"] = user.Spec.Host
+		data["port"] = strconv.Itoa(int(user.Spec.Port))
+		data["database"] = user.Spec.GeneratedSecret.Database
+		data["sslMode"] = sslMode
+	}
+	return data
+}
+
 // EnsureUser maps the User spec to adapter params and updates status.
+// The returned error carries the adapter error category (see db.CategoryOf).
 func (s *UserService) EnsureUser(
 	ctx context.Context,
 	user *v1alpha1.User,
 	generatedPassword string,
 	adminUser string,
 	adminPassword string,
-) (bool, string) {
+) (bool, error) {
+	params, err := s.userParams(ctx, user, generatedPassword, adminUser, adminPassword)
+	var result db.EnsureUserResult
+	if err == nil {
+		result, err = s.adapter.EnsureUser(ctx, params)
+	}
+	if err != nil {
+		user.Status.Created = false
+		user.Status.LastError = err.Error()
+		user.Status.UpdatedAt = time.Now().Format(time.RFC3339)
+		setReadyCondition(&user.Status.Conditions, user.Generation, err)
+		return false, err
+	}
+
+	user.Status.Created = true
+	user.Status.LastError = ""
+	if result.PasswordEncryption != "" {
+		user.Status.PasswordEncryption = result.PasswordEncryption
+	}
+	user.Status.UpdatedAt = time.Now().Format(time.RFC3339)
+	setReadyCondition(&user.Status.Conditions, user.Generation, nil)
+	return true, nil
+}
+
+// PlanUser returns the statements EnsureUser would execute, with the
+// password redacted, without executing them or touching the status.
+func (s *UserService) PlanUser(
+	ctx context.Context,
+	user *v1alpha1.User,
+	generatedPassword string,
+	adminUser string,
+	adminPassword string,
+) ([]string, error) {
+	params, err := s.userParams(ctx, user, generatedPassword, adminUser, adminPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &db.Plan{}
+	if _, err := s.adapter.EnsureUser(db.WithPlan(ctx, plan), params); err != nil {
+		return nil, err
+	}
+	return plan.Statements, nil
+}
+
+// DropUser drops the role of user on deletion with deletionPolicy Delete.
+// A role the operator does not manage is a Conflict.
+func (s *UserService) DropUser(
+	ctx context.Context,
+	user *v1alpha1.User,
+	adminUser string,
+	adminPassword string,
+) error {
+	params, err := s.userParams(ctx, user, "", adminUser, adminPassword)
+	if err != nil {
+		return err
+	}
+	return s.adapter.DropUser(ctx, params)
+}
+
+// PlanDropUser returns the statements DropUser would execute.
+func (s *UserService) PlanDropUser(
+	ctx context.Context,
+	user *v1alpha1.User,
+	adminUser string,
+	adminPassword string,
+) ([]string, error) {
+	plan := &db.Plan{}
+	if err := s.DropUser(db.WithPlan(ctx, plan), user, adminUser, adminPassword); err != nil {
+		return nil, err
+	}
+	return plan.Statements, nil
+}
+
+// DetectDrift compares the role on the server with user and returns a
+// description of every difference found. The password is not verified.
+// An empty result means the server is in sync.
+func (s *UserService) DetectDrift(
+	ctx context.Context,
+	user *v1alpha1.User,
+	adminUser string,
+	adminPassword string,
+) ([]string, error) {
+	params, err := s.userParams(ctx, user, "", adminUser, adminPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := s.adapter.ObserveUser(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	if !state.Exists {
+		return []string{fmt.Sprintf("role %s does not exist", user.Spec.Username)}, nil
+	}
+
+	var drift []string
+	if !state.CanLogin {
+		drift = append(drift, fmt.Sprintf("role %s cannot log in", user.Spec.Username))
+	}
+	for _, missing := range state.MissingPrivileges {
+		drift = append(drift, "missing "+missing)
+	}
+	return drift, nil
+}
+
+// userParams builds the adapter parameters for user, including TLS material.
+func (s *UserService) userParams(
+	ctx context.Context,
+	user *v1alpha1.User,
+	generatedPassword string,
+	adminUser string,
+	adminPassword string,
+) (db.EnsureUserParams, error) {
 	sslMode := user.Spec.SSLMode
 	if sslMode == "" {
 		sslMode = "require"
@@ -116,25 +363,53 @@ func (s *UserService) EnsureUser(
 	}
 
 	params := db.EnsureUserParams{
-		Host:              user.Spec.Host,
-		Port:              user.Spec.Port,
-		AdminUser:         adminUser,
-		Password:          adminPassword,
-		SSLMode:           sslMode,
-		Username:          user.Spec.Username,
-		GeneratedPassword: generatedPassword,
-		Access:            access,
+		ConnectionParams: db.ConnectionParams{
+			Host:      user.Spec.Host,
+			Port:      user.Spec.Port,
+			AdminUser: adminUser,
+			Password:  adminPassword,
+			SSLMode:   sslMode,
+		},
+		Username:           user.Spec.Username,
+		GeneratedPassword:  generatedPassword,
+		Access:             access,
+		Owner:              "User/" + user.Namespace + "/" + user.Name,
+		Adopt:              adoptionEnabled(user),
+		KeepPassword:       adoptionEnabled(user) && user.Spec.Adoption.PasswordSecretRef != nil,
+		PasswordEncryption: user.Spec.PasswordEncryption,
 	}
 
-	if err := s.adapter.EnsureUser(ctx, params); err != nil {
-		user.Status.Created = false
-		user.Status.LastError = err.Error()
-		user.Status.UpdatedAt = time.Now().Format(time.RFC3339)
-		return false, err.Error()
+	err := LoadTLSMaterial(ctx, s.k8sClient, user.Namespace,
+		user.Spec.SSLRootCertSecretRef, user.Spec.SSLClientCertSecretRef, &params.ConnectionParams)
+	return params, err
+}
+
+// adoptionEnabled reports whether user may take over an existing role.
+func adoptionEnabled(user *v1alpha1.User) bool {
+	return user.Spec.Adoption != nil && user.Spec.Adoption.Enabled
+}
+
+// ReadAdoptionPassword returns the current password of an adopted role from
+// spec.adoption.passwordSecretRef. found is false when adoption is disabled
+// or no password Secret is referenced.
+func (s *UserService) ReadAdoptionPassword(ctx context.Context, user *v1alpha1.User) (password string, found bool, err error) {
+	if !adoptionEnabled(user) || user.Spec.Adoption.PasswordSecretRef == nil {
+		return "", false, nil
 	}
+	ref := user.Spec.Adoption.PasswordSecretRef
 
-	user.Status.Created = true
-	user.Status.LastError = ""
-	user.Status.UpdatedAt = time.Now().Format(time.RFC3339)
-	return true, ""
+	key := ref.Key
+	if key == "" {
+		key = "password"
+	}
+
+	data, err := s.secrets.Read(ctx, credentials.SecretPath(user.Namespace, ref.Name))
+	if err != nil {
+		return "", false, err
+	}
+	password, ok := data[key]
+	if !ok || password == "" {
+		return "", false, fmt.Errorf("key %q not found in adoption.passwordSecretRef Secret %s", key, ref.Name)
+	}
+	return password, true, nil
 }
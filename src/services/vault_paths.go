@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultVaultPathTemplate is the Vault path prefix of a namespace when the
+// operator is started without --vault-path-template.
+const DefaultVaultPathTemplate = "secret/orchestrdb/{{ .Namespace }}/"
+
+// VaultPathPolicy restricts the Vault paths a resource may read from or
+// write to: they must lie below the prefix rendered for its namespace. The
+// operator's Vault role usually reaches far more than any single tenant
+// should, so paths are never used exactly as written.
+type VaultPathPolicy struct {
+	prefix *template.Template
+}
+
+// NewVaultPathPolicy parses the prefix template. It is rendered with
+// .Namespace, the namespace of the resource.
+func NewVaultPathPolicy(text string) (*VaultPathPolicy, error) {
+	if text == "" {
+		text = DefaultVaultPathTemplate
+	}
+	tmpl, err := template.New("vault-path").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vault path template: %w", err)
+	}
+	return &VaultPathPolicy{prefix: tmpl}, nil
+}
+
+// Prefix returns the path prefix of namespace.
+func (p *VaultPathPolicy) Prefix(namespace string) (string, error) {
+	var b strings.Builder
+	if err := p.prefix.Execute(&b, struct{ Namespace string }{namespace}); err != nil {
+		return "", fmt.Errorf("vault path template failed: %w", err)
+	}
+	prefix := strings.Trim(b.String(), "/")
+	if prefix == "" {
+		return "", fmt.Errorf("vault path template rendered an empty prefix for namespace %s", namespace)
+	}
+	return prefix + "/", nil
+}
+
+// CheckPath verifies that from, a resource of the given kind, may use the
+// Vault path: it must lie below the prefix of its namespace. Violations
+// wrap ErrReferenceNotPermitted.
+func (p *VaultPathPolicy) CheckPath(kind string, from client.Object, path string) error {
+	_, err := p.check(kind, from, path)
+	return err
+}
+
+// CheckAdminPath is CheckPath for adminVaultRef. The Database or User
+// created for a DatabaseClaim may also read the adminVaultRef of its class.
+func (p *VaultPathPolicy) CheckAdminPath(ctx context.Context, c client.Reader, kind string, from client.Object, path string) error {
+	clean, err := p.check(kind, from, path)
+	if err == nil || clean == "" {
+		return err
+	}
+
+	class, _, classErr := claimClassOf(ctx, c, kind, from)
+	if classErr != nil {
+		return classErr
+	}
+	if class != nil && class.Spec.AdminVaultRef != nil && strings.Trim(class.Spec.AdminVaultRef.Path, "/") == clean {
+		return nil
+	}
+	return err
+}
+
+// check implements CheckPath. It also returns the cleaned path, or "" if
+// the path is malformed.
+func (p *VaultPathPolicy) check(kind string, from client.Object, path string) (string, error) {
+	clean := strings.Trim(path, "/")
+	if slices.ContainsFunc(strings.Split(clean, "/"), func(seg string) bool {
+		return seg == "" || seg == "." || seg == ".."
+	}) {
+		return "", fmt.Errorf("%w: invalid vault path %q", ErrReferenceNotPermitted, path)
+	}
+
+	prefix, err := p.Prefix(from.GetNamespace())
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(clean, prefix) {
+		return clean, nil
+	}
+	return clean, fmt.Errorf("%w: %s in namespace %s may only use vault paths below %s, not %s",
+		ErrReferenceNotPermitted, kind, from.GetNamespace(), prefix, path)
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	v1alpha1 "github.com/mertsaygi/orchestrdb/src/api/v1alpha1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestVaultPathPolicyCheckPath(t *testing.T) {
+	user := &v1alpha1.User{ObjectMeta: metav1.ObjectMeta{Name: "alice", Namespace: "team-a"}}
+
+	tests := []struct {
+		name     string
+		template string
+		path     string
+		wantErr  bool
+	}{
+		{name: "below the prefix", path: "secret/orchestrdb/team-a/appdb-user"},
+		{name: "nested", path: "secret/orchestrdb/team-a/apps/appdb-user"},
+		{name: "surrounding slashes", path: "/secret/orchestrdb/team-a/appdb-user/"},
+		{name: "the prefix itself", path: "secret/orchestrdb/team-a", wantErr: true},
+		{name: "other namespace", path: "secret/orchestrdb/team-b/appdb-user", wantErr: true},
+		{name: "namespace as a name prefix", path: "secret/orchestrdb/team-ab/appdb-user", wantErr: true},
+		{name: "outside the prefix", path: "secret/platform/rds-admin", wantErr: true},
+		{name: "dot dot", path: "secret/orchestrdb/team-a/../team-b/x", wantErr: true},
+		{name: "dot", path: "secret/orchestrdb/team-a/./x", wantErr: true},
+		{name: "empty segment", path: "secret/orchestrdb/team-a//x", wantErr: true},
+		{name: "empty", path: "", wantErr: true},
+		{name: "custom template", template: "kv/tenants/{{ .Namespace }}", path: "kv/tenants/team-a/x"},
+		{name: "custom template other namespace", template: "kv/tenants/{{ .Namespace }}", path: "kv/tenants/team-b/x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := NewVaultPathPolicy(tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = policy.CheckPath("User", user, tt.path)
+			if tt.wantErr {
+				if !errors.Is(err, ErrReferenceNotPermitted) {
+					t.Fatalf("CheckPath(%q) error = %v, want ErrReferenceNotPermitted", tt.path, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("CheckPath(%q) error = %v", tt.path, err)
+			}
+		})
+	}
+}
+
+func TestNewVaultPathPolicy(t *testing.T) {
+	if _, err := NewVaultPathPolicy("{{ .Namespace"); err == nil {
+		t.Error("invalid template accepted")
+	}
+	policy, err := NewVaultPathPolicy("{{ if false }}x{{ end }}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := policy.Prefix("team-a"); err == nil {
+		t.Error("empty prefix accepted")
+	}
+}